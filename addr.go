@@ -1,13 +1,23 @@
 // Package noise provides a high-level wrapper around the go-i2p/noise package
 // implementing net.Conn, net.Listener, and net.Addr interfaces for the Noise Protocol Framework.
 // It supports extensible handshake modification for implementing I2P's NTCP2 and SSU2 transport protocols.
+//
+// NoiseConn sends standard Noise transport messages by default. With
+// ConnConfig.MessageTypes it prefixes every transport plaintext with a
+// one-byte message type (data, rekey, end-of-stream or close), and its peer
+// must then also be a NoiseConn with MessageTypes enabled.
 package noise
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
 	"net"
 )
 
+// fingerprintLen is the number of SHA-256 bytes shown in a peer key fingerprint.
+const fingerprintLen = 8
+
 // NoiseAddr implements net.Addr for Noise Protocol connections.
 // It wraps an underlying net.Addr and adds Noise-specific addressing information.
 type NoiseAddr struct {
@@ -17,6 +27,8 @@ type NoiseAddr struct {
 	pattern string
 	// role indicates if this is an initiator or responder address
 	role string
+	// peerStatic is the static public key of the peer at this address, if known
+	peerStatic []byte
 }
 
 // NewNoiseAddr creates a new NoiseAddr wrapping an underlying network address.
@@ -42,11 +54,16 @@ func (na *NoiseAddr) Network() string {
 // String returns a string representation of the Noise address.
 // Format: "noise://[pattern]/[role]/[underlying_address]"
 // Example: "noise://Noise_XX_25519_AESGCM_SHA256/initiator/192.168.1.1:8080"
+// When the peer's static key is known, its fingerprint is appended as "#[fingerprint]".
 func (na *NoiseAddr) String() string {
-	if na.underlying == nil {
-		return fmt.Sprintf("noise://%s/%s", na.pattern, na.role)
+	s := fmt.Sprintf("noise://%s/%s", na.pattern, na.role)
+	if na.underlying != nil {
+		s += "/" + na.underlying.String()
 	}
-	return fmt.Sprintf("noise://%s/%s/%s", na.pattern, na.role, na.underlying.String())
+	if fp := na.Fingerprint(); fp != "" {
+		s += "#" + fp
+	}
+	return s
 }
 
 // Underlying returns the wrapped network address.
@@ -56,6 +73,8 @@ func (na *NoiseAddr) Underlying() net.Addr {
 }
 
 // Pattern returns the Noise protocol pattern.
+// Addresses of a NoiseConn or NoiseListener carry the full protocol name,
+// e.g. "Noise_XX_25519_ChaChaPoly_BLAKE2s".
 func (na *NoiseAddr) Pattern() string {
 	return na.pattern
 }
@@ -64,3 +83,43 @@ func (na *NoiseAddr) Pattern() string {
 func (na *NoiseAddr) Role() string {
 	return na.role
 }
+
+// PeerStatic returns a copy of the peer's static public key, or nil if unknown.
+func (na *NoiseAddr) PeerStatic() []byte {
+	if len(na.peerStatic) == 0 {
+		return nil
+	}
+	key := make([]byte, len(na.peerStatic))
+	copy(key, na.peerStatic)
+	return key
+}
+
+// Fingerprint returns a short hex fingerprint of the peer's static key,
+// derived from its SHA-256 hash. It returns "" if the key is unknown.
+func (na *NoiseAddr) Fingerprint() string {
+	return keyFingerprint(na.peerStatic)
+}
+
+// keyFingerprint returns the short hex fingerprint of a static public key, or "" if key is empty.
+func keyFingerprint(key []byte) string {
+	if len(key) == 0 {
+		return ""
+	}
+	sum := sha256.Sum256(key)
+	return hex.EncodeToString(sum[:fingerprintLen])
+}
+
+// withPeerStatic returns a copy of the address that carries the given peer static key.
+func (na *NoiseAddr) withPeerStatic(key []byte) *NoiseAddr {
+	addr := *na
+	addr.peerStatic = make([]byte, len(key))
+	copy(addr.peerStatic, key)
+	return &addr
+}
+
+// withPattern returns a copy of the address that carries a different protocol name.
+func (na *NoiseAddr) withPattern(pattern string) *NoiseAddr {
+	addr := *na
+	addr.pattern = pattern
+	return &addr
+}
@@ -381,3 +381,34 @@ func TestNoiseAddrEquality(t *testing.T) {
 		t.Errorf("Addresses with same underlying network should have same network")
 	}
 }
+
+func TestNoiseAddrFingerprint(t *testing.T) {
+	tcpAddr := &net.TCPAddr{IP: net.ParseIP("192.168.1.1"), Port: 8080}
+	addr := NewNoiseAddr(tcpAddr, "Noise_XX_25519_AESGCM_SHA256", "responder")
+
+	if addr.Fingerprint() != "" || addr.PeerStatic() != nil {
+		t.Fatalf("expected no fingerprint without a peer key")
+	}
+
+	key := make([]byte, 32)
+	key[0] = 1
+	withKey := addr.withPeerStatic(key)
+	fp := withKey.Fingerprint()
+	if len(fp) != 2*fingerprintLen {
+		t.Fatalf("expected %d hex characters, got %q", 2*fingerprintLen, fp)
+	}
+
+	expected := "noise://Noise_XX_25519_AESGCM_SHA256/responder/192.168.1.1:8080#" + fp
+	if withKey.String() != expected {
+		t.Errorf("expected %q, got %q", expected, withKey.String())
+	}
+	if addr.String() == withKey.String() {
+		t.Errorf("original address must not be modified")
+	}
+
+	other := make([]byte, 32)
+	other[0] = 2
+	if addr.withPeerStatic(other).Fingerprint() == fp {
+		t.Errorf("different keys should have different fingerprints")
+	}
+}
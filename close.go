@@ -0,0 +1,130 @@
+package noise
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/samber/oops"
+	"github.com/sirupsen/logrus"
+)
+
+// Close codes sent by CloseWithReason. Applications may define their own
+// codes; values below 16 are reserved for this library.
+const (
+	// CloseNormal is a deliberate close with no error
+	CloseNormal uint8 = 0
+	// CloseShutdown means the node is going down
+	CloseShutdown uint8 = 1
+	// CloseProtocolError means the peer violated the application protocol
+	CloseProtocolError uint8 = 2
+)
+
+// maxCloseReasonLen bounds the reason text in a close message. Longer
+// reasons are truncated.
+const maxCloseReasonLen = 256
+
+// closeMessageTimeout bounds how long CloseWithReason waits to send the close
+// message when no WriteTimeout is configured.
+const closeMessageTimeout = time.Second
+
+// RemoteCloseError is returned by Read after the peer closed the connection
+// with CloseWithReason. Data sent before the close is read first.
+type RemoteCloseError struct {
+	// Code is the peer's close code
+	Code uint8
+	// Reason is the peer's explanation, possibly empty
+	Reason string
+}
+
+// Error implements the error interface.
+func (e *RemoteCloseError) Error() string {
+	if e.Reason == "" {
+		return fmt.Sprintf("peer closed the connection with code %d", e.Code)
+	}
+	return fmt.Sprintf("peer closed the connection with code %d: %s", e.Code, e.Reason)
+}
+
+// CloseWithReason sends an encrypted close message carrying code and reason,
+// then closes the connection. The peer's Read returns a *RemoteCloseError,
+// which it can tell apart from a crash or a truncated stream. If the
+// handshake has not completed, the write side is already closed, or another
+// goroutine is blocked in Write, the message is skipped and the connection is
+// simply closed. The close message requires MessageTypes; without it
+// CloseWithReason behaves like Close.
+func (nc *NoiseConn) CloseWithReason(code uint8, reason string) error {
+	if len(reason) > maxCloseReasonLen {
+		reason = reason[:maxCloseReasonLen]
+	}
+
+	if nc.config.MessageTypes && nc.writeMutex.TryLock() {
+		if err := nc.sendClose(code, reason); err != nil {
+			nc.logger.WithFields(logrus.Fields{
+				"code":  code,
+				"error": err.Error(),
+			}).Debug("Close message not sent")
+		}
+		nc.writeMutex.Unlock()
+	}
+
+	return nc.Close()
+}
+
+// sendClose writes the close message. The caller must hold writeMutex.
+func (nc *NoiseConn) sendClose(code uint8, reason string) error {
+	if err := nc.validateWriteState(); err != nil {
+		return err
+	}
+
+	timeout := nc.config.WriteTimeout
+	if timeout <= 0 {
+		timeout = closeMessageTimeout
+	}
+	if err := nc.underlying.SetWriteDeadline(time.Now().Add(timeout)); err != nil {
+		return oops.
+			Code("SET_DEADLINE_FAILED").
+			In("noise").
+			With("timeout", timeout).
+			Wrapf(err, "failed to set write deadline")
+	}
+
+	plaintext := append([]byte{msgTypeClose, code}, reason...)
+	encrypted, err := nc.encryptData(plaintext)
+	if err != nil {
+		return err
+	}
+
+	if err := writeFrame(nc.underlying, encrypted); err != nil {
+		return oops.
+			Code("CLOSE_MESSAGE_FAILED").
+			In("noise").
+			With("code", code).
+			Wrapf(err, "failed to send close message")
+	}
+	nc.writeClosed = true
+
+	nc.logger.WithFields(logrus.Fields{
+		"code":   code,
+		"reason": reason,
+	}).Debug("Close message sent")
+
+	return nil
+}
+
+// receiveClose records the peer's close message. The caller must hold readMutex.
+func (nc *NoiseConn) receiveClose(body []byte) error {
+	if len(body) == 0 {
+		return oops.
+			Code("INVALID_CLOSE_MESSAGE").
+			In("noise").
+			Wrapf(ErrProtocolViolation, "close message has no close code")
+	}
+
+	nc.remoteClose = &RemoteCloseError{Code: body[0], Reason: string(body[1:])}
+
+	nc.logger.WithFields(logrus.Fields{
+		"code":   nc.remoteClose.Code,
+		"reason": nc.remoteClose.Reason,
+	}).Debug("Peer closed the connection")
+
+	return nil
+}
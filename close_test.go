@@ -0,0 +1,106 @@
+package noise
+
+import (
+	"errors"
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-i2p/go-noise/internal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCloseWithReason(t *testing.T) {
+	initiator, responder := establishPair(t, NewConnConfig("NN", true).WithMessageTypes(true), NewConnConfig("NN", false).WithMessageTypes(true))
+
+	closed := make(chan error, 1)
+	go func() {
+		_, _ = initiator.Write([]byte("last words"))
+		closed <- initiator.CloseWithReason(CloseProtocolError, "bad request")
+	}()
+
+	buf := make([]byte, len("last words"))
+	_, err := io.ReadFull(responder, buf)
+	require.NoError(t, err, "data sent before the close is delivered first")
+	assert.Equal(t, "last words", string(buf))
+
+	_, err = responder.Read(buf)
+	var closeErr *RemoteCloseError
+	require.True(t, errors.As(err, &closeErr), "got %v", err)
+	assert.Equal(t, CloseProtocolError, closeErr.Code)
+	assert.Equal(t, "bad request", closeErr.Reason)
+	assert.Equal(t, "peer closed the connection with code 2: bad request", closeErr.Error())
+
+	_, err = responder.Read(buf)
+	assert.Same(t, closeErr, err, "the close error is sticky")
+	require.NoError(t, <-closed)
+	assert.Equal(t, internal.StateClosed, initiator.GetConnectionState())
+}
+
+func TestCloseWithReasonTruncatesReason(t *testing.T) {
+	initiator, responder := establishPair(t, NewConnConfig("NN", true).WithMessageTypes(true), NewConnConfig("NN", false).WithMessageTypes(true))
+
+	go func() { _ = initiator.CloseWithReason(CloseNormal, strings.Repeat("x", 1000)) }()
+
+	_, err := responder.Read(make([]byte, 8))
+	var closeErr *RemoteCloseError
+	require.True(t, errors.As(err, &closeErr), "got %v", err)
+	assert.Len(t, closeErr.Reason, maxCloseReasonLen)
+}
+
+func TestCloseWithReasonBeforeHandshake(t *testing.T) {
+	local, remote := net.Pipe()
+	defer remote.Close()
+
+	nc, err := NewNoiseConn(local, NewConnConfig("NN", true).WithMessageTypes(true))
+	require.NoError(t, err)
+	require.NoError(t, nc.CloseWithReason(CloseNormal, "never mind"))
+	assert.Equal(t, internal.StateClosed, nc.GetConnectionState())
+}
+
+func TestShutdownManagerSendsCloseReason(t *testing.T) {
+	client, server := establishTCPPair(t)
+
+	sm := NewShutdownManager(100 * time.Millisecond)
+	server.SetShutdownManager(sm)
+
+	readErr := make(chan error, 1)
+	go func() {
+		_, err := client.Read(make([]byte, 8))
+		readErr <- err
+	}()
+
+	go func() { _ = sm.Shutdown() }()
+
+	select {
+	case err := <-readErr:
+		var closeErr *RemoteCloseError
+		require.True(t, errors.As(err, &closeErr), "got %v", err)
+		assert.Equal(t, CloseShutdown, closeErr.Code)
+	case <-time.After(5 * time.Second):
+		t.Fatal("peer was not told about the shutdown")
+	}
+}
+
+func TestShutdownManagerForceCloseDoesNotWaitOnStalledPeers(t *testing.T) {
+	sm := NewShutdownManager(100 * time.Millisecond)
+	for i := 0; i < 5; i++ {
+		// The peers never read, so each close message blocks until its
+		// write deadline.
+		conn, _ := establishPair(t,
+			NewConnConfig("NN", true).WithMessageTypes(true).WithWriteTimeout(time.Minute),
+			NewConnConfig("NN", false).WithMessageTypes(true))
+		conn.SetShutdownManager(sm)
+	}
+
+	start := time.Now()
+	_ = sm.Shutdown()
+	assert.Less(t, time.Since(start), 3*time.Second)
+
+	sm.mu.RLock()
+	defer sm.mu.RUnlock()
+	assert.Empty(t, sm.connections)
+}
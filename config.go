@@ -1,16 +1,21 @@
 package noise
 
 import (
+	"bytes"
+	"crypto/rand"
+	"io"
 	"time"
 
 	"github.com/go-i2p/go-noise/handshake"
+	"github.com/go-i2p/go-noise/internal"
 	"github.com/samber/oops"
 )
 
 // ConnConfig contains configuration for creating a NoiseConn.
 // It follows the builder pattern for optional configuration and validation.
 type ConnConfig struct {
-	// Pattern is the Noise protocol pattern (e.g., "Noise_XX_25519_AESGCM_SHA256")
+	// Pattern is the Noise protocol name (e.g., "Noise_XX_25519_ChaChaPoly_BLAKE2s").
+	// A bare pattern such as "XX" uses the default 25519_AESGCM_SHA256 suite.
 	Pattern string
 
 	// Initiator indicates if this connection is the handshake initiator
@@ -23,6 +28,45 @@ type ConnConfig struct {
 	// Required for some patterns, optional for others
 	RemoteKey []byte
 
+	// PresharedKey is the optional symmetric key for pskN patterns (32 bytes)
+	PresharedKey []byte
+
+	// PresharedKeyPlacement is the pskN modifier position for PresharedKey
+	PresharedKeyPlacement int
+
+	// Prologue is optional data bound into the handshake hash; both peers must use the same value
+	Prologue []byte
+
+	// NoisePipes enables IK with automatic XXfallback. The pattern must be IK;
+	// the initiator's RemoteKey is the cached, possibly stale, responder key
+	NoisePipes bool
+
+	// RekeyPolicy triggers automatic rekeying of the send cipher; it
+	// requires MessageTypes. Default: disabled (zero value)
+	RekeyPolicy RekeyPolicy
+
+	// MessageTypes prefixes every transport message with a one-byte type so
+	// the connection can signal rekeys, end-of-stream, close reasons and
+	// keepalives. This envelope is go-noise's own format and both peers must
+	// enable it. Without it, transport messages are plain Noise messages
+	// that any Noise implementation can read. Default: false
+	MessageTypes bool
+
+	// HandshakePayloadProvider returns the payload to send in the handshake
+	// message at msgIndex, or nil for none. Indexes count every message of the
+	// exchange, including a failed Noise Pipes IK message. Optional.
+	HandshakePayloadProvider func(msgIndex int) []byte
+
+	// HandshakePayloadHandler is called with each non-empty payload received
+	// during the handshake. Returning an error aborts the handshake. Optional.
+	HandshakePayloadHandler func(payload HandshakePayload) error
+
+	// VerifyPeer authorizes the peer's static key as soon as a handshake
+	// message reveals it, before that message's payload is delivered. It
+	// receives the key and the payload of the carrying message; returning an
+	// error aborts the handshake with PEER_REJECTED. Optional.
+	VerifyPeer func(remoteStatic []byte, payload []byte) error
+
 	// HandshakeTimeout is the maximum time to wait for handshake completion
 	// Default: 30 seconds
 	HandshakeTimeout time.Duration
@@ -35,6 +79,17 @@ type ConnConfig struct {
 	// Default: no timeout (0)
 	WriteTimeout time.Duration
 
+	// KeepaliveInterval is how long the send side may stay idle before an
+	// empty keepalive message is sent; it requires MessageTypes.
+	// Default: disabled (0)
+	KeepaliveInterval time.Duration
+
+	// KeepaliveTimeout closes the connection with PEER_TIMEOUT when a pending
+	// Read receives nothing, not even a keepalive, for this long.
+	// It should be a few multiples of the peer's KeepaliveInterval.
+	// Default: disabled (0)
+	KeepaliveTimeout time.Duration
+
 	// HandshakeRetries is the number of handshake retry attempts
 	// Default: 3 attempts (0 = no retries, -1 = infinite retries)
 	HandshakeRetries int
@@ -48,6 +103,14 @@ type ConnConfig struct {
 	// Modifiers are applied in order during outbound processing and in reverse
 	// order during inbound processing. Default: empty (no modifiers)
 	Modifiers []handshake.HandshakeModifier
+
+	// random and ephemeralKey make handshakes deterministic for conformance
+	// tests. They are unexported so production code always uses crypto/rand.
+	random       io.Reader
+	ephemeralKey []byte
+
+	// keyPairErr is set when WithKeyPair was given a nil keypair
+	keyPairErr error
 }
 
 // NewConnConfig creates a new ConnConfig with sensible defaults.
@@ -71,6 +134,15 @@ func (c *ConnConfig) WithStaticKey(key []byte) *ConnConfig {
 	return c
 }
 
+// WithKeyPair sets the static key from a keypair.
+// A nil keypair makes Validate fail.
+func (c *ConnConfig) WithKeyPair(kp *KeyPair) *ConnConfig {
+	if c.keyPairErr = nilKeyPairError(kp); c.keyPairErr != nil {
+		return c
+	}
+	return c.WithStaticKey(kp.Private)
+}
+
 // WithRemoteKey sets the remote peer's static public key.
 // key must be 32 bytes for Curve25519.
 func (c *ConnConfig) WithRemoteKey(key []byte) *ConnConfig {
@@ -79,6 +151,75 @@ func (c *ConnConfig) WithRemoteKey(key []byte) *ConnConfig {
 	return c
 }
 
+// WithPresharedKey sets the pre-shared symmetric key and its pskN placement.
+// key must be 32 bytes. If Pattern names a psk modifier (e.g. "XXpsk3"), the
+// placement must match it; otherwise the modifier is added to a bare pattern.
+func (c *ConnConfig) WithPresharedKey(key []byte, placement int) *ConnConfig {
+	c.PresharedKey = make([]byte, len(key))
+	copy(c.PresharedKey, key)
+	c.PresharedKeyPlacement = placement
+	return c
+}
+
+// WithPrologue sets data, such as a version string or negotiation transcript,
+// that is bound into the handshake hash. Both peers must supply identical prologues.
+func (c *ConnConfig) WithPrologue(prologue []byte) *ConnConfig {
+	c.Prologue = make([]byte, len(prologue))
+	copy(c.Prologue, prologue)
+	return c
+}
+
+// WithHandshakePayloadProvider sets the function that supplies payloads for outgoing
+// handshake messages. Payloads in messages sent before any key is established
+// travel in cleartext; see PayloadSecurity.
+func (c *ConnConfig) WithHandshakePayloadProvider(provider func(msgIndex int) []byte) *ConnConfig {
+	c.HandshakePayloadProvider = provider
+	return c
+}
+
+// WithHandshakePayloadHandler sets the callback for payloads received during the handshake.
+func (c *ConnConfig) WithHandshakePayloadHandler(handler func(payload HandshakePayload) error) *ConnConfig {
+	c.HandshakePayloadHandler = handler
+	return c
+}
+
+// WithVerifyPeer sets the callback that authorizes the peer's static key
+// during the handshake, e.g. against an allowlist.
+func (c *ConnConfig) WithVerifyPeer(verify func(remoteStatic []byte, payload []byte) error) *ConnConfig {
+	c.VerifyPeer = verify
+	return c
+}
+
+// WithNoisePipes enables Noise Pipes: the initiator attempts IK with its cached
+// RemoteKey, and if the responder cannot decrypt that first message both sides
+// switch to XXfallback on the same connection. Both peers must enable it and
+// configure a static key. NoiseConn.HandshakePath reports which path was taken.
+//
+// On fallback, the payload of the initiator's IK message is lost: the
+// responder could not decrypt it. Handshake messages keep counting across the
+// switch, so the XXfallback messages have indexes 1 and 2, and the
+// HandshakePayloadProvider can resend that payload at index 2, which only a
+// fallback reaches. The responder marks its reply with a byte saying which
+// path it took; the marker is specific to go-noise.
+func (c *ConnConfig) WithNoisePipes(enabled bool) *ConnConfig {
+	c.NoisePipes = enabled
+	return c
+}
+
+// WithRekeyPolicy sets the policy for automatic send cipher rekeying.
+func (c *ConnConfig) WithRekeyPolicy(policy RekeyPolicy) *ConnConfig {
+	c.RekeyPolicy = policy
+	return c
+}
+
+// WithMessageTypes enables the typed transport envelope that carries rekey
+// signals, end-of-stream, close reasons and keepalives. Both peers must use
+// the same setting.
+func (c *ConnConfig) WithMessageTypes(enabled bool) *ConnConfig {
+	c.MessageTypes = enabled
+	return c
+}
+
 // WithHandshakeTimeout sets the handshake timeout.
 func (c *ConnConfig) WithHandshakeTimeout(timeout time.Duration) *ConnConfig {
 	c.HandshakeTimeout = timeout
@@ -97,6 +238,14 @@ func (c *ConnConfig) WithWriteTimeout(timeout time.Duration) *ConnConfig {
 	return c
 }
 
+// WithKeepalive sets the keepalive interval and the peer timeout.
+// Either may be 0 to disable that half of the mechanism.
+func (c *ConnConfig) WithKeepalive(interval, timeout time.Duration) *ConnConfig {
+	c.KeepaliveInterval = interval
+	c.KeepaliveTimeout = timeout
+	return c
+}
+
 // WithHandshakeRetries sets the number of handshake retry attempts.
 // Use 0 for no retries, -1 for infinite retries.
 func (c *ConnConfig) WithHandshakeRetries(retries int) *ConnConfig {
@@ -144,6 +293,10 @@ func (c *ConnConfig) GetModifierChain() *handshake.ModifierChain {
 // Validate checks if the configuration is valid and complete.
 // Returns an error with context if validation fails.
 func (c *ConnConfig) Validate() error {
+	if c.keyPairErr != nil {
+		return c.keyPairErr
+	}
+
 	if err := c.validatePattern(); err != nil {
 		return err
 	}
@@ -164,6 +317,26 @@ func (c *ConnConfig) Validate() error {
 		return err
 	}
 
+	if err := c.validatePresharedKey(); err != nil {
+		return err
+	}
+
+	if err := c.validateRekeyPolicy(); err != nil {
+		return err
+	}
+
+	if err := validateKeepalive(c.KeepaliveInterval, c.KeepaliveTimeout); err != nil {
+		return err
+	}
+
+	if err := validateMessageTypes(c.MessageTypes, c.RekeyPolicy, c.KeepaliveInterval); err != nil {
+		return err
+	}
+
+	if err := c.validateNoisePipes(); err != nil {
+		return err
+	}
+
 	return nil
 }
 
@@ -174,7 +347,7 @@ func (c *ConnConfig) validatePattern() error {
 			Code("INVALID_PATTERN").
 			In("noise").
 			With("config", c).
-			Errorf("noise pattern is required")
+			Wrapf(ErrInvalidConfig, "noise pattern is required")
 	}
 	return nil
 }
@@ -187,7 +360,7 @@ func (c *ConnConfig) validateHandshakeTimeout() error {
 			In("noise").
 			With("timeout", c.HandshakeTimeout).
 			With("pattern", c.Pattern).
-			Errorf("handshake timeout must be positive")
+			Wrapf(ErrInvalidConfig, "handshake timeout must be positive")
 	}
 	return nil
 }
@@ -200,7 +373,7 @@ func (c *ConnConfig) validateRetryConfig() error {
 			In("noise").
 			With("retries", c.HandshakeRetries).
 			With("pattern", c.Pattern).
-			Errorf("handshake retries must be >= -1 (-1 = infinite, 0 = no retries)")
+			Wrapf(ErrInvalidConfig, "handshake retries must be >= -1 (-1 = infinite, 0 = no retries)")
 	}
 
 	if c.RetryBackoff < 0 {
@@ -209,7 +382,7 @@ func (c *ConnConfig) validateRetryConfig() error {
 			In("noise").
 			With("backoff", c.RetryBackoff).
 			With("pattern", c.Pattern).
-			Errorf("retry backoff must be non-negative")
+			Wrapf(ErrInvalidConfig, "retry backoff must be non-negative")
 	}
 
 	return nil
@@ -223,7 +396,7 @@ func (c *ConnConfig) validateStaticKeyLength() error {
 			In("noise").
 			With("key_length", len(c.StaticKey)).
 			With("pattern", c.Pattern).
-			Errorf("static key must be 32 bytes for Curve25519")
+			Wrapf(ErrInvalidConfig, "static key must be 32 bytes for Curve25519")
 	}
 	return nil
 }
@@ -236,7 +409,119 @@ func (c *ConnConfig) validateRemoteKeyLength() error {
 			In("noise").
 			With("key_length", len(c.RemoteKey)).
 			With("pattern", c.Pattern).
-			Errorf("remote key must be 32 bytes for Curve25519")
+			Wrapf(ErrInvalidConfig, "remote key must be 32 bytes for Curve25519")
+	}
+	return nil
+}
+
+// validatePresharedKey checks the pre-shared key length and its agreement with the pattern.
+func (c *ConnConfig) validatePresharedKey() error {
+	if len(c.PresharedKey) > 0 && len(c.PresharedKey) != 32 {
+		return oops.
+			Code("INVALID_KEY_LENGTH").
+			In("noise").
+			With("key_length", len(c.PresharedKey)).
+			With("pattern", c.Pattern).
+			Wrapf(ErrInvalidConfig, "pre-shared key must be 32 bytes")
+	}
+	// Unknown pattern names are reported when the handshake state is created.
+	if _, err := parseProtocolName(c.Pattern); err != nil {
+		return nil
+	}
+	if _, err := resolveProtocol(c.Pattern, c.PresharedKey, c.PresharedKeyPlacement); err != nil {
+		return oops.
+			Code("INVALID_PATTERN").
+			In("noise").
+			With("pattern", c.Pattern).
+			Wrapf(internal.Mark(err, ErrInvalidConfig), "invalid noise pattern")
+	}
+	return nil
+}
+
+// validateRekeyPolicy checks that the rekey interval is not negative.
+func (c *ConnConfig) validateRekeyPolicy() error {
+	if c.RekeyPolicy.Interval < 0 {
+		return oops.
+			Code("INVALID_REKEY_POLICY").
+			In("noise").
+			With("interval", c.RekeyPolicy.Interval).
+			With("pattern", c.Pattern).
+			Wrapf(ErrInvalidConfig, "rekey interval must be non-negative")
+	}
+	return nil
+}
+
+// validateKeepalive checks that the keepalive settings are non-negative and
+// that the timeout, when both are set, leaves room for a keepalive to arrive.
+func validateKeepalive(interval, timeout time.Duration) error {
+	if interval < 0 || timeout < 0 {
+		return oops.
+			Code("INVALID_KEEPALIVE").
+			In("noise").
+			With("interval", interval).
+			With("timeout", timeout).
+			Wrapf(ErrInvalidConfig, "keepalive interval and timeout must be non-negative")
+	}
+	if interval > 0 && timeout > 0 && timeout <= interval {
+		return oops.
+			Code("INVALID_KEEPALIVE").
+			In("noise").
+			With("interval", interval).
+			With("timeout", timeout).
+			Wrapf(ErrInvalidConfig, "keepalive timeout must be longer than the keepalive interval")
+	}
+	return nil
+}
+
+// validateMessageTypes checks that the features which signal the peer
+// through the typed transport envelope are only enabled together with it.
+func validateMessageTypes(enabled bool, policy RekeyPolicy, keepaliveInterval time.Duration) error {
+	if enabled {
+		return nil
+	}
+	if policy != (RekeyPolicy{}) {
+		return oops.
+			Code("MESSAGE_TYPES_REQUIRED").
+			In("noise").
+			With("rekey_policy", policy).
+			Wrapf(ErrInvalidConfig, "a rekey policy requires MessageTypes")
+	}
+	if keepaliveInterval > 0 {
+		return oops.
+			Code("MESSAGE_TYPES_REQUIRED").
+			In("noise").
+			With("keepalive_interval", keepaliveInterval).
+			Wrapf(ErrInvalidConfig, "sending keepalives requires MessageTypes")
+	}
+	return nil
+}
+
+// validateNoisePipes checks that Noise Pipes is only enabled for IK without a PSK.
+func (c *ConnConfig) validateNoisePipes() error {
+	if !c.NoisePipes {
+		return nil
+	}
+	p, err := parseProtocolName(c.Pattern)
+	if err != nil || p.Pattern.Name != "IK" || p.PSKPlacement >= 0 || len(c.PresharedKey) > 0 {
+		return oops.
+			Code("INVALID_PATTERN").
+			In("noise").
+			With("pattern", c.Pattern).
+			Wrapf(ErrInvalidConfig, "noise pipes requires the IK pattern without a pre-shared key")
 	}
 	return nil
 }
+
+// handshakeRandom returns the entropy source for a handshake. The library
+// generates each ephemeral keypair from it, so a fixed ephemeral private key
+// is supplied by reading it first.
+func (c *ConnConfig) handshakeRandom() io.Reader {
+	random := c.random
+	if random == nil {
+		random = rand.Reader
+	}
+	if len(c.ephemeralKey) > 0 {
+		random = io.MultiReader(bytes.NewReader(c.ephemeralKey), random)
+	}
+	return random
+}
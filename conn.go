@@ -1,12 +1,17 @@
 package noise
 
 import (
+	"bytes"
 	"context"
+	"errors"
+	"io"
 	"net"
+	"os"
 	"sync"
 	"time"
 
 	"github.com/go-i2p/noise"
+	"github.com/go-i2p/go-noise/handshake"
 	"github.com/go-i2p/go-noise/internal"
 	"github.com/go-i2p/logger"
 	"github.com/samber/oops"
@@ -23,18 +28,76 @@ type NoiseConn struct {
 	// config contains the Noise protocol configuration
 	config *ConnConfig
 
-	// cipherState handles encryption/decryption after handshake
-	cipherState *noise.CipherState
+	// sendCipher encrypts outbound transport messages after handshake
+	sendCipher *noise.CipherState
+
+	// recvCipher decrypts inbound transport messages after handshake
+	recvCipher *noise.CipherState
 
 	// handshakeState handles the handshake process
 	handshakeState *noise.HandshakeState
 
+	// handshakeMsgIndex counts the handshake messages exchanged in the current attempt
+	handshakeMsgIndex int
+
+	// handshakeMsgCount is the total number of messages in the handshake pattern
+	handshakeMsgCount int
+
+	// handshakeMsgOffset is the number of messages exchanged under a pattern
+	// that was abandoned, so payload indexes keep counting across a Noise
+	// Pipes fallback
+	handshakeMsgOffset int
+
+	// handshakeInitiator is this side's Noise role in the current handshake;
+	// it differs from config.Initiator after a Noise Pipes fallback
+	handshakeInitiator bool
+
+	// handshakePath records whether the handshake fell back to XXfallback
+	handshakePath HandshakePath
+
+	// protocol is the resolved protocol for the configured pattern
+	protocol *protocol
+
+	// modifierChain transforms handshake messages on the wire (nil if none configured)
+	modifierChain *handshake.ModifierChain
+
+	// payloadSecurity is the protection level of each handshake message payload
+	payloadSecurity []PayloadSecurity
+
+	// receivedPayloads holds the non-empty payloads received during the handshake
+	receivedPayloads []HandshakePayload
+
+	// peerVerified is set once VerifyPeer has approved the peer's static key
+	peerVerified bool
+
+	// writeClosed is set by CloseWrite (guarded by writeMutex)
+	writeClosed bool
+
+	// eofReceived is set when the peer's end-of-stream message arrives (guarded by readMutex)
+	eofReceived bool
+
+	// readClosed is set by CloseRead (guarded by stateMutex)
+	readClosed bool
+
+	// remoteClose is the peer's close reason, once received (guarded by readMutex)
+	remoteClose *RemoteCloseError
+
+	// handshakeDesynced is set when a handshake attempt failed after messages
+	// were exchanged, leaving this side out of step with the peer's transcript
+	handshakeDesynced bool
+
 	// localAddr is the local Noise address
 	localAddr *NoiseAddr
 
 	// remoteAddr is the remote Noise address
 	remoteAddr *NoiseAddr
 
+	// peerStatic is the peer's static public key learned or confirmed during the handshake
+	peerStatic []byte
+
+	// handshakeHash is the final handshake hash, identical on both ends of a session
+	handshakeHash []byte
+
 	// state tracks the connection lifecycle and metrics
 	state internal.ConnState
 
@@ -55,6 +118,36 @@ type NoiseConn struct {
 
 	// closeMutex protects close operations
 	closeMutex sync.Mutex
+
+	// readMutex serializes reads so the receive nonce advances in order
+	readMutex sync.Mutex
+
+	// frames reassembles inbound transport frames, keeping a partial frame
+	// across reads that time out (guarded by readMutex)
+	frames frameReader
+
+	// writeMutex serializes writes so the send nonce advances in order
+	writeMutex sync.Mutex
+
+	// pendingPlaintext holds decrypted bytes that did not fit in the caller's buffer
+	pendingPlaintext []byte
+
+	// rekey tracks automatic rekeying of the send cipher (guarded by writeMutex)
+	rekey rekeyState
+
+	// recvRekeys counts rekeys applied to the receive cipher (guarded by readMutex)
+	recvRekeys uint64
+
+	// lastSend is when the last data message was sent (guarded by writeMutex)
+	lastSend time.Time
+
+	// keepaliveDone stops the keepalive sender (guarded by closeMutex)
+	keepaliveDone chan struct{}
+
+	// readDeadline and writeDeadline are the deadlines last set by the caller
+	// (guarded by stateMutex)
+	readDeadline  time.Time
+	writeDeadline time.Time
 }
 
 // NewNoiseConn creates a new NoiseConn wrapping the underlying connection.
@@ -69,17 +162,25 @@ func NewNoiseConn(underlying net.Conn, config *ConnConfig) (*NoiseConn, error) {
 		return nil, err
 	}
 
+	// Resolution cannot fail once the handshake state has been created.
+	protocol, _ := resolveProtocol(config.Pattern, config.PresharedKey, config.PresharedKeyPlacement)
+
 	localAddr, remoteAddr := createNoiseAddresses(underlying, config)
 
 	nc := &NoiseConn{
-		underlying:     underlying,
-		config:         config,
-		handshakeState: hs,
-		localAddr:      localAddr,
-		remoteAddr:     remoteAddr,
-		logger:         log,
-		metrics:        internal.NewConnectionMetrics(),
-		state:          internal.StateInit,
+		underlying:         underlying,
+		config:             config,
+		handshakeState:     hs,
+		handshakeMsgCount:  len(protocol.Pattern.Messages),
+		handshakeInitiator: config.Initiator,
+		protocol:           protocol,
+		modifierChain:      config.GetModifierChain(),
+		payloadSecurity:    handshakePayloadSecurity(protocol),
+		localAddr:          localAddr,
+		remoteAddr:         remoteAddr,
+		logger:             log,
+		metrics:            internal.NewConnectionMetrics(),
+		state:              internal.StateInit,
 	}
 
 	nc.logger.Debug("NoiseConn created")
@@ -88,31 +189,76 @@ func NewNoiseConn(underlying net.Conn, config *ConnConfig) (*NoiseConn, error) {
 
 // Read reads data from the connection.
 // If the handshake is not complete, it will return an error.
+// Each call returns plaintext from at most one transport message; bytes that
+// do not fit in b are buffered and returned by subsequent calls.
+// Read may be called concurrently with Write; each direction has its own cipher state.
 func (nc *NoiseConn) Read(b []byte) (int, error) {
+	n, err := nc.read(b)
+	return n, internal.NetError(err)
+}
+
+// read implements Read.
+func (nc *NoiseConn) read(b []byte) (int, error) {
+	nc.readMutex.Lock()
+	defer nc.readMutex.Unlock()
+
 	if err := nc.validateReadState(); err != nil {
 		return 0, err
 	}
 
-	if err := nc.configureReadTimeout(); err != nil {
-		return 0, err
+	if nc.isReadClosed() {
+		return 0, io.EOF
 	}
 
-	encrypted, n, err := nc.readEncryptedData(b)
-	if err != nil {
-		return 0, err
+	if len(nc.pendingPlaintext) > 0 {
+		return nc.copyDecryptedData(b), nil
 	}
 
-	decrypted, err := nc.decryptData(encrypted[:n], n)
-	if err != nil {
+	if nc.eofReceived {
+		return 0, io.EOF
+	}
+
+	if nc.remoteClose != nil {
+		return 0, nc.remoteClose
+	}
+
+	if len(b) == 0 {
+		return 0, nil
+	}
+
+	if err := nc.configureReadTimeout(); err != nil {
 		return 0, err
 	}
+	limit := nc.readLimit()
+
+	// Empty data messages carry nothing for a byte stream, so keep reading
+	// until one yields plaintext for the caller.
+	for len(nc.pendingPlaintext) == 0 {
+		data, err := nc.readDataMessage(limit)
+		if err != nil {
+			return 0, err
+		}
+		nc.pendingPlaintext = data
+	}
 
-	return nc.copyDecryptedData(b, decrypted, n, len(decrypted))
+	return nc.copyDecryptedData(b), nil
 }
 
 // Write writes data to the connection.
 // If the handshake is not complete, it will return an error.
+// Payloads larger than a single Noise transport message are split into
+// multiple length-prefixed messages.
+// Write may be called concurrently with Read; each direction has its own cipher state.
 func (nc *NoiseConn) Write(b []byte) (int, error) {
+	n, err := nc.write(b)
+	return n, internal.NetError(err)
+}
+
+// write implements Write.
+func (nc *NoiseConn) write(b []byte) (int, error) {
+	nc.writeMutex.Lock()
+	defer nc.writeMutex.Unlock()
+
 	if err := nc.validateWriteState(); err != nil {
 		return 0, err
 	}
@@ -121,12 +267,89 @@ func (nc *NoiseConn) Write(b []byte) (int, error) {
 		return 0, err
 	}
 
-	encrypted, err := nc.encryptData(b)
+	// Split the payload so every ciphertext fits in a single Noise message.
+	written := 0
+	for written < len(b) {
+		chunk := b[written:min(written+maxDataLen, len(b))]
+
+		if err := nc.writeDataMessage(chunk); err != nil {
+			return written, err
+		}
+		written += len(chunk)
+	}
+
+	return written, nil
+}
+
+// readDataMessage reads transport messages until one carries application
+// data and returns that data, which may be empty. Keepalives and control
+// messages are handled along the way. The caller must hold readMutex.
+func (nc *NoiseConn) readDataMessage(limit time.Time) ([]byte, error) {
+	for {
+		peerDeadline, err := nc.armPeerTimeout(limit)
+		if err != nil {
+			return nil, err
+		}
+
+		encrypted, err := nc.readEncryptedFrame()
+		if err != nil {
+			if nc.isReadClosed() {
+				return nil, io.EOF
+			}
+			// Without message types there is no end-of-stream message, so
+			// the transport's EOF at a message boundary ends the stream.
+			if !nc.config.MessageTypes && errors.Is(err, io.EOF) {
+				nc.eofReceived = true
+				return nil, io.EOF
+			}
+			if isPeerTimeout(err, peerDeadline, limit) {
+				return nil, nc.peerTimedOut()
+			}
+			return nil, err
+		}
+
+		decrypted, err := nc.decryptData(encrypted, len(encrypted))
+		if err != nil {
+			return nil, err
+		}
+
+		data, err := nc.handleTransportMessage(decrypted)
+		if err != nil {
+			return nil, err
+		}
+		if nc.eofReceived {
+			return nil, io.EOF
+		}
+		if nc.remoteClose != nil {
+			return nil, nc.remoteClose
+		}
+		if data != nil {
+			return data, nil
+		}
+	}
+}
+
+// writeDataMessage encrypts and sends chunk as one data message, rekeying
+// first if the policy requires it. The caller must hold writeMutex.
+func (nc *NoiseConn) writeDataMessage(chunk []byte) error {
+	if err := nc.rekeyIfDue(); err != nil {
+		return err
+	}
+
+	plaintext := chunk
+	if nc.config.MessageTypes {
+		plaintext = append([]byte{msgTypeData}, chunk...)
+	}
+	encrypted, err := nc.encryptData(plaintext)
 	if err != nil {
-		return 0, err
+		return err
 	}
 
-	return nc.writeEncryptedData(b, encrypted)
+	if err := nc.writeEncryptedFrame(len(chunk), encrypted); err != nil {
+		return err
+	}
+	nc.rekey.recordSent(len(chunk))
+	return nil
 }
 
 // validateWriteState validates the connection state before writing.
@@ -136,7 +359,7 @@ func (nc *NoiseConn) validateWriteState() error {
 			Code("CONN_CLOSED").
 			In("noise").
 			With("state", nc.getState().String()).
-			Errorf("connection is closed")
+			Wrapf(ErrConnClosed, "connection is closed")
 	}
 
 	if !nc.isHandshakeDone() {
@@ -144,14 +367,21 @@ func (nc *NoiseConn) validateWriteState() error {
 			Code("HANDSHAKE_NOT_DONE").
 			In("noise").
 			With("state", nc.getState().String()).
-			Errorf("handshake not completed")
+			Wrapf(ErrHandshakeNotDone, "handshake not completed")
 	}
 
-	if nc.cipherState == nil {
+	if nc.sendCipher == nil {
 		return oops.
 			Code("NO_CIPHER_STATE").
 			In("noise").
-			Errorf("cipher state not initialized")
+			Wrapf(ErrHandshakeNotDone, "send cipher state not initialized")
+	}
+
+	if nc.writeClosed {
+		return oops.
+			Code("WRITE_CLOSED").
+			In("noise").
+			Wrapf(ErrWriteClosed, "connection is closed for writing")
 	}
 
 	return nil
@@ -171,10 +401,13 @@ func (nc *NoiseConn) configureWriteTimeout() error {
 	return nil
 }
 
-// encryptData encrypts the provided data using the cipher state.
+// encryptData encrypts the provided data using the send cipher state.
 func (nc *NoiseConn) encryptData(data []byte) ([]byte, error) {
-	encrypted, err := nc.cipherState.Encrypt(nil, nil, data)
-	// encrypted, err := nc.cipherState.Encrypt(nil, nil, data)
+	if nonce := nc.sendCipher.Nonce(); nonce >= maxTransportNonce {
+		return nil, nonceExhaustedError("send", nonce)
+	}
+
+	encrypted, err := nc.sendCipher.Encrypt(nil, nil, data)
 	if err != nil {
 		return nil, oops.
 			Code("ENCRYPT_FAILED").
@@ -185,11 +418,10 @@ func (nc *NoiseConn) encryptData(data []byte) ([]byte, error) {
 	return encrypted, nil
 }
 
-// writeEncryptedData writes encrypted data to the underlying connection and handles the response.
-func (nc *NoiseConn) writeEncryptedData(originalData, encryptedData []byte) (int, error) {
-	n, err := nc.underlying.Write(encryptedData)
-	if err != nil {
-		return 0, oops.
+// writeEncryptedFrame writes one length-prefixed transport message to the underlying connection.
+func (nc *NoiseConn) writeEncryptedFrame(plaintextLen int, encryptedData []byte) error {
+	if err := writeFrame(nc.underlying, encryptedData); err != nil {
+		return oops.
 			Code("UNDERLYING_WRITE_FAILED").
 			In("noise").
 			With("local_addr", nc.LocalAddr().String()).
@@ -199,24 +431,15 @@ func (nc *NoiseConn) writeEncryptedData(originalData, encryptedData []byte) (int
 	}
 
 	// Track metrics for written data
-	nc.metrics.AddBytesWritten(int64(len(originalData)))
+	nc.metrics.AddBytesWritten(int64(plaintextLen))
+	nc.lastSend = time.Now()
 
 	nc.logger.WithFields(logrus.Fields{
-		"plaintext_len": len(originalData),
+		"plaintext_len": plaintextLen,
 		"encrypted_len": len(encryptedData),
-		"written_len":   n,
 	}).Trace("Data written")
 
-	if n == len(encryptedData) {
-		return len(originalData), nil
-	}
-
-	return 0, oops.
-		Code("PARTIAL_WRITE").
-		In("noise").
-		With("expected", len(encryptedData)).
-		With("written", n).
-		Errorf("partial write not supported with encryption")
+	return nil
 }
 
 // Close closes the connection.
@@ -230,6 +453,7 @@ func (nc *NoiseConn) Close() error {
 
 	nc.setState(internal.StateClosed)
 	nc.logger.Debug("Closing NoiseConn")
+	nc.stopKeepalive()
 
 	// Unregister from shutdown manager if set
 	if nc.shutdownManager != nil {
@@ -270,14 +494,38 @@ func (nc *NoiseConn) SetShutdownManager(sm *ShutdownManager) {
 
 // LocalAddr returns the local network address.
 func (nc *NoiseConn) LocalAddr() net.Addr {
+	nc.stateMutex.RLock()
+	defer nc.stateMutex.RUnlock()
 	return nc.localAddr
 }
 
 // RemoteAddr returns the remote network address.
+// After the handshake it carries a fingerprint of the peer's static key, if any.
 func (nc *NoiseConn) RemoteAddr() net.Addr {
+	nc.stateMutex.RLock()
+	defer nc.stateMutex.RUnlock()
 	return nc.remoteAddr
 }
 
+// PeerStatic returns the remote peer's static public key as authenticated by
+// the handshake. It returns nil before the handshake completes or when the
+// pattern never conveys the peer's static key (for example NN).
+func (nc *NoiseConn) PeerStatic() []byte {
+	nc.stateMutex.RLock()
+	defer nc.stateMutex.RUnlock()
+	return cloneBytes(nc.peerStatic)
+}
+
+// HandshakeHash returns the final Noise handshake hash h, for use as a channel
+// binding. Both peers of a session see the same value, and it is unique to the
+// session, so signing it binds application tokens to this connection.
+// It returns nil before the handshake completes.
+func (nc *NoiseConn) HandshakeHash() []byte {
+	nc.stateMutex.RLock()
+	defer nc.stateMutex.RUnlock()
+	return cloneBytes(nc.handshakeHash)
+}
+
 // SetDeadline sets the read and write deadlines.
 func (nc *NoiseConn) SetDeadline(t time.Time) error {
 	if err := nc.underlying.SetDeadline(t); err != nil {
@@ -287,6 +535,9 @@ func (nc *NoiseConn) SetDeadline(t time.Time) error {
 			With("deadline", t).
 			Wrapf(err, "failed to set deadline on underlying connection")
 	}
+	nc.stateMutex.Lock()
+	defer nc.stateMutex.Unlock()
+	nc.readDeadline, nc.writeDeadline = t, t
 	return nil
 }
 
@@ -299,9 +550,18 @@ func (nc *NoiseConn) SetReadDeadline(t time.Time) error {
 			With("deadline", t).
 			Wrapf(err, "failed to set read deadline on underlying connection")
 	}
+	nc.setReadDeadline(t)
 	return nil
 }
 
+// setReadDeadline records the caller's read deadline so keepalive timeouts
+// never extend it.
+func (nc *NoiseConn) setReadDeadline(t time.Time) {
+	nc.stateMutex.Lock()
+	defer nc.stateMutex.Unlock()
+	nc.readDeadline = t
+}
+
 // SetWriteDeadline sets the write deadline.
 func (nc *NoiseConn) SetWriteDeadline(t time.Time) error {
 	if err := nc.underlying.SetWriteDeadline(t); err != nil {
@@ -311,11 +571,21 @@ func (nc *NoiseConn) SetWriteDeadline(t time.Time) error {
 			With("deadline", t).
 			Wrapf(err, "failed to set write deadline on underlying connection")
 	}
+	nc.stateMutex.Lock()
+	defer nc.stateMutex.Unlock()
+	nc.writeDeadline = t
 	return nil
 }
 
 // Handshake performs the Noise Protocol handshake.
 // This must be called before using Read/Write operations.
+// The handshake is bounded by ctx and HandshakeTimeout: the underlying
+// connection's deadline is set from them, and cancelling ctx interrupts a
+// blocked read or write. An interrupted handshake returns an error that
+// matches context.Canceled or context.DeadlineExceeded with errors.Is.
+// Deadlines set with SetDeadline, SetReadDeadline or SetWriteDeadline also
+// bound the handshake and are restored when Handshake returns; deadlines set
+// directly on the underlying connection cannot be read back and are cleared.
 func (nc *NoiseConn) Handshake(ctx context.Context) error {
 	nc.handshakeMutex.Lock()
 	defer nc.handshakeMutex.Unlock()
@@ -330,10 +600,10 @@ func (nc *NoiseConn) Handshake(ctx context.Context) error {
 
 	handshakeCtx := nc.createHandshakeContext(ctx)
 	defer handshakeCtx.cancel()
+	defer nc.bindHandshakeContext(handshakeCtx.ctx)()
 
 	if err := nc.executeRoleBasedHandshake(handshakeCtx.ctx); err != nil {
-		// On failure, return to init state for potential retry
-		nc.setState(internal.StateInit)
+		nc.recoverFromFailedHandshake()
 		return err
 	}
 
@@ -341,110 +611,400 @@ func (nc *NoiseConn) Handshake(ctx context.Context) error {
 	return nil
 }
 
-// performInitiatorHandshake handles the initiator side of the handshake.
-func (nc *NoiseConn) performInitiatorHandshake(ctx context.Context) error {
-	// This is a simplified implementation - real implementation would
-	// follow the specific Noise pattern message flow
+// performHandshake drives the handshake state machine, alternating between
+// writing and reading messages as dictated by the pattern until the final
+// message yields the transport cipher states.
+func (nc *NoiseConn) performHandshake(ctx context.Context) error {
+	for {
+		if err := ctx.Err(); err != nil {
+			return oops.
+				Code("HANDSHAKE_INTERRUPTED").
+				In("noise").
+				With("message_index", nc.handshakeMsgIndex).
+				Wrapf(markInterrupted(err), "handshake interrupted")
+		}
+
+		var cs1, cs2 *noise.CipherState
+		var err error
+		if nc.isHandshakeWriteTurn() {
+			cs1, cs2, err = nc.writeHandshakeMessage()
+		} else {
+			cs1, cs2, err = nc.readHandshakeMessage()
+		}
+		if err != nil {
+			if ctxErr := handshakeContextErr(ctx, err); ctxErr != nil {
+				// The I/O error is the interrupted deadline; report why.
+				return oops.
+					Code("HANDSHAKE_INTERRUPTED").
+					In("noise").
+					With("message_index", nc.handshakeMsgIndex).
+					With("io_error", err.Error()).
+					Wrapf(markInterrupted(ctxErr), "handshake interrupted")
+			}
+			return err
+		}
+
+		if cs1 != nil && cs2 != nil {
+			nc.assignCipherStates(cs1, cs2)
+			return nil
+		}
+	}
+}
 
-	// Write initial message
-	msg, cs1, cs2, err := nc.handshakeState.WriteMessage(nil, nil)
+// handshakeContextErr returns the context error behind a handshake I/O
+// error, if any. The connection deadline mirrors the context deadline and
+// can fire just before the context's own timer, so an expired connection
+// deadline counts as context.DeadlineExceeded once the context deadline passed.
+func handshakeContextErr(ctx context.Context, ioErr error) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if deadline, ok := ctx.Deadline(); ok && !time.Now().Before(deadline) && errors.Is(ioErr, os.ErrDeadlineExceeded) {
+		return context.DeadlineExceeded
+	}
+	return nil
+}
+
+// markInterrupted marks the context error of an interrupted handshake as
+// ErrHandshakeTimeout if time ran out, or ErrHandshakeFailed if cancelled.
+func markInterrupted(ctxErr error) error {
+	if errors.Is(ctxErr, context.DeadlineExceeded) {
+		return internal.Mark(ctxErr, ErrHandshakeTimeout)
+	}
+	return internal.Mark(ctxErr, ErrHandshakeFailed)
+}
+
+// isHandshakeWriteTurn reports whether the next handshake message is ours to send.
+// Noise patterns alternate direction on every message, starting with the initiator.
+func (nc *NoiseConn) isHandshakeWriteTurn() bool {
+	return (nc.handshakeMsgIndex%2 == 0) == nc.handshakeInitiator
+}
+
+// writeHandshakeMessage produces the next handshake message and sends it to the peer.
+// The cipher states are non-nil only when this was the final handshake message.
+func (nc *NoiseConn) writeHandshakeMessage() (*noise.CipherState, *noise.CipherState, error) {
+	var payload []byte
+	if nc.config.HandshakePayloadProvider != nil {
+		payload = nc.config.HandshakePayloadProvider(nc.handshakeMsgOffset + nc.handshakeMsgIndex)
+	}
+
+	msg, cs1, cs2, err := nc.handshakeState.WriteMessage(nil, payload)
 	if err != nil {
-		return oops.
+		return nil, nil, oops.
 			Code("WRITE_MESSAGE_FAILED").
 			In("noise").
+			With("message_index", nc.handshakeMsgIndex).
 			Wrapf(err, "failed to write handshake message")
 	}
 
-	if _, err := nc.underlying.Write(msg); err != nil {
-		return oops.
+	msg, err = nc.modifyOutbound(nc.addPipeMarker(msg))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if err := writeFrame(nc.underlying, msg); err != nil {
+		return nil, nil, oops.
 			Code("SEND_MESSAGE_FAILED").
 			In("noise").
+			With("message_index", nc.handshakeMsgIndex).
+			With("message_len", len(msg)).
 			Wrapf(err, "failed to send handshake message")
 	}
 
-	// Store cipher states (simplified)
-	if cs1 != nil && cs2 != nil {
-		// For initiator, typically use cs1 for sending
-		nc.cipherState = cs1
-	}
+	nc.logger.WithFields(logrus.Fields{
+		"message_index": nc.handshakeMsgIndex,
+		"message_len":   len(msg),
+	}).Trace("Handshake message sent")
 
-	return nil
+	nc.handshakeMsgIndex++
+	return cs1, cs2, nil
 }
 
-// performResponderHandshake handles the responder side of the handshake.
-func (nc *NoiseConn) performResponderHandshake(ctx context.Context) error {
-	// This is a simplified implementation - real implementation would
-	// follow the specific Noise pattern message flow
-
-	// Read initial message
-	buffer := make([]byte, 1024)
-	n, err := nc.underlying.Read(buffer)
+// readHandshakeMessage receives the next handshake message from the peer and processes it.
+// The cipher states are non-nil only when this was the final handshake message.
+func (nc *NoiseConn) readHandshakeMessage() (*noise.CipherState, *noise.CipherState, error) {
+	msg, err := readFrame(nc.underlying)
 	if err != nil {
-		return oops.
+		return nil, nil, oops.
 			Code("READ_MESSAGE_FAILED").
 			In("noise").
+			With("message_index", nc.handshakeMsgIndex).
 			Wrapf(err, "failed to read handshake message")
 	}
 
-	// Process message
-	_, cs1, cs2, err := nc.handshakeState.ReadMessage(nil, buffer[:n])
+	// The message has been consumed from the wire, so a failure from here on
+	// leaves us out of step with the peer.
+	msg, err = nc.modifyInbound(msg)
+	if err == nil {
+		msg, err = nc.acceptPipeReply(msg)
+	}
+	index := nc.handshakeMsgIndex
+	nc.handshakeMsgIndex++
+	if err != nil {
+		return nil, nil, err
+	}
+
+	payload, cs1, cs2, err := nc.handshakeState.ReadMessage(nil, msg)
 	if err != nil {
+		if nc.shouldFallback(index, msg, err) {
+			return nil, nil, nc.startFallback(true, msg)
+		}
+		return nil, nil, nc.handshakeReadError(err, index, len(msg))
+	}
+
+	if err := nc.verifyPeer(payload); err != nil {
+		return nil, nil, err
+	}
+
+	if err := nc.deliverHandshakePayload(index, payload); err != nil {
+		return nil, nil, err
+	}
+
+	nc.logger.WithFields(logrus.Fields{
+		"message_index": index,
+		"message_len":   len(msg),
+	}).Trace("Handshake message received")
+
+	return cs1, cs2, nil
+}
+
+// verifyPeer passes the peer's static key to the configured VerifyPeer
+// callback the first time a handshake message reveals it, together with that
+// message's payload. Keys configured with WithRemoteKey are not re-checked.
+func (nc *NoiseConn) verifyPeer(payload []byte) error {
+	if nc.config.VerifyPeer == nil || nc.peerVerified {
+		return nil
+	}
+
+	remoteStatic := nc.handshakeState.PeerStatic()
+	if len(remoteStatic) == 0 || bytes.Equal(remoteStatic, nc.config.RemoteKey) {
+		return nil
+	}
+
+	if err := nc.config.VerifyPeer(cloneBytes(remoteStatic), cloneBytes(payload)); err != nil {
 		return oops.
-			Code("READ_MESSAGE_FAILED").
+			Code("PEER_REJECTED").
 			In("noise").
-			Wrapf(err, "failed to process handshake message")
+			With("peer_fingerprint", keyFingerprint(remoteStatic)).
+			With("message_index", nc.handshakeMsgIndex-1).
+			Wrapf(internal.Mark(err, ErrPeerRejected), "peer static key rejected")
 	}
+	nc.peerVerified = true
+
+	nc.logger.WithFields(logrus.Fields{
+		"peer_fingerprint": keyFingerprint(remoteStatic),
+	}).Debug("Peer static key accepted")
 
-	// Store cipher states (simplified)
-	if cs1 != nil && cs2 != nil {
-		// For responder, typically use cs2 for sending
-		nc.cipherState = cs2
+	return nil
+}
+
+// deliverHandshakePayload records a received handshake payload and passes it
+// to the configured handler. Empty payloads are ignored.
+func (nc *NoiseConn) deliverHandshakePayload(index int, data []byte) error {
+	if len(data) == 0 {
+		return nil
 	}
 
+	payload := HandshakePayload{
+		MessageIndex: nc.handshakeMsgOffset + index,
+		Data:         data,
+		Security:     nc.payloadSecurity[index],
+	}
+
+	nc.stateMutex.Lock()
+	nc.receivedPayloads = append(nc.receivedPayloads, payload)
+	nc.stateMutex.Unlock()
+
+	if nc.config.HandshakePayloadHandler == nil {
+		return nil
+	}
+	if err := nc.config.HandshakePayloadHandler(payload); err != nil {
+		return oops.
+			Code("HANDSHAKE_PAYLOAD_REJECTED").
+			In("noise").
+			With("message_index", index).
+			With("payload_len", len(data)).
+			Wrapf(internal.Mark(err, ErrPeerRejected), "handshake payload rejected")
+	}
 	return nil
 }
 
-// parseHandshakePattern maps pattern name strings to go-i2p/noise HandshakePattern types.
+// HandshakePayloads returns the non-empty payloads received from the peer
+// during the handshake, in message order, with their protection level.
+func (nc *NoiseConn) HandshakePayloads() []HandshakePayload {
+	nc.stateMutex.RLock()
+	defer nc.stateMutex.RUnlock()
+
+	payloads := make([]HandshakePayload, len(nc.receivedPayloads))
+	for i, p := range nc.receivedPayloads {
+		p.Data = append([]byte(nil), p.Data...)
+		payloads[i] = p
+	}
+	return payloads
+}
+
+// handshakeReadError wraps a failure to process a received handshake message.
+// An authentication failure is reported as HANDSHAKE_AUTH_FAILED whatever its
+// cause: a wrong static key or PSK, tampering, or a differing prologue all
+// look the same to the receiver. With a prologue configured the message names
+// it as one possible cause.
+func (nc *NoiseConn) handshakeReadError(err error, index, msgLen int) error {
+	if isAuthenticationFailure(err) {
+		msg := "handshake message failed authentication"
+		if len(nc.config.Prologue) > 0 {
+			msg += " (keys, PSK or prologue may differ from the peer's)"
+		}
+		return oops.
+			Code("HANDSHAKE_AUTH_FAILED").
+			In("noise").
+			With("message_index", index).
+			With("message_len", msgLen).
+			With("prologue_len", len(nc.config.Prologue)).
+			Wrapf(internal.Mark(err, ErrAuthFailed), "%s", msg)
+	}
+	return oops.
+		Code("READ_MESSAGE_FAILED").
+		In("noise").
+		With("message_index", index).
+		With("message_len", msgLen).
+		Wrapf(markHandshakeReadError(err), "failed to process handshake message")
+}
+
+// aeadOpenErrors holds the errors the supported ciphers return when a tag
+// does not verify. The cipher packages do not export them, so they are
+// captured once by opening an invalid ciphertext with each cipher.
+var aeadOpenErrors = func() []error {
+	var errs []error
+	for _, cf := range cipherFuncs {
+		_, err := cf.Cipher([32]byte{}).Decrypt(nil, 0, nil, make([]byte, cipherTagLen))
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errs
+}()
+
+// isAuthenticationFailure reports whether err is an AEAD tag verification failure.
+func isAuthenticationFailure(err error) bool {
+	for _, openErr := range aeadOpenErrors {
+		if errors.Is(err, openErr) {
+			return true
+		}
+	}
+	return false
+}
+
+// markHandshakeReadError marks a failure to process a handshake message as
+// ErrAuthFailed or, for a malformed message, ErrProtocolViolation.
+func markHandshakeReadError(err error) error {
+	if isAuthenticationFailure(err) {
+		return internal.Mark(err, ErrAuthFailed)
+	}
+	return internal.Mark(err, ErrProtocolViolation)
+}
+
+// modifyOutbound passes an outbound handshake message through the configured modifier chain.
+func (nc *NoiseConn) modifyOutbound(msg []byte) ([]byte, error) {
+	if nc.modifierChain == nil {
+		return msg, nil
+	}
+
+	phase := handshakePhase(nc.handshakeMsgIndex, nc.handshakeMsgCount)
+	modified, err := nc.modifierChain.ModifyOutbound(phase, msg)
+	if err != nil {
+		return nil, oops.
+			Code("MODIFY_OUTBOUND_FAILED").
+			In("noise").
+			With("message_index", nc.handshakeMsgIndex).
+			With("phase", phase.String()).
+			Wrapf(err, "failed to apply outbound handshake modifiers")
+	}
+	return modified, nil
+}
+
+// modifyInbound reverses the configured modifier chain on an inbound handshake message.
+func (nc *NoiseConn) modifyInbound(msg []byte) ([]byte, error) {
+	if nc.modifierChain == nil {
+		return msg, nil
+	}
+
+	phase := handshakePhase(nc.handshakeMsgIndex, nc.handshakeMsgCount)
+	modified, err := nc.modifierChain.ModifyInbound(phase, msg)
+	if err != nil {
+		return nil, oops.
+			Code("MODIFY_INBOUND_FAILED").
+			In("noise").
+			With("message_index", nc.handshakeMsgIndex).
+			With("phase", phase.String()).
+			Wrapf(err, "failed to apply inbound handshake modifiers")
+	}
+	return modified, nil
+}
+
+// handshakePhase maps a handshake message index onto the modifier phase.
+// The first message is always initial, the last message of a multi-message
+// pattern is final, and anything in between is part of the exchange.
+func handshakePhase(index, total int) handshake.HandshakePhase {
+	switch {
+	case index == 0:
+		return handshake.PhaseInitial
+	case index >= total-1:
+		return handshake.PhaseFinal
+	default:
+		return handshake.PhaseExchange
+	}
+}
+
+// assignCipherStates stores the transport cipher states for this side of the connection.
+// cs1 encrypts initiator-to-responder traffic and cs2 responder-to-initiator traffic,
+// so the initiator sends with cs1 while the responder sends with cs2. The Noise
+// role is used, which after a Noise Pipes fallback is the reverse of config.Initiator.
+func (nc *NoiseConn) assignCipherStates(cs1, cs2 *noise.CipherState) {
+	if nc.handshakeInitiator {
+		nc.sendCipher, nc.recvCipher = cs1, cs2
+	} else {
+		nc.sendCipher, nc.recvCipher = cs2, cs1
+	}
+	nc.rekey.reset()
+}
+
+// recoverFromFailedHandshake prepares the connection for another handshake attempt.
+// A fresh handshake state is created because the failed one may have advanced
+// part-way through the pattern. If messages were already exchanged, the peer's
+// transcript no longer matches ours and the connection is flagged as desynced.
+func (nc *NoiseConn) recoverFromFailedHandshake() {
+	if nc.handshakeMsgIndex > 0 || nc.handshakePath == PathFallback {
+		nc.handshakeDesynced = true
+	}
+	nc.handshakeMsgIndex = 0
+	nc.handshakeMsgOffset = 0
+	nc.handshakeInitiator = nc.config.Initiator
+	nc.peerVerified = false
+	nc.handshakeMsgCount = len(nc.protocol.Pattern.Messages)
+	nc.payloadSecurity = handshakePayloadSecurity(nc.protocol)
+
+	nc.stateMutex.Lock()
+	nc.receivedPayloads = nil
+	nc.handshakePath = PathDirect
+	nc.localAddr, nc.remoteAddr = createNoiseAddresses(nc.underlying, nc.config)
+	nc.stateMutex.Unlock()
+
+	if hs, err := createHandshakeState(nc.config); err == nil {
+		nc.handshakeState = hs
+	}
+
+	// Return to init state so retry logic can decide whether to try again
+	nc.setState(internal.StateInit)
+}
+
+// parseHandshakePattern maps a pattern or full protocol name to a go-i2p/noise HandshakePattern.
 // This enables configurable pattern selection from string-based configuration.
 func parseHandshakePattern(patternName string) (noise.HandshakePattern, error) {
-	switch patternName {
-	case "Noise_NN_25519_AESGCM_SHA256", "NN":
-		return noise.HandshakeNN, nil
-	case "Noise_NK_25519_AESGCM_SHA256", "NK":
-		return noise.HandshakeNK, nil
-	case "Noise_NX_25519_AESGCM_SHA256", "NX":
-		return noise.HandshakeNX, nil
-	case "Noise_XN_25519_AESGCM_SHA256", "XN":
-		return noise.HandshakeXN, nil
-	case "Noise_XK_25519_AESGCM_SHA256", "XK":
-		return noise.HandshakeXK, nil
-	case "Noise_XX_25519_AESGCM_SHA256", "XX":
-		return noise.HandshakeXX, nil
-	case "Noise_KN_25519_AESGCM_SHA256", "KN":
-		return noise.HandshakeKN, nil
-	case "Noise_KK_25519_AESGCM_SHA256", "KK":
-		return noise.HandshakeKK, nil
-	case "Noise_KX_25519_AESGCM_SHA256", "KX":
-		return noise.HandshakeKX, nil
-	case "Noise_IN_25519_AESGCM_SHA256", "IN":
-		return noise.HandshakeIN, nil
-	case "Noise_IK_25519_AESGCM_SHA256", "IK":
-		return noise.HandshakeIK, nil
-	case "Noise_IX_25519_AESGCM_SHA256", "IX":
-		return noise.HandshakeIX, nil
-	case "Noise_N_25519_AESGCM_SHA256", "N":
-		return noise.HandshakeN, nil
-	case "Noise_K_25519_AESGCM_SHA256", "K":
-		return noise.HandshakeK, nil
-	case "Noise_X_25519_AESGCM_SHA256", "X":
-		return noise.HandshakeX, nil
-	default:
-		return noise.HandshakePattern{}, oops.
-			Code("UNSUPPORTED_PATTERN").
-			In("noise").
-			With("pattern", patternName).
-			Errorf("unsupported handshake pattern: %s", patternName)
+	p, err := parseProtocolName(patternName)
+	if err != nil {
+		return noise.HandshakePattern{}, err
 	}
+	return p.Pattern, nil
 }
 
 // validateReadState validates the connection state before reading.
@@ -454,7 +1014,7 @@ func (nc *NoiseConn) validateReadState() error {
 			Code("CONN_CLOSED").
 			In("noise").
 			With("state", nc.getState().String()).
-			Errorf("connection is closed")
+			Wrapf(ErrConnClosed, "connection is closed")
 	}
 
 	if !nc.isHandshakeDone() {
@@ -462,15 +1022,15 @@ func (nc *NoiseConn) validateReadState() error {
 			Code("HANDSHAKE_NOT_DONE").
 			In("noise").
 			With("state", nc.getState().String()).
-			Errorf("handshake not completed")
+			Wrapf(ErrHandshakeNotDone, "handshake not completed")
 	}
 
-	if nc.cipherState == nil {
+	if nc.recvCipher == nil {
 		return oops.
 			Code("NO_CIPHER_STATE").
 			In("noise").
 			With("state", nc.getState().String()).
-			Errorf("cipher state not initialized")
+			Wrapf(ErrHandshakeNotDone, "receive cipher state not initialized")
 	}
 
 	return nil
@@ -490,48 +1050,54 @@ func (nc *NoiseConn) configureReadTimeout() error {
 	return nil
 }
 
-// readEncryptedData reads encrypted data from the underlying connection.
-func (nc *NoiseConn) readEncryptedData(b []byte) ([]byte, int, error) {
-	encrypted := make([]byte, len(b)+16) // Additional space for auth tag
-	n, err := nc.underlying.Read(encrypted)
+// readEncryptedFrame reads one complete length-prefixed transport message
+// from the underlying connection, however the stream happens to be segmented.
+// A frame interrupted by a deadline is resumed by the next call.
+func (nc *NoiseConn) readEncryptedFrame() ([]byte, error) {
+	encrypted, err := nc.frames.readFrame(nc.underlying)
 	if err != nil {
-		return nil, 0, oops.
+		return nil, oops.
 			Code("UNDERLYING_READ_FAILED").
 			In("noise").
 			With("local_addr", nc.LocalAddr().String()).
 			With("remote_addr", nc.RemoteAddr().String()).
 			Wrapf(err, "underlying connection read failed")
 	}
-	return encrypted, n, nil
+	return encrypted, nil
 }
 
-// decryptData decrypts the provided encrypted data.
+// decryptData decrypts the provided encrypted data using the receive cipher state.
 func (nc *NoiseConn) decryptData(encrypted []byte, encryptedLen int) ([]byte, error) {
-	decrypted, err := nc.cipherState.Decrypt(nil, nil, encrypted)
+	if nonce := nc.recvCipher.Nonce(); nonce >= maxTransportNonce {
+		return nil, nonceExhaustedError("receive", nonce)
+	}
+
+	decrypted, err := nc.recvCipher.Decrypt(nil, nil, encrypted)
 	if err != nil {
 		return nil, oops.
 			Code("DECRYPT_FAILED").
 			In("noise").
 			With("encrypted_len", encryptedLen).
-			Wrapf(err, "failed to decrypt received data")
+			Wrapf(internal.Mark(err, ErrAuthFailed), "failed to decrypt received data")
 	}
 	return decrypted, nil
 }
 
-// copyDecryptedData copies decrypted data to the user buffer and logs the operation.
-func (nc *NoiseConn) copyDecryptedData(b, decrypted []byte, encryptedLen, decryptedLen int) (int, error) {
-	copied := copy(b, decrypted)
+// copyDecryptedData copies buffered plaintext to the user buffer and logs the operation.
+// Bytes that do not fit remain buffered for the next Read.
+func (nc *NoiseConn) copyDecryptedData(b []byte) int {
+	copied := copy(b, nc.pendingPlaintext)
+	nc.pendingPlaintext = nc.pendingPlaintext[copied:]
 
 	// Track metrics for read data
 	nc.metrics.AddBytesRead(int64(copied))
 
 	nc.logger.Trace("Data read", logrus.Fields{
-		"encrypted_len": encryptedLen,
-		"decrypted_len": decryptedLen,
 		"copied_len":    copied,
+		"remaining_len": len(nc.pendingPlaintext),
 	})
 
-	return copied, nil
+	return copied
 }
 
 // validateNewConnParams validates the parameters for creating a new NoiseConn.
@@ -540,21 +1106,21 @@ func validateNewConnParams(underlying net.Conn, config *ConnConfig) error {
 		return oops.
 			Code("INVALID_CONN").
 			In("noise").
-			Errorf("underlying connection cannot be nil")
+			Wrapf(ErrInvalidConfig, "underlying connection cannot be nil")
 	}
 
 	if config == nil {
 		return oops.
 			Code("INVALID_CONFIG").
 			In("noise").
-			Errorf("config cannot be nil")
+			Wrapf(ErrInvalidConfig, "config cannot be nil")
 	}
 
 	if err := config.Validate(); err != nil {
 		return oops.
 			Code("INVALID_CONFIG").
 			In("noise").
-			Wrapf(err, "config validation failed")
+			Wrapf(internal.Mark(err, ErrInvalidConfig), "config validation failed")
 	}
 
 	return nil
@@ -562,26 +1128,31 @@ func validateNewConnParams(underlying net.Conn, config *ConnConfig) error {
 
 // createHandshakeState creates and initializes the Noise handshake state.
 func createHandshakeState(config *ConnConfig) (*noise.HandshakeState, error) {
-	cs := noise.NewCipherSuite(noise.DH25519, noise.CipherAESGCM, noise.HashSHA256)
-
-	pattern, err := parseHandshakePattern(config.Pattern)
+	protocol, err := resolveProtocol(config.Pattern, config.PresharedKey, config.PresharedKeyPlacement)
 	if err != nil {
 		return nil, oops.
 			Code("INVALID_PATTERN").
 			In("noise").
 			With("pattern", config.Pattern).
-			Wrapf(err, "invalid handshake pattern")
+			Wrapf(internal.Mark(err, ErrInvalidConfig), "invalid handshake pattern")
+	}
+
+	staticKeypair, err := createStaticKeypair(config.StaticKey)
+	if err != nil {
+		return nil, err
 	}
 
 	hs, err := noise.NewHandshakeState(noise.Config{
-		CipherSuite: cs,
-		Random:      nil, // Use crypto/rand
-		Pattern:     pattern,
-		Initiator:   config.Initiator,
-		StaticKeypair: noise.DHKey{
-			Private: config.StaticKey,
-			Public:  nil, // Will be computed
-		},
+		CipherSuite:   protocol.CipherSuite,
+		Random:        config.handshakeRandom(),
+		Pattern:       protocol.Pattern,
+		Initiator:     config.Initiator,
+		StaticKeypair: staticKeypair,
+		PeerStatic:    config.RemoteKey,
+
+		Prologue:              config.Prologue,
+		PresharedKey:          config.PresharedKey,
+		PresharedKeyPlacement: config.PresharedKeyPlacement,
 	})
 	if err != nil {
 		return nil, oops.
@@ -589,12 +1160,35 @@ func createHandshakeState(config *ConnConfig) (*noise.HandshakeState, error) {
 			In("noise").
 			With("pattern", config.Pattern).
 			With("initiator", config.Initiator).
-			Wrapf(err, "failed to create handshake state")
+			Wrapf(internal.Mark(err, ErrHandshakeFailed), "failed to create handshake state")
 	}
 
 	return hs, nil
 }
 
+// createStaticKeypair builds the local static keypair from a Curve25519 private key,
+// deriving the public half so patterns that transmit "s" can send it.
+// An empty key yields an empty keypair for patterns without a local static key.
+func createStaticKeypair(privateKey []byte) (noise.DHKey, error) {
+	if len(privateKey) == 0 {
+		return noise.DHKey{}, nil
+	}
+
+	publicKey, err := internal.X25519PublicKey(privateKey)
+	if err != nil {
+		return noise.DHKey{}, oops.
+			Code("INVALID_STATIC_KEY").
+			In("noise").
+			With("key_length", len(privateKey)).
+			Wrapf(internal.Mark(err, ErrInvalidConfig), "failed to derive static public key")
+	}
+
+	return noise.DHKey{
+		Private: privateKey,
+		Public:  publicKey,
+	}, nil
+}
+
 // createNoiseAddresses creates local and remote Noise addresses.
 func createNoiseAddresses(underlying net.Conn, config *ConnConfig) (*NoiseAddr, *NoiseAddr) {
 	role := "responder"
@@ -602,13 +1196,17 @@ func createNoiseAddresses(underlying net.Conn, config *ConnConfig) (*NoiseAddr,
 		role = "initiator"
 	}
 
-	localAddr := NewNoiseAddr(underlying.LocalAddr(), config.Pattern, role)
+	name := protocolName(config.Pattern, config.PresharedKey, config.PresharedKeyPlacement)
+	localAddr := NewNoiseAddr(underlying.LocalAddr(), name, role)
 
 	remoteRole := "initiator"
 	if config.Initiator {
 		remoteRole = "responder"
 	}
-	remoteAddr := NewNoiseAddr(underlying.RemoteAddr(), config.Pattern, remoteRole)
+	remoteAddr := NewNoiseAddr(underlying.RemoteAddr(), name, remoteRole)
+	if len(config.RemoteKey) > 0 {
+		remoteAddr = remoteAddr.withPeerStatic(config.RemoteKey)
+	}
 
 	return localAddr, remoteAddr
 }
@@ -628,31 +1226,105 @@ func (nc *NoiseConn) createHandshakeContext(ctx context.Context) *handshakeConte
 	}
 }
 
+// bindHandshakeContext ties the underlying connection to ctx for the duration
+// of a handshake: its deadlines become the earlier of ctx's deadline and the
+// caller's, and cancelling ctx moves them into the past so a blocked read or
+// write returns at once. The returned function undoes the binding and
+// restores the caller's deadlines. Connections that do not support deadlines
+// are left to the ctx checks between messages.
+func (nc *NoiseConn) bindHandshakeContext(ctx context.Context) func() {
+	nc.stateMutex.RLock()
+	readDeadline, writeDeadline := nc.readDeadline, nc.writeDeadline
+	nc.stateMutex.RUnlock()
+
+	if deadline, ok := ctx.Deadline(); ok {
+		nc.setHandshakeDeadlines(earliestDeadline(deadline, readDeadline), earliestDeadline(deadline, writeDeadline))
+	}
+
+	var mu sync.Mutex
+	released := false
+	stop := context.AfterFunc(ctx, func() {
+		mu.Lock()
+		defer mu.Unlock()
+		if !released {
+			nc.setHandshakeDeadlines(time.Unix(1, 0), time.Unix(1, 0))
+		}
+	})
+
+	return func() {
+		stop()
+		mu.Lock()
+		released = true
+		mu.Unlock()
+		nc.setHandshakeDeadlines(readDeadline, writeDeadline)
+	}
+}
+
+// setHandshakeDeadlines sets the underlying deadlines, logging rather than
+// failing when the connection does not support deadlines.
+func (nc *NoiseConn) setHandshakeDeadlines(readDeadline, writeDeadline time.Time) {
+	err := nc.underlying.SetReadDeadline(readDeadline)
+	if err == nil {
+		err = nc.underlying.SetWriteDeadline(writeDeadline)
+	}
+	if err != nil {
+		nc.logger.WithFields(logrus.Fields{
+			"read_deadline":  readDeadline,
+			"write_deadline": writeDeadline,
+			"error":          err.Error(),
+		}).Debug("Underlying connection does not accept a handshake deadline")
+	}
+}
+
+// earliestDeadline returns the earlier of two deadlines, where the zero time
+// means no deadline.
+func earliestDeadline(a, b time.Time) time.Time {
+	if a.IsZero() || !b.IsZero() && b.Before(a) {
+		return b
+	}
+	return a
+}
+
 // executeRoleBasedHandshake performs handshake based on initiator/responder role.
 func (nc *NoiseConn) executeRoleBasedHandshake(ctx context.Context) error {
-	if nc.config.Initiator {
-		if err := nc.performInitiatorHandshake(ctx); err != nil {
+	if err := nc.performHandshake(ctx); err != nil {
+		if nc.config.Initiator {
 			return oops.
 				Code("INITIATOR_HANDSHAKE_FAILED").
 				In("noise").
-				Wrapf(err, "initiator handshake failed")
-		}
-	} else {
-		if err := nc.performResponderHandshake(ctx); err != nil {
-			return oops.
-				Code("RESPONDER_HANDSHAKE_FAILED").
-				In("noise").
-				Wrapf(err, "responder handshake failed")
+				Wrapf(internal.Mark(err, ErrHandshakeFailed), "initiator handshake failed")
 		}
+		return oops.
+			Code("RESPONDER_HANDSHAKE_FAILED").
+			In("noise").
+			Wrapf(internal.Mark(err, ErrHandshakeFailed), "responder handshake failed")
 	}
 	return nil
 }
 
 // markHandshakeComplete sets the handshake completion state and logs success.
 func (nc *NoiseConn) markHandshakeComplete() {
+	nc.recordHandshakeResults()
 	nc.setState(internal.StateEstablished)
 	nc.metrics.SetHandshakeEnd()
 	nc.logger.Info("Noise handshake completed successfully")
+	nc.startKeepalive()
+}
+
+// recordHandshakeResults captures the handshake hash and the peer's static
+// key from the finished handshake, attaching the key to the remote address.
+func (nc *NoiseConn) recordHandshakeResults() {
+	hash := nc.handshakeState.ChannelBinding()
+	key := nc.handshakeState.PeerStatic()
+
+	nc.stateMutex.Lock()
+	defer nc.stateMutex.Unlock()
+	nc.handshakeHash = cloneBytes(hash)
+	if len(key) == 0 {
+		return
+	}
+	nc.peerStatic = cloneBytes(key)
+	nc.remoteAddr = nc.remoteAddr.withPeerStatic(key)
 }
 
 // isClosed returns true if the connection is closed
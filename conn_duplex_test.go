@@ -0,0 +1,96 @@
+package noise
+
+import (
+	"bytes"
+	"encoding/binary"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCipherStatesAreAssignedPerDirection(t *testing.T) {
+	initiator, responder := establishPair(t,
+		NewConnConfig("NN", true).WithHandshakeTimeout(5*time.Second),
+		NewConnConfig("NN", false).WithHandshakeTimeout(5*time.Second))
+
+	assert.NotSame(t, initiator.sendCipher, initiator.recvCipher)
+	assert.NotSame(t, responder.sendCipher, responder.recvCipher)
+
+	// Initiator-to-responder direction
+	ciphertext, err := initiator.sendCipher.Encrypt(nil, nil, []byte("ping"))
+	require.NoError(t, err)
+	plaintext, err := responder.recvCipher.Decrypt(nil, nil, ciphertext)
+	require.NoError(t, err)
+	assert.Equal(t, []byte("ping"), plaintext)
+
+	// Responder-to-initiator direction
+	ciphertext, err = responder.sendCipher.Encrypt(nil, nil, []byte("pong"))
+	require.NoError(t, err)
+	plaintext, err = initiator.recvCipher.Decrypt(nil, nil, ciphertext)
+	require.NoError(t, err)
+	assert.Equal(t, []byte("pong"), plaintext)
+}
+
+func TestFullDuplexTrafficOverPipe(t *testing.T) {
+	initiator, responder := establishPair(t,
+		NewConnConfig("XX", true).WithStaticKey(newTestStaticKey(t)).WithHandshakeTimeout(5*time.Second),
+		NewConnConfig("XX", false).WithStaticKey(newTestStaticKey(t)).WithHandshakeTimeout(5*time.Second))
+
+	const messages = 100
+	const messageLen = 64
+
+	// makeMessage builds a message tagged with its sender and sequence number.
+	makeMessage := func(sender byte, seq int) []byte {
+		msg := bytes.Repeat([]byte{sender}, messageLen)
+		binary.BigEndian.PutUint32(msg[1:], uint32(seq))
+		return msg
+	}
+
+	errs := make(chan error, 4)
+	var wg sync.WaitGroup
+
+	writer := func(conn *NoiseConn, sender byte) {
+		defer wg.Done()
+		for i := 0; i < messages; i++ {
+			if _, err := conn.Write(makeMessage(sender, i)); err != nil {
+				errs <- err
+				return
+			}
+		}
+	}
+
+	reader := func(conn *NoiseConn, sender byte) {
+		defer wg.Done()
+		buf := make([]byte, messageLen)
+		for i := 0; i < messages; i++ {
+			n, err := conn.Read(buf)
+			if err != nil {
+				errs <- err
+				return
+			}
+			if !bytes.Equal(makeMessage(sender, i), buf[:n]) {
+				t.Errorf("message %d from %q arrived corrupted", i, sender)
+				return
+			}
+		}
+	}
+
+	wg.Add(4)
+	go writer(initiator, 'i')
+	go writer(responder, 'r')
+	go reader(responder, 'i')
+	go reader(initiator, 'r')
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		t.Errorf("full-duplex traffic failed: %v", err)
+	}
+
+	bytesRead, bytesWritten, _ := initiator.GetConnectionMetrics()
+	assert.Equal(t, int64(messages*messageLen), bytesRead)
+	assert.Equal(t, int64(messages*messageLen), bytesWritten)
+}
@@ -0,0 +1,168 @@
+package noise
+
+import (
+	"context"
+	"crypto/rand"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-i2p/go-noise/internal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newTestStaticKey returns a random Curve25519 private key for tests.
+func newTestStaticKey(t *testing.T) []byte {
+	t.Helper()
+	key := make([]byte, 32)
+	_, err := rand.Read(key)
+	require.NoError(t, err)
+	return key
+}
+
+// runHandshakePair wraps both ends of a net.Pipe in NoiseConns and runs
+// their handshakes concurrently, returning the handshake errors.
+func runHandshakePair(t *testing.T, initiatorConfig, responderConfig *ConnConfig) (*NoiseConn, *NoiseConn, error, error) {
+	t.Helper()
+
+	initiatorConn, responderConn := net.Pipe()
+	t.Cleanup(func() {
+		initiatorConn.Close()
+		responderConn.Close()
+	})
+
+	initiator, err := NewNoiseConn(initiatorConn, initiatorConfig)
+	require.NoError(t, err)
+	responder, err := NewNoiseConn(responderConn, responderConfig)
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var wg sync.WaitGroup
+	var initiatorErr, responderErr error
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		initiatorErr = initiator.Handshake(ctx)
+		if initiatorErr != nil {
+			initiatorConn.Close()
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		responderErr = responder.Handshake(ctx)
+		if responderErr != nil {
+			responderConn.Close()
+		}
+	}()
+	wg.Wait()
+
+	return initiator, responder, initiatorErr, responderErr
+}
+
+// establishPair runs a handshake between two NoiseConns and requires it to succeed.
+func establishPair(t *testing.T, initiatorConfig, responderConfig *ConnConfig) (*NoiseConn, *NoiseConn) {
+	t.Helper()
+	initiator, responder, initiatorErr, responderErr := runHandshakePair(t, initiatorConfig, responderConfig)
+	require.NoError(t, initiatorErr, "initiator handshake should succeed")
+	require.NoError(t, responderErr, "responder handshake should succeed")
+	return initiator, responder
+}
+
+func TestHandshakeCompletesInteractivePatterns(t *testing.T) {
+	tests := []struct {
+		pattern          string
+		initiatorStatic  bool
+		responderStatic  bool
+		expectedMessages int
+	}{
+		{"NN", false, false, 2},
+		{"NX", false, true, 2},
+		{"XN", true, false, 3},
+		{"XX", true, true, 3},
+		{"IN", true, false, 2},
+		{"IX", true, true, 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.pattern, func(t *testing.T) {
+			initiatorConfig := NewConnConfig(tt.pattern, true).WithHandshakeTimeout(5 * time.Second)
+			responderConfig := NewConnConfig(tt.pattern, false).WithHandshakeTimeout(5 * time.Second)
+			if tt.initiatorStatic {
+				initiatorConfig.WithStaticKey(newTestStaticKey(t))
+			}
+			if tt.responderStatic {
+				responderConfig.WithStaticKey(newTestStaticKey(t))
+			}
+
+			initiator, responder := establishPair(t, initiatorConfig, responderConfig)
+
+			assert.Equal(t, internal.StateEstablished, initiator.GetConnectionState())
+			assert.Equal(t, internal.StateEstablished, responder.GetConnectionState())
+			assert.Equal(t, tt.expectedMessages, initiator.handshakeMsgIndex)
+			assert.Equal(t, tt.expectedMessages, responder.handshakeMsgIndex)
+			assert.NotNil(t, initiator.sendCipher)
+			assert.NotNil(t, responder.recvCipher)
+		})
+	}
+}
+
+func TestHandshakeRequiresStaticKeyForPattern(t *testing.T) {
+	initiatorConfig := NewConnConfig("XX", true).WithHandshakeTimeout(time.Second)
+	responderConfig := NewConnConfig("XX", false).WithHandshakeTimeout(time.Second)
+
+	initiator, responder, initiatorErr, responderErr := runHandshakePair(t, initiatorConfig, responderConfig)
+
+	assert.Error(t, responderErr, "responder without static key cannot send s")
+	assert.Error(t, initiatorErr)
+	assert.Equal(t, internal.StateInit, initiator.GetConnectionState())
+	assert.Equal(t, internal.StateInit, responder.GetConnectionState())
+}
+
+func TestHandshakeFailureAfterProgressIsNotRetried(t *testing.T) {
+	initiatorConn, peerConn := net.Pipe()
+	defer initiatorConn.Close()
+
+	config := NewConnConfig("XX", true).
+		WithStaticKey(newTestStaticKey(t)).
+		WithHandshakeTimeout(time.Second).
+		WithHandshakeRetries(3).
+		WithRetryBackoff(0)
+
+	initiator, err := NewNoiseConn(initiatorConn, config)
+	require.NoError(t, err)
+
+	// The peer consumes the first handshake message and then hangs up.
+	go func() {
+		_, _ = readFrame(peerConn)
+		peerConn.Close()
+	}()
+
+	err = initiator.HandshakeWithRetry(context.Background())
+	require.Error(t, err)
+
+	assert.True(t, initiator.handshakeDesynced)
+	assert.Equal(t, internal.StateInit, initiator.GetConnectionState())
+	assert.False(t, initiator.shouldRetry(0, 3, err))
+}
+
+func TestHandshakeFailureBeforeProgressIsRetriable(t *testing.T) {
+	localAddr := &mockNetAddr{network: "tcp", address: "127.0.0.1:8001"}
+	remoteAddr := &mockNetAddr{network: "tcp", address: "127.0.0.1:8002"}
+	mockConn := newMockNetConn(localAddr, remoteAddr)
+	mockConn.writeErr = net.ErrClosed
+
+	config := NewConnConfig("NN", true).WithHandshakeTimeout(time.Second)
+	conn, err := NewNoiseConn(mockConn, config)
+	require.NoError(t, err)
+
+	err = conn.Handshake(context.Background())
+	require.Error(t, err)
+
+	assert.False(t, conn.handshakeDesynced)
+	assert.Equal(t, 0, conn.handshakeMsgIndex)
+	assert.True(t, conn.shouldRetry(0, 3, err))
+}
@@ -0,0 +1,168 @@
+package noise
+
+import (
+	"bytes"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-i2p/go-noise/handshake"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// tapConn records every byte written to the wrapped connection.
+type tapConn struct {
+	net.Conn
+	mu      sync.Mutex
+	written bytes.Buffer
+}
+
+func (tc *tapConn) Write(b []byte) (int, error) {
+	tc.mu.Lock()
+	tc.written.Write(b)
+	tc.mu.Unlock()
+	return tc.Conn.Write(b)
+}
+
+func (tc *tapConn) frames(t *testing.T) [][]byte {
+	t.Helper()
+	tc.mu.Lock()
+	defer tc.mu.Unlock()
+
+	r := bytes.NewReader(tc.written.Bytes())
+	var frames [][]byte
+	for r.Len() > 0 {
+		frame, err := readFrame(r)
+		require.NoError(t, err)
+		frames = append(frames, frame)
+	}
+	return frames
+}
+
+// phaseRecorder is a pass-through modifier that records the phases it sees.
+type phaseRecorder struct {
+	mu       sync.Mutex
+	outbound []handshake.HandshakePhase
+	inbound  []handshake.HandshakePhase
+}
+
+func (pr *phaseRecorder) ModifyOutbound(phase handshake.HandshakePhase, data []byte) ([]byte, error) {
+	pr.mu.Lock()
+	defer pr.mu.Unlock()
+	pr.outbound = append(pr.outbound, phase)
+	return data, nil
+}
+
+func (pr *phaseRecorder) ModifyInbound(phase handshake.HandshakePhase, data []byte) ([]byte, error) {
+	pr.mu.Lock()
+	defer pr.mu.Unlock()
+	pr.inbound = append(pr.inbound, phase)
+	return data, nil
+}
+
+func (pr *phaseRecorder) Name() string {
+	return "phase-recorder"
+}
+
+func newXXModifierConfigs(t *testing.T, initiatorMods, responderMods []handshake.HandshakeModifier) (*ConnConfig, *ConnConfig) {
+	t.Helper()
+	initiatorConfig := NewConnConfig("XX", true).
+		WithStaticKey(newTestStaticKey(t)).
+		WithHandshakeTimeout(5 * time.Second).
+		WithModifiers(initiatorMods...)
+	responderConfig := NewConnConfig("XX", false).
+		WithStaticKey(newTestStaticKey(t)).
+		WithHandshakeTimeout(5 * time.Second).
+		WithModifiers(responderMods...)
+	return initiatorConfig, responderConfig
+}
+
+func TestModifiersTransformHandshakeOnWire(t *testing.T) {
+	xor := handshake.NewXORModifier("xor", []byte{0x5A, 0xC3, 0x17})
+	padding, err := handshake.NewPaddingModifier("padding", 8, 24)
+	require.NoError(t, err)
+	mods := []handshake.HandshakeModifier{xor, padding}
+
+	initiatorConfig, responderConfig := newXXModifierConfigs(t, mods, mods)
+
+	initiatorPipe, responderPipe := net.Pipe()
+	defer initiatorPipe.Close()
+	defer responderPipe.Close()
+	tap := &tapConn{Conn: initiatorPipe}
+
+	initiator, err := NewNoiseConn(tap, initiatorConfig)
+	require.NoError(t, err)
+	responder, err := NewNoiseConn(responderPipe, responderConfig)
+	require.NoError(t, err)
+
+	responderDone := make(chan error, 1)
+	go func() {
+		responderDone <- responder.Handshake(t.Context())
+	}()
+	require.NoError(t, initiator.Handshake(t.Context()))
+	require.NoError(t, <-responderDone)
+
+	// The initiator sends XX messages 1 and 3: "e" (32 bytes) and the
+	// encrypted "s" plus an empty encrypted payload (32+16+16 bytes).
+	frames := tap.frames(t)
+	require.Len(t, frames, 2)
+
+	chain := initiatorConfig.GetModifierChain()
+	expected := []struct {
+		phase    handshake.HandshakePhase
+		noiseLen int
+	}{
+		{handshake.PhaseInitial, 32},
+		{handshake.PhaseFinal, 64},
+	}
+	for i, frame := range frames {
+		original, err := chain.ModifyInbound(expected[i].phase, frame)
+		require.NoError(t, err)
+		assert.Len(t, original, expected[i].noiseLen, "message %d should unwrap to the Noise message", i)
+		assert.NotEqual(t, len(original), len(frame), "message %d should be padded on the wire", i)
+		assert.False(t, bytes.Contains(frame, original), "message %d should not appear in the clear", i)
+	}
+
+	// Transport traffic still flows after the modified handshake.
+	go func() {
+		_, _ = initiator.Write([]byte("after modifiers"))
+	}()
+	buf := make([]byte, 64)
+	n, err := responder.Read(buf)
+	require.NoError(t, err)
+	assert.Equal(t, "after modifiers", string(buf[:n]))
+}
+
+func TestModifierMismatchBreaksHandshake(t *testing.T) {
+	xor := handshake.NewXORModifier("xor", []byte{0xFF})
+	initiatorConfig, responderConfig := newXXModifierConfigs(t, []handshake.HandshakeModifier{xor}, nil)
+
+	_, _, initiatorErr, responderErr := runHandshakePair(t, initiatorConfig, responderConfig)
+	assert.Error(t, initiatorErr)
+	assert.Error(t, responderErr, "responder without the modifier must not accept obfuscated messages")
+}
+
+func TestModifierPhasesFollowMessageIndex(t *testing.T) {
+	initiatorRecorder := &phaseRecorder{}
+	responderRecorder := &phaseRecorder{}
+	initiatorConfig, responderConfig := newXXModifierConfigs(t,
+		[]handshake.HandshakeModifier{initiatorRecorder},
+		[]handshake.HandshakeModifier{responderRecorder})
+
+	establishPair(t, initiatorConfig, responderConfig)
+
+	assert.Equal(t, []handshake.HandshakePhase{handshake.PhaseInitial, handshake.PhaseFinal}, initiatorRecorder.outbound)
+	assert.Equal(t, []handshake.HandshakePhase{handshake.PhaseExchange}, initiatorRecorder.inbound)
+	assert.Equal(t, []handshake.HandshakePhase{handshake.PhaseExchange}, responderRecorder.outbound)
+	assert.Equal(t, []handshake.HandshakePhase{handshake.PhaseInitial, handshake.PhaseFinal}, responderRecorder.inbound)
+}
+
+func TestHandshakePhaseMapping(t *testing.T) {
+	assert.Equal(t, handshake.PhaseInitial, handshakePhase(0, 1))
+	assert.Equal(t, handshake.PhaseInitial, handshakePhase(0, 2))
+	assert.Equal(t, handshake.PhaseFinal, handshakePhase(1, 2))
+	assert.Equal(t, handshake.PhaseExchange, handshakePhase(1, 3))
+	assert.Equal(t, handshake.PhaseFinal, handshakePhase(2, 3))
+}
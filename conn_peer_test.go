@@ -0,0 +1,120 @@
+package noise
+
+import (
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-i2p/go-noise/internal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newTestKeyPair returns a random Curve25519 private key and its public key.
+func newTestKeyPair(t *testing.T) ([]byte, []byte) {
+	t.Helper()
+	private := newTestStaticKey(t)
+	public, err := internal.X25519PublicKey(private)
+	require.NoError(t, err)
+	return private, public
+}
+
+func TestRemoteKeyEnablesKnownResponderPatterns(t *testing.T) {
+	for _, pattern := range []string{"N", "X", "NK", "XK", "IK"} {
+		t.Run(pattern, func(t *testing.T) {
+			responderPrivate, responderPublic := newTestKeyPair(t)
+
+			initiatorConfig := NewConnConfig(pattern, true).
+				WithRemoteKey(responderPublic).
+				WithHandshakeTimeout(5 * time.Second)
+			if pattern != "N" && pattern != "NK" {
+				initiatorConfig = initiatorConfig.WithStaticKey(newTestStaticKey(t))
+			}
+			responderConfig := NewConnConfig(pattern, false).
+				WithStaticKey(responderPrivate).
+				WithHandshakeTimeout(5 * time.Second)
+
+			initiator, _ := establishPair(t, initiatorConfig, responderConfig)
+			assert.Equal(t, responderPublic, initiator.PeerStatic())
+		})
+	}
+}
+
+func TestMutualKnownKeyPatterns(t *testing.T) {
+	for _, pattern := range []string{"K", "KK"} {
+		t.Run(pattern, func(t *testing.T) {
+			initiatorPrivate, initiatorPublic := newTestKeyPair(t)
+			responderPrivate, responderPublic := newTestKeyPair(t)
+
+			initiatorConfig := NewConnConfig(pattern, true).
+				WithStaticKey(initiatorPrivate).
+				WithRemoteKey(responderPublic).
+				WithHandshakeTimeout(5 * time.Second)
+			responderConfig := NewConnConfig(pattern, false).
+				WithStaticKey(responderPrivate).
+				WithRemoteKey(initiatorPublic).
+				WithHandshakeTimeout(5 * time.Second)
+
+			initiator, responder := establishPair(t, initiatorConfig, responderConfig)
+			assert.Equal(t, responderPublic, initiator.PeerStatic())
+			assert.Equal(t, initiatorPublic, responder.PeerStatic())
+		})
+	}
+}
+
+func TestWrongRemoteKeyFailsHandshake(t *testing.T) {
+	responderPrivate, _ := newTestKeyPair(t)
+	_, wrongPublic := newTestKeyPair(t)
+
+	initiatorConfig := NewConnConfig("NK", true).
+		WithRemoteKey(wrongPublic).
+		WithHandshakeTimeout(5 * time.Second)
+	responderConfig := NewConnConfig("NK", false).
+		WithStaticKey(responderPrivate).
+		WithHandshakeTimeout(5 * time.Second)
+
+	_, _, initiatorErr, responderErr := runHandshakePair(t, initiatorConfig, responderConfig)
+	assert.True(t, initiatorErr != nil || responderErr != nil, "handshake against the wrong responder key must fail")
+}
+
+func TestPeerStaticLearnedDuringXX(t *testing.T) {
+	initiatorPrivate, initiatorPublic := newTestKeyPair(t)
+	responderPrivate, responderPublic := newTestKeyPair(t)
+
+	initiatorConfig := NewConnConfig("XX", true).
+		WithStaticKey(initiatorPrivate).
+		WithHandshakeTimeout(5 * time.Second)
+	responderConfig := NewConnConfig("XX", false).
+		WithStaticKey(responderPrivate).
+		WithHandshakeTimeout(5 * time.Second)
+
+	initiator, responder := establishPair(t, initiatorConfig, responderConfig)
+	assert.Equal(t, responderPublic, initiator.PeerStatic())
+	assert.Equal(t, initiatorPublic, responder.PeerStatic())
+
+	// The returned key is a copy and cannot alter the connection's view.
+	key := initiator.PeerStatic()
+	key[0] ^= 0xFF
+	assert.Equal(t, responderPublic, initiator.PeerStatic())
+
+	remote, ok := initiator.RemoteAddr().(*NoiseAddr)
+	require.True(t, ok)
+	assert.Equal(t, responderPublic, remote.PeerStatic())
+	assert.NotEmpty(t, remote.Fingerprint())
+	assert.True(t, strings.HasSuffix(remote.String(), "#"+remote.Fingerprint()))
+}
+
+func TestPeerStaticNilWithoutStaticKeys(t *testing.T) {
+	conn, _ := net.Pipe()
+	defer conn.Close()
+
+	nc, err := NewNoiseConn(conn, NewConnConfig("XX", true).WithStaticKey(newTestStaticKey(t)))
+	require.NoError(t, err)
+	assert.Nil(t, nc.PeerStatic(), "no peer key before the handshake")
+
+	initiator, responder := establishPair(t, NewConnConfig("NN", true), NewConnConfig("NN", false))
+	assert.Nil(t, initiator.PeerStatic())
+	assert.Nil(t, responder.PeerStatic())
+	assert.NotContains(t, initiator.RemoteAddr().String(), "#")
+}
@@ -14,9 +14,6 @@ import (
 // TestSuccessfulEncryptedCommunication tests a complete working encrypted communication
 // This test is designed to hit the encryption/decryption paths by ensuring proper handshake completion
 func TestSuccessfulEncryptedCommunication(t *testing.T) {
-	// Skip this test if it's not working due to handshake implementation limitations
-	t.Skip("Skipping due to simplified handshake implementation - will be enabled when full handshake is implemented")
-
 	// Create pipe for bidirectional communication
 	initiatorConn, responderConn := net.Pipe()
 	defer initiatorConn.Close()
@@ -86,32 +83,24 @@ func TestSuccessfulEncryptedCommunication(t *testing.T) {
 // TestCoverageOfTimeoutPaths tests timeout configuration paths that weren't covered
 func TestCoverageOfTimeoutPaths(t *testing.T) {
 	// Create a connection with specific timeouts configured
-	localAddr := &mockNetAddr{network: "tcp", address: "127.0.0.1:8001"}
-	remoteAddr := &mockNetAddr{network: "tcp", address: "127.0.0.1:8002"}
-	mockConn := newMockNetConn(localAddr, remoteAddr)
-
 	config := NewConnConfig("NN", true).
 		WithHandshakeTimeout(5 * time.Second).
 		WithReadTimeout(100 * time.Millisecond). // Set non-zero timeout
 		WithWriteTimeout(100 * time.Millisecond) // Set non-zero timeout
 
-	nc, err := NewNoiseConn(mockConn, config)
-	require.NoError(t, err)
-
-	// Complete handshake
-	err = nc.Handshake(context.Background())
-	require.NoError(t, err)
+	// Complete handshake against a real responder
+	nc, _ := establishPair(t, config, NewConnConfig("NN", false))
 
 	// Try to read - this should hit configureReadTimeout even if it fails later
 	readBuffer := make([]byte, 10)
-	_, err = nc.Read(readBuffer)
-	// This will likely fail due to cipher state, but should have hit the timeout configuration
+	_, err := nc.Read(readBuffer)
+	// The peer never writes, so the read should hit the configured timeout
 	assert.Error(t, err, "Read should fail but should have configured timeout")
 
 	// Try to write - this should hit configureWriteTimeout even if it fails later
 	writeData := []byte("test data")
 	_, err = nc.Write(writeData)
-	// This will likely fail due to cipher state, but should have hit the timeout configuration
+	// The peer never reads, so the write should hit the configured timeout
 	assert.Error(t, err, "Write should fail but should have configured timeout")
 }
 
@@ -0,0 +1,383 @@
+package noise
+
+import "github.com/go-i2p/noise"
+
+// The deferred handshake patterns from section 7.6 of the Noise specification.
+// Each is a fundamental pattern with one or more DH operations involving a
+// static key moved to a later message, which delays authentication in
+// exchange for better identity hiding. go-i2p/noise only ships the
+// fundamental patterns, so they are defined here from the same tokens.
+
+// handshakeNK1 is the NK1 pattern:
+//
+//	<- s
+//	...
+//	-> e
+//	<- e, ee, es
+var handshakeNK1 = noise.HandshakePattern{
+	Name:                 "NK1",
+	ResponderPreMessages: []noise.MessagePattern{noise.MessagePatternS},
+	Messages: [][]noise.MessagePattern{
+		{noise.MessagePatternE},
+		{noise.MessagePatternE, noise.MessagePatternDHEE, noise.MessagePatternDHES},
+	},
+}
+
+// handshakeNX1 is the NX1 pattern:
+//
+//	-> e
+//	<- e, ee, s
+//	-> es
+var handshakeNX1 = noise.HandshakePattern{
+	Name: "NX1",
+	Messages: [][]noise.MessagePattern{
+		{noise.MessagePatternE},
+		{noise.MessagePatternE, noise.MessagePatternDHEE, noise.MessagePatternS},
+		{noise.MessagePatternDHES},
+	},
+}
+
+// handshakeX1N is the X1N pattern:
+//
+//	-> e
+//	<- e, ee
+//	-> s
+//	<- se
+var handshakeX1N = noise.HandshakePattern{
+	Name: "X1N",
+	Messages: [][]noise.MessagePattern{
+		{noise.MessagePatternE},
+		{noise.MessagePatternE, noise.MessagePatternDHEE},
+		{noise.MessagePatternS},
+		{noise.MessagePatternDHSE},
+	},
+}
+
+// handshakeX1K is the X1K pattern:
+//
+//	<- s
+//	...
+//	-> e, es
+//	<- e, ee
+//	-> s
+//	<- se
+var handshakeX1K = noise.HandshakePattern{
+	Name:                 "X1K",
+	ResponderPreMessages: []noise.MessagePattern{noise.MessagePatternS},
+	Messages: [][]noise.MessagePattern{
+		{noise.MessagePatternE, noise.MessagePatternDHES},
+		{noise.MessagePatternE, noise.MessagePatternDHEE},
+		{noise.MessagePatternS},
+		{noise.MessagePatternDHSE},
+	},
+}
+
+// handshakeXK1 is the XK1 pattern:
+//
+//	<- s
+//	...
+//	-> e
+//	<- e, ee, es
+//	-> s, se
+var handshakeXK1 = noise.HandshakePattern{
+	Name:                 "XK1",
+	ResponderPreMessages: []noise.MessagePattern{noise.MessagePatternS},
+	Messages: [][]noise.MessagePattern{
+		{noise.MessagePatternE},
+		{noise.MessagePatternE, noise.MessagePatternDHEE, noise.MessagePatternDHES},
+		{noise.MessagePatternS, noise.MessagePatternDHSE},
+	},
+}
+
+// handshakeX1K1 is the X1K1 pattern:
+//
+//	<- s
+//	...
+//	-> e
+//	<- e, ee, es
+//	-> s
+//	<- se
+var handshakeX1K1 = noise.HandshakePattern{
+	Name:                 "X1K1",
+	ResponderPreMessages: []noise.MessagePattern{noise.MessagePatternS},
+	Messages: [][]noise.MessagePattern{
+		{noise.MessagePatternE},
+		{noise.MessagePatternE, noise.MessagePatternDHEE, noise.MessagePatternDHES},
+		{noise.MessagePatternS},
+		{noise.MessagePatternDHSE},
+	},
+}
+
+// handshakeX1X is the X1X pattern:
+//
+//	-> e
+//	<- e, ee, s, es
+//	-> s
+//	<- se
+var handshakeX1X = noise.HandshakePattern{
+	Name: "X1X",
+	Messages: [][]noise.MessagePattern{
+		{noise.MessagePatternE},
+		{noise.MessagePatternE, noise.MessagePatternDHEE, noise.MessagePatternS, noise.MessagePatternDHES},
+		{noise.MessagePatternS},
+		{noise.MessagePatternDHSE},
+	},
+}
+
+// handshakeXX1 is the XX1 pattern:
+//
+//	-> e
+//	<- e, ee, s
+//	-> es, s, se
+var handshakeXX1 = noise.HandshakePattern{
+	Name: "XX1",
+	Messages: [][]noise.MessagePattern{
+		{noise.MessagePatternE},
+		{noise.MessagePatternE, noise.MessagePatternDHEE, noise.MessagePatternS},
+		{noise.MessagePatternDHES, noise.MessagePatternS, noise.MessagePatternDHSE},
+	},
+}
+
+// handshakeX1X1 is the X1X1 pattern:
+//
+//	-> e
+//	<- e, ee, s
+//	-> es, s
+//	<- se
+var handshakeX1X1 = noise.HandshakePattern{
+	Name: "X1X1",
+	Messages: [][]noise.MessagePattern{
+		{noise.MessagePatternE},
+		{noise.MessagePatternE, noise.MessagePatternDHEE, noise.MessagePatternS},
+		{noise.MessagePatternDHES, noise.MessagePatternS},
+		{noise.MessagePatternDHSE},
+	},
+}
+
+// handshakeK1N is the K1N pattern:
+//
+//	-> s
+//	...
+//	-> e
+//	<- e, ee
+//	-> se
+var handshakeK1N = noise.HandshakePattern{
+	Name:                 "K1N",
+	InitiatorPreMessages: []noise.MessagePattern{noise.MessagePatternS},
+	Messages: [][]noise.MessagePattern{
+		{noise.MessagePatternE},
+		{noise.MessagePatternE, noise.MessagePatternDHEE},
+		{noise.MessagePatternDHSE},
+	},
+}
+
+// handshakeK1K is the K1K pattern:
+//
+//	-> s
+//	<- s
+//	...
+//	-> e, es
+//	<- e, ee
+//	-> se
+var handshakeK1K = noise.HandshakePattern{
+	Name:                 "K1K",
+	InitiatorPreMessages: []noise.MessagePattern{noise.MessagePatternS},
+	ResponderPreMessages: []noise.MessagePattern{noise.MessagePatternS},
+	Messages: [][]noise.MessagePattern{
+		{noise.MessagePatternE, noise.MessagePatternDHES},
+		{noise.MessagePatternE, noise.MessagePatternDHEE},
+		{noise.MessagePatternDHSE},
+	},
+}
+
+// handshakeKK1 is the KK1 pattern:
+//
+//	-> s
+//	<- s
+//	...
+//	-> e
+//	<- e, ee, se, es
+var handshakeKK1 = noise.HandshakePattern{
+	Name:                 "KK1",
+	InitiatorPreMessages: []noise.MessagePattern{noise.MessagePatternS},
+	ResponderPreMessages: []noise.MessagePattern{noise.MessagePatternS},
+	Messages: [][]noise.MessagePattern{
+		{noise.MessagePatternE},
+		{noise.MessagePatternE, noise.MessagePatternDHEE, noise.MessagePatternDHSE, noise.MessagePatternDHES},
+	},
+}
+
+// handshakeK1K1 is the K1K1 pattern:
+//
+//	-> s
+//	<- s
+//	...
+//	-> e
+//	<- e, ee, es
+//	-> se
+var handshakeK1K1 = noise.HandshakePattern{
+	Name:                 "K1K1",
+	InitiatorPreMessages: []noise.MessagePattern{noise.MessagePatternS},
+	ResponderPreMessages: []noise.MessagePattern{noise.MessagePatternS},
+	Messages: [][]noise.MessagePattern{
+		{noise.MessagePatternE},
+		{noise.MessagePatternE, noise.MessagePatternDHEE, noise.MessagePatternDHES},
+		{noise.MessagePatternDHSE},
+	},
+}
+
+// handshakeK1X is the K1X pattern:
+//
+//	-> s
+//	...
+//	-> e
+//	<- e, ee, s, es
+//	-> se
+var handshakeK1X = noise.HandshakePattern{
+	Name:                 "K1X",
+	InitiatorPreMessages: []noise.MessagePattern{noise.MessagePatternS},
+	Messages: [][]noise.MessagePattern{
+		{noise.MessagePatternE},
+		{noise.MessagePatternE, noise.MessagePatternDHEE, noise.MessagePatternS, noise.MessagePatternDHES},
+		{noise.MessagePatternDHSE},
+	},
+}
+
+// handshakeKX1 is the KX1 pattern:
+//
+//	-> s
+//	...
+//	-> e
+//	<- e, ee, se, s
+//	-> es
+var handshakeKX1 = noise.HandshakePattern{
+	Name:                 "KX1",
+	InitiatorPreMessages: []noise.MessagePattern{noise.MessagePatternS},
+	Messages: [][]noise.MessagePattern{
+		{noise.MessagePatternE},
+		{noise.MessagePatternE, noise.MessagePatternDHEE, noise.MessagePatternDHSE, noise.MessagePatternS},
+		{noise.MessagePatternDHES},
+	},
+}
+
+// handshakeK1X1 is the K1X1 pattern:
+//
+//	-> s
+//	...
+//	-> e
+//	<- e, ee, s
+//	-> se, es
+var handshakeK1X1 = noise.HandshakePattern{
+	Name:                 "K1X1",
+	InitiatorPreMessages: []noise.MessagePattern{noise.MessagePatternS},
+	Messages: [][]noise.MessagePattern{
+		{noise.MessagePatternE},
+		{noise.MessagePatternE, noise.MessagePatternDHEE, noise.MessagePatternS},
+		{noise.MessagePatternDHSE, noise.MessagePatternDHES},
+	},
+}
+
+// handshakeI1N is the I1N pattern:
+//
+//	-> e, s
+//	<- e, ee
+//	-> se
+var handshakeI1N = noise.HandshakePattern{
+	Name: "I1N",
+	Messages: [][]noise.MessagePattern{
+		{noise.MessagePatternE, noise.MessagePatternS},
+		{noise.MessagePatternE, noise.MessagePatternDHEE},
+		{noise.MessagePatternDHSE},
+	},
+}
+
+// handshakeI1K is the I1K pattern:
+//
+//	<- s
+//	...
+//	-> e, es, s
+//	<- e, ee
+//	-> se
+var handshakeI1K = noise.HandshakePattern{
+	Name:                 "I1K",
+	ResponderPreMessages: []noise.MessagePattern{noise.MessagePatternS},
+	Messages: [][]noise.MessagePattern{
+		{noise.MessagePatternE, noise.MessagePatternDHES, noise.MessagePatternS},
+		{noise.MessagePatternE, noise.MessagePatternDHEE},
+		{noise.MessagePatternDHSE},
+	},
+}
+
+// handshakeIK1 is the IK1 pattern:
+//
+//	<- s
+//	...
+//	-> e, s
+//	<- e, ee, se, es
+var handshakeIK1 = noise.HandshakePattern{
+	Name:                 "IK1",
+	ResponderPreMessages: []noise.MessagePattern{noise.MessagePatternS},
+	Messages: [][]noise.MessagePattern{
+		{noise.MessagePatternE, noise.MessagePatternS},
+		{noise.MessagePatternE, noise.MessagePatternDHEE, noise.MessagePatternDHSE, noise.MessagePatternDHES},
+	},
+}
+
+// handshakeI1K1 is the I1K1 pattern:
+//
+//	<- s
+//	...
+//	-> e, s
+//	<- e, ee, es
+//	-> se
+var handshakeI1K1 = noise.HandshakePattern{
+	Name:                 "I1K1",
+	ResponderPreMessages: []noise.MessagePattern{noise.MessagePatternS},
+	Messages: [][]noise.MessagePattern{
+		{noise.MessagePatternE, noise.MessagePatternS},
+		{noise.MessagePatternE, noise.MessagePatternDHEE, noise.MessagePatternDHES},
+		{noise.MessagePatternDHSE},
+	},
+}
+
+// handshakeI1X is the I1X pattern:
+//
+//	-> e, s
+//	<- e, ee, s, es
+//	-> se
+var handshakeI1X = noise.HandshakePattern{
+	Name: "I1X",
+	Messages: [][]noise.MessagePattern{
+		{noise.MessagePatternE, noise.MessagePatternS},
+		{noise.MessagePatternE, noise.MessagePatternDHEE, noise.MessagePatternS, noise.MessagePatternDHES},
+		{noise.MessagePatternDHSE},
+	},
+}
+
+// handshakeIX1 is the IX1 pattern:
+//
+//	-> e, s
+//	<- e, ee, se, s
+//	-> es
+var handshakeIX1 = noise.HandshakePattern{
+	Name: "IX1",
+	Messages: [][]noise.MessagePattern{
+		{noise.MessagePatternE, noise.MessagePatternS},
+		{noise.MessagePatternE, noise.MessagePatternDHEE, noise.MessagePatternDHSE, noise.MessagePatternS},
+		{noise.MessagePatternDHES},
+	},
+}
+
+// handshakeI1X1 is the I1X1 pattern:
+//
+//	-> e, s
+//	<- e, ee, s
+//	-> se, es
+var handshakeI1X1 = noise.HandshakePattern{
+	Name: "I1X1",
+	Messages: [][]noise.MessagePattern{
+		{noise.MessagePatternE, noise.MessagePatternS},
+		{noise.MessagePatternE, noise.MessagePatternDHEE, noise.MessagePatternS},
+		{noise.MessagePatternDHSE, noise.MessagePatternDHES},
+	},
+}
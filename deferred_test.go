@@ -0,0 +1,151 @@
+package noise
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/go-i2p/noise"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var deferredPatterns = []string{
+	"NK1", "NX1",
+	"X1N", "X1K", "XK1", "X1K1", "X1X", "XX1", "X1X1",
+	"K1N", "K1K", "KK1", "K1K1", "K1X", "KX1", "K1X1",
+	"I1N", "I1K", "IK1", "I1K1", "I1X", "IX1", "I1X1",
+}
+
+// containsStatic reports whether a message or pre-message carries a static key.
+func containsStatic(tokens []noise.MessagePattern) bool {
+	for _, token := range tokens {
+		if token == noise.MessagePatternS {
+			return true
+		}
+	}
+	return false
+}
+
+// sendsStatic reports whether the initiator (or responder) static key is
+// known to its peer by the end of the handshake.
+func sendsStatic(pattern noise.HandshakePattern, initiator bool) bool {
+	pre := pattern.ResponderPreMessages
+	if initiator {
+		pre = pattern.InitiatorPreMessages
+	}
+	if containsStatic(pre) {
+		return true
+	}
+	for i, tokens := range pattern.Messages {
+		if (i%2 == 0) == initiator && containsStatic(tokens) {
+			return true
+		}
+	}
+	return false
+}
+
+func TestDeferredPatternsParse(t *testing.T) {
+	require.Len(t, deferredPatterns, 23)
+	for _, name := range deferredPatterns {
+		p, err := parseProtocolName(name)
+		require.NoError(t, err, name)
+		assert.Equal(t, name, p.Pattern.Name)
+		assert.Equal(t, "Noise_"+name+"_25519_AESGCM_SHA256", p.Name)
+	}
+
+	p, err := parseProtocolName("Noise_X1K1psk3_25519_ChaChaPoly_BLAKE2s")
+	require.NoError(t, err)
+	assert.Equal(t, "X1K1", p.Pattern.Name)
+	assert.Equal(t, 3, p.PSKPlacement)
+}
+
+func TestDeferredPatternsEndToEnd(t *testing.T) {
+	for _, name := range deferredPatterns {
+		t.Run(name, func(t *testing.T) {
+			pattern := handshakePatterns[name]
+			initiatorPrivate, initiatorPublic := newTestKeyPair(t)
+			responderPrivate, responderPublic := newTestKeyPair(t)
+
+			listenerConfig := NewListenerConfig(name).
+				WithStaticKey(responderPrivate).
+				WithHandshakeTimeout(5 * time.Second)
+			dialConfig := NewConnConfig(name, true).
+				WithStaticKey(initiatorPrivate).
+				WithHandshakeTimeout(5 * time.Second)
+			if containsStatic(pattern.InitiatorPreMessages) {
+				listenerConfig.WithRemoteKey(initiatorPublic)
+			}
+			if containsStatic(pattern.ResponderPreMessages) {
+				dialConfig.WithRemoteKey(responderPublic)
+			}
+
+			tcpListener, err := net.Listen("tcp", "127.0.0.1:0")
+			require.NoError(t, err)
+			listener, err := NewNoiseListener(tcpListener, listenerConfig)
+			require.NoError(t, err)
+			defer listener.Close()
+
+			serverErr := make(chan error, 1)
+			serverPeer := make(chan []byte, 1)
+			go func() {
+				conn, err := listener.Accept()
+				if err != nil {
+					serverErr <- err
+					return
+				}
+				defer conn.Close()
+				nc := conn.(*NoiseConn)
+				if err := nc.Handshake(t.Context()); err != nil {
+					serverErr <- err
+					return
+				}
+
+				buf := make([]byte, 4)
+				if _, err := nc.Read(buf); err != nil {
+					serverErr <- err
+					return
+				}
+				serverPeer <- nc.PeerStatic()
+				_, err = nc.Write(buf)
+				serverErr <- err
+			}()
+
+			client, err := DialNoiseWithHandshake("tcp", tcpListener.Addr().String(), dialConfig)
+			require.NoError(t, err)
+			defer client.Close()
+
+			_, err = client.Write([]byte("ping"))
+			require.NoError(t, err)
+			buf := make([]byte, 4)
+			_, err = client.Read(buf)
+			require.NoError(t, err)
+			assert.Equal(t, "ping", string(buf))
+			require.NoError(t, <-serverErr)
+
+			assert.Equal(t, "Noise_"+name+"_25519_AESGCM_SHA256", client.Snapshot().Protocol)
+			if sendsStatic(pattern, false) {
+				assert.Equal(t, responderPublic, client.PeerStatic())
+			}
+			if sendsStatic(pattern, true) {
+				assert.Equal(t, initiatorPublic, <-serverPeer)
+			}
+		})
+	}
+}
+
+func TestDeferredPatternWrongRemoteKeyFails(t *testing.T) {
+	responderPrivate, _ := newTestKeyPair(t)
+	_, wrongPublic := newTestKeyPair(t)
+
+	initiatorConfig := NewConnConfig("XK1", true).
+		WithStaticKey(newTestStaticKey(t)).
+		WithRemoteKey(wrongPublic).
+		WithHandshakeTimeout(5 * time.Second)
+	responderConfig := NewConnConfig("XK1", false).
+		WithStaticKey(responderPrivate).
+		WithHandshakeTimeout(5 * time.Second)
+
+	_, _, initiatorErr, responderErr := runHandshakePair(t, initiatorConfig, responderConfig)
+	assert.True(t, initiatorErr != nil || responderErr != nil, "deferred authentication must still reject the wrong key")
+}
@@ -1,7 +1,6 @@
 package noise
 
 import (
-	"context"
 	"testing"
 	"time"
 
@@ -10,23 +9,14 @@ import (
 
 // TestDirectTimeoutFunctionCalls tests timeout configuration functions directly
 func TestDirectTimeoutFunctionCalls(t *testing.T) {
-	// Create a mock connection
-	localAddr := &mockNetAddr{network: "tcp", address: "127.0.0.1:8001"}
-	remoteAddr := &mockNetAddr{network: "tcp", address: "127.0.0.1:8002"}
-	mockConn := newMockNetConn(localAddr, remoteAddr)
-
 	// Create config with timeouts
 	config := NewConnConfig("NN", true).
 		WithHandshakeTimeout(5 * time.Second).
 		WithReadTimeout(1 * time.Second).
 		WithWriteTimeout(1 * time.Second)
 
-	nc, err := NewNoiseConn(mockConn, config)
-	require.NoError(t, err)
-
 	// Complete handshake to make cipher operations valid
-	err = nc.Handshake(context.Background())
-	require.NoError(t, err)
+	nc, _ := establishPair(t, config, NewConnConfig("NN", false))
 
 	// Call Read to trigger configureReadTimeout
 	// Even though this will fail due to cipher state, it should hit the timeout config
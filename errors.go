@@ -0,0 +1,64 @@
+package noise
+
+import "github.com/go-i2p/go-noise/internal"
+
+// Error is the type of the sentinel errors below. It implements net.Error:
+// Timeout reports true for ErrHandshakeTimeout, ErrPeerTimeout and
+// ErrShutdownTimeout.
+type Error = internal.Error
+
+// Sentinel errors. Errors returned by this package and by the ntcp2, pool,
+// handshake and mux packages wrap one of these where the failure falls into a
+// category, so callers can test for it with errors.Is. Failures of the
+// underlying connection wrap the original error instead, which errors.Is
+// matches against io.EOF, net.ErrClosed, os.ErrDeadlineExceeded and so on.
+var (
+	// ErrConnClosed reports use of a closed connection or session.
+	// It also matches net.ErrClosed.
+	ErrConnClosed = internal.ErrConnClosed
+
+	// ErrListenerClosed reports Accept on a closed listener.
+	// It also matches net.ErrClosed.
+	ErrListenerClosed = internal.ErrListenerClosed
+
+	// ErrWriteClosed reports a write after CloseWrite.
+	ErrWriteClosed = internal.ErrWriteClosed
+
+	// ErrHandshakeNotDone reports transport I/O before the handshake completed.
+	ErrHandshakeNotDone = internal.ErrHandshakeNotDone
+
+	// ErrHandshakeFailed reports a handshake that did not complete. The more
+	// specific ErrHandshakeTimeout, ErrAuthFailed and ErrPeerRejected are
+	// matched as well when they apply.
+	ErrHandshakeFailed = internal.ErrHandshakeFailed
+
+	// ErrHandshakeTimeout reports a handshake that ran out of time.
+	ErrHandshakeTimeout = internal.ErrHandshakeTimeout
+
+	// ErrAuthFailed reports a message that failed authentication: a wrong
+	// key, a differing prologue or PSK, or tampering.
+	ErrAuthFailed = internal.ErrAuthFailed
+
+	// ErrPeerRejected reports a peer refused by VerifyPeer or by a
+	// handshake payload handler.
+	ErrPeerRejected = internal.ErrPeerRejected
+
+	// ErrPeerTimeout reports a peer silent for longer than KeepaliveTimeout.
+	ErrPeerTimeout = internal.ErrPeerTimeout
+
+	// ErrMessageTooLarge reports a message, frame or datagram over its size limit.
+	ErrMessageTooLarge = internal.ErrMessageTooLarge
+
+	// ErrNonceExhausted reports a cipher state that has used every nonce.
+	ErrNonceExhausted = internal.ErrNonceExhausted
+
+	// ErrProtocolViolation reports malformed or unexpected data from the peer.
+	ErrProtocolViolation = internal.ErrProtocolViolation
+
+	// ErrInvalidConfig reports an invalid configuration or argument.
+	ErrInvalidConfig = internal.ErrInvalidConfig
+
+	// ErrShutdownTimeout reports connections still open when the
+	// ShutdownManager's timeout expired.
+	ErrShutdownTimeout = internal.ErrShutdownTimeout
+)
@@ -0,0 +1,233 @@
+package noise
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"os"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// requireNetError asserts that err itself, not just something it wraps,
+// satisfies net.Error, as accept loops like http.Server's expect.
+func requireNetError(t *testing.T, err error, timeout bool) {
+	t.Helper()
+	ne, ok := err.(net.Error)
+	require.True(t, ok, "expected a net.Error, got %T: %v", err, err)
+	assert.Equal(t, timeout, ne.Timeout())
+}
+
+func TestSentinelConnClosed(t *testing.T) {
+	initiator, responder := establishPair(t, NewConnConfig("NN", true), NewConnConfig("NN", false))
+	defer responder.Close()
+	require.NoError(t, initiator.Close())
+
+	_, err := initiator.Write([]byte("late"))
+	assert.ErrorIs(t, err, ErrConnClosed)
+	assert.ErrorIs(t, err, net.ErrClosed)
+	requireNetError(t, err, false)
+
+	_, err = initiator.Read(make([]byte, 1))
+	assert.ErrorIs(t, err, ErrConnClosed)
+	requireErrorCode(t, err, "CONN_CLOSED")
+}
+
+func TestSentinelListenerClosed(t *testing.T) {
+	tcpListener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	listener, err := NewNoiseListener(tcpListener, NewListenerConfig("NN"))
+	require.NoError(t, err)
+	require.NoError(t, listener.Close())
+
+	_, err = listener.Accept()
+	assert.ErrorIs(t, err, ErrListenerClosed)
+	assert.ErrorIs(t, err, net.ErrClosed)
+	assert.NotErrorIs(t, err, ErrConnClosed)
+	requireNetError(t, err, false)
+}
+
+// flakyListener fails its first Accept with a temporary error.
+type flakyListener struct {
+	net.Listener
+	failed bool
+}
+
+func (l *flakyListener) Accept() (net.Conn, error) {
+	if !l.failed {
+		l.failed = true
+		return nil, &net.OpError{Op: "accept", Net: "tcp", Err: syscall.EMFILE}
+	}
+	return l.Listener.Accept()
+}
+
+func TestAcceptErrorsAreTemporaryNetErrors(t *testing.T) {
+	tcpListener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	listener, err := NewNoiseListener(&flakyListener{Listener: tcpListener}, NewListenerConfig("NN"))
+	require.NoError(t, err)
+	defer listener.Close()
+
+	_, err = listener.Accept()
+	requireErrorCode(t, err, "ACCEPT_FAILED")
+	ne, ok := err.(net.Error)
+	require.True(t, ok, "got %T", err)
+	//lint:ignore SA1019 accept loops still consult Temporary
+	assert.True(t, ne.Temporary(), "EMFILE is worth retrying")
+	assert.ErrorIs(t, err, syscall.EMFILE)
+}
+
+func TestSentinelHandshakeNotDoneAndWriteClosed(t *testing.T) {
+	nc, err := NewNoiseConn(silentPeer(t), NewConnConfig("NN", true))
+	require.NoError(t, err)
+	_, err = nc.Write([]byte("early"))
+	assert.ErrorIs(t, err, ErrHandshakeNotDone)
+
+	initiator, responder := establishPair(t, NewConnConfig("NN", true).WithMessageTypes(true), NewConnConfig("NN", false).WithMessageTypes(true))
+	defer initiator.Close()
+	defer responder.Close()
+	go func() { _, _ = io.Copy(io.Discard, responder) }()
+
+	require.NoError(t, initiator.CloseWrite())
+	_, err = initiator.Write([]byte("after close write"))
+	assert.ErrorIs(t, err, ErrWriteClosed)
+	assert.NotErrorIs(t, err, ErrConnClosed)
+}
+
+func TestSentinelHandshakeTimeout(t *testing.T) {
+	config := NewConnConfig("XX", true).
+		WithStaticKey(newTestStaticKey(t)).
+		WithHandshakeTimeout(50 * time.Millisecond)
+	nc, err := NewNoiseConn(silentPeer(t), config)
+	require.NoError(t, err)
+
+	err = nc.Handshake(context.Background())
+	assert.ErrorIs(t, err, ErrHandshakeTimeout)
+	assert.ErrorIs(t, err, ErrHandshakeFailed)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+
+	var ne net.Error
+	require.ErrorAs(t, err, &ne)
+	assert.True(t, ne.Timeout())
+}
+
+func TestSentinelHandshakeCancelled(t *testing.T) {
+	config := NewConnConfig("XX", true).WithStaticKey(newTestStaticKey(t))
+	nc, err := NewNoiseConn(silentPeer(t), config)
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	err = nc.Handshake(ctx)
+	assert.ErrorIs(t, err, ErrHandshakeFailed)
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.NotErrorIs(t, err, ErrHandshakeTimeout)
+}
+
+func TestSentinelAuthFailed(t *testing.T) {
+	initiatorConfig := NewConnConfig("NN", true).
+		WithPrologue([]byte("myproto/v2")).
+		WithHandshakeTimeout(5 * time.Second)
+	responderConfig := NewConnConfig("NN", false).
+		WithPrologue([]byte("myproto/v1")).
+		WithHandshakeTimeout(5 * time.Second)
+
+	_, _, initiatorErr, _ := runHandshakePair(t, initiatorConfig, responderConfig)
+	assert.ErrorIs(t, initiatorErr, ErrAuthFailed)
+	assert.ErrorIs(t, initiatorErr, ErrHandshakeFailed)
+	assert.NotErrorIs(t, initiatorErr, ErrPeerRejected)
+}
+
+func TestSentinelPeerRejected(t *testing.T) {
+	initiatorConfig, responderConfig, _, _ := xxConfigs(t)
+	rejection := errors.New("not on the allowlist")
+	responderConfig.WithVerifyPeer(func(remoteStatic, payload []byte) error {
+		return rejection
+	})
+
+	_, _, _, responderErr := runHandshakePair(t, initiatorConfig, responderConfig)
+	assert.ErrorIs(t, responderErr, ErrPeerRejected)
+	assert.ErrorIs(t, responderErr, ErrHandshakeFailed)
+	assert.ErrorIs(t, responderErr, rejection, "the callback's error stays reachable")
+}
+
+func TestSentinelPeerTimeout(t *testing.T) {
+	initiator, responder := establishPair(t,
+		NewConnConfig("NN", true),
+		NewConnConfig("NN", false).WithKeepalive(0, 50*time.Millisecond))
+	defer initiator.Close()
+
+	_, err := responder.Read(make([]byte, 16))
+	assert.ErrorIs(t, err, ErrPeerTimeout)
+	requireNetError(t, err, true)
+}
+
+func TestReadDeadlineIsTimeoutNetError(t *testing.T) {
+	_, responder := establishTCPPair(t)
+
+	require.NoError(t, responder.SetReadDeadline(time.Now().Add(20*time.Millisecond)))
+	_, err := responder.Read(make([]byte, 16))
+	assert.ErrorIs(t, err, os.ErrDeadlineExceeded)
+	requireNetError(t, err, true)
+}
+
+func TestSentinelMessageTooLarge(t *testing.T) {
+	initiator, responder := establishPair(t, NewConnConfig("NN", true), NewConnConfig("NN", false))
+	defer initiator.Close()
+	defer responder.Close()
+
+	err := initiator.WriteMessage(make([]byte, MaxMessageSize+1))
+	assert.ErrorIs(t, err, ErrMessageTooLarge)
+	var tooLarge *MessageTooLargeError
+	require.ErrorAs(t, err, &tooLarge)
+	assert.Equal(t, MaxMessageSize+1, tooLarge.Size)
+}
+
+func TestSentinelInvalidConfig(t *testing.T) {
+	assert.ErrorIs(t, NewConnConfig("", true).Validate(), ErrInvalidConfig)
+	assert.ErrorIs(t, NewConnConfig("XX", true).WithStaticKey([]byte("short")).Validate(), ErrInvalidConfig)
+	assert.ErrorIs(t, NewListenerConfig("NN").WithHandshakeTimeout(-time.Second).Validate(), ErrInvalidConfig)
+
+	_, err := NewNoiseConn(nil, NewConnConfig("NN", true))
+	assert.ErrorIs(t, err, ErrInvalidConfig)
+	requireErrorCode(t, err, "INVALID_CONN")
+}
+
+func TestSentinelErrorsAreDistinct(t *testing.T) {
+	sentinels := []error{
+		ErrConnClosed, ErrListenerClosed, ErrWriteClosed, ErrHandshakeNotDone,
+		ErrHandshakeFailed, ErrHandshakeTimeout, ErrAuthFailed, ErrPeerRejected,
+		ErrPeerTimeout, ErrMessageTooLarge, ErrNonceExhausted, ErrProtocolViolation,
+		ErrInvalidConfig, ErrShutdownTimeout,
+	}
+	for i, a := range sentinels {
+		for j, b := range sentinels {
+			assert.Equal(t, i == j, errors.Is(a, b), "%v vs %v", a, b)
+		}
+	}
+
+	for _, timeout := range []*Error{ErrHandshakeTimeout, ErrPeerTimeout, ErrShutdownTimeout} {
+		assert.True(t, timeout.Timeout(), timeout.Error())
+	}
+	assert.False(t, ErrAuthFailed.Timeout())
+}
+
+func TestMessageMethodsReturnNetErrors(t *testing.T) {
+	initiator, responder := establishPair(t, NewConnConfig("NN", true), NewConnConfig("NN", false))
+	defer responder.Close()
+
+	require.NoError(t, initiator.SetReadDeadline(time.Now().Add(20*time.Millisecond)))
+	_, err := initiator.ReadMessage()
+	assert.ErrorIs(t, err, os.ErrDeadlineExceeded)
+	requireNetError(t, err, true)
+
+	require.NoError(t, initiator.Close())
+	err = initiator.WriteMessage([]byte("late"))
+	assert.ErrorIs(t, err, ErrConnClosed)
+	requireNetError(t, err, false)
+}
@@ -2,24 +2,24 @@
 package shared
 
 import (
-	"crypto/rand"
 	"encoding/hex"
 	"fmt"
 
+	"github.com/go-i2p/go-noise"
 	"github.com/samber/oops"
 )
 
-// GenerateRandomKey generates a random 32-byte Curve25519 private key for testing
+// GenerateRandomKey generates a random 32-byte Curve25519 private key for testing.
+// Use noise.GenerateKeyPair directly when the public key is also needed.
 func GenerateRandomKey() ([]byte, error) {
-	key := make([]byte, 32)
-	_, err := rand.Read(key)
+	kp, err := noise.GenerateKeyPair("25519")
 	if err != nil {
 		return nil, oops.
 			Code("KEYGEN_FAILED").
 			In("examples").
 			Wrapf(err, "failed to generate random key")
 	}
-	return key, nil
+	return kp.Private, nil
 }
 
 // ParseKeyFromHex parses a hexadecimal string into a 32-byte key
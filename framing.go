@@ -0,0 +1,141 @@
+package noise
+
+import (
+	"encoding/binary"
+	"io"
+
+	"github.com/samber/oops"
+)
+
+// frameHeaderLen is the size of the big-endian length prefix that precedes
+// every Noise message sent over a stream transport.
+const frameHeaderLen = 2
+
+// maxFrameLen is the largest Noise message permitted by the specification.
+const maxFrameLen = 65535
+
+// cipherTagLen is the size of the AEAD authentication tag appended to every
+// encrypted transport message.
+const cipherTagLen = 16
+
+// maxPlaintextLen is the largest plaintext that still fits in one Noise
+// transport message once the authentication tag is added.
+const maxPlaintextLen = maxFrameLen - cipherTagLen
+
+// Transport message types. With ConnConfig.MessageTypes every transport
+// plaintext starts with one of these bytes and a zero-length plaintext is a
+// keepalive. This type byte is go-noise's own wire format, not part of the
+// Noise specification, so it is opt-in and both peers must enable it; without
+// it every transport message is application data. The README's Wire Format
+// section documents it.
+const (
+	// msgTypeData carries application data
+	msgTypeData byte = 0x00
+	// msgTypeRekey tells the peer that the sender has rekeyed its send cipher
+	msgTypeRekey byte = 0x01
+	// msgTypeEOF tells the peer that the sender will write no more data
+	msgTypeEOF byte = 0x02
+	// msgTypeClose carries a close code and reason before the sender closes
+	msgTypeClose byte = 0x03
+)
+
+// maxDataLen is the largest amount of application data carried by one
+// transport message, leaving room for the optional message type byte.
+const maxDataLen = maxPlaintextLen - 1
+
+// messageTypesRequired reports that feature needs ConnConfig.MessageTypes.
+func messageTypesRequired(feature string) error {
+	return oops.
+		Code("MESSAGE_TYPES_REQUIRED").
+		In("noise").
+		With("feature", feature).
+		Wrapf(ErrInvalidConfig, "%s requires MessageTypes", feature)
+}
+
+// writeFrame writes msg to w prefixed with its 2-byte big-endian length.
+// The header and body are sent in a single Write so that message-oriented
+// transports such as net.Pipe deliver the frame atomically.
+func writeFrame(w io.Writer, msg []byte) error {
+	if len(msg) > maxFrameLen {
+		return oops.
+			Code("FRAME_TOO_LARGE").
+			In("noise").
+			With("frame_len", len(msg)).
+			With("max_frame_len", maxFrameLen).
+			Wrapf(ErrMessageTooLarge, "noise message exceeds maximum frame length")
+	}
+
+	frame := make([]byte, frameHeaderLen+len(msg))
+	binary.BigEndian.PutUint16(frame, uint16(len(msg)))
+	copy(frame[frameHeaderLen:], msg)
+
+	n, err := w.Write(frame)
+	if err != nil {
+		return err
+	}
+	if n != len(frame) {
+		return io.ErrShortWrite
+	}
+	return nil
+}
+
+// readFrame reads one length-prefixed Noise message from r.
+// It blocks until the complete frame has arrived, reassembling it from as
+// many underlying reads as necessary.
+func readFrame(r io.Reader) ([]byte, error) {
+	var fr frameReader
+	return fr.readFrame(r)
+}
+
+// frameReader reads length-prefixed frames and keeps a partially received
+// frame across calls. A read deadline that fires mid-frame therefore does
+// not lose the bytes already read, and the next call resumes where the
+// previous one stopped instead of parsing ciphertext as a length.
+type frameReader struct {
+	// header holds the length prefix of the current frame
+	header [frameHeaderLen]byte
+	// msg is the body of the current frame, allocated once its length is known
+	msg []byte
+	// received counts the bytes of the current frame read so far
+	received int
+}
+
+// readFrame reads the rest of the current frame from r. On error the bytes
+// already read are kept for the next call.
+func (fr *frameReader) readFrame(r io.Reader) ([]byte, error) {
+	for fr.received < frameHeaderLen {
+		n, err := r.Read(fr.header[fr.received:])
+		fr.received += n
+		if fr.received == frameHeaderLen {
+			break
+		}
+		if err != nil {
+			return nil, fr.truncated(err)
+		}
+	}
+
+	if fr.msg == nil {
+		fr.msg = make([]byte, binary.BigEndian.Uint16(fr.header[:]))
+	}
+	for body := fr.received - frameHeaderLen; body < len(fr.msg); body = fr.received - frameHeaderLen {
+		n, err := r.Read(fr.msg[body:])
+		fr.received += n
+		if err != nil && fr.received-frameHeaderLen < len(fr.msg) {
+			return nil, fr.truncated(err)
+		}
+	}
+
+	msg := fr.msg
+	fr.msg = nil
+	fr.received = 0
+	return msg, nil
+}
+
+// truncated turns io.EOF into io.ErrUnexpectedEOF once part of a frame has
+// been read.
+func (fr *frameReader) truncated(err error) error {
+	if err == io.EOF && fr.received > 0 {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
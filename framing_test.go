@@ -0,0 +1,257 @@
+package noise
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/binary"
+	"io"
+	"net"
+	"os"
+	"testing"
+	"testing/iotest"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fragmentingConn splits every Write into small pieces to mimic a stream
+// transport that segments data arbitrarily.
+type fragmentingConn struct {
+	net.Conn
+	fragment int
+}
+
+func (fc *fragmentingConn) Write(b []byte) (int, error) {
+	written := 0
+	for written < len(b) {
+		end := min(written+fc.fragment, len(b))
+		n, err := fc.Conn.Write(b[written:end])
+		written += n
+		if err != nil {
+			return written, err
+		}
+	}
+	return written, nil
+}
+
+func TestFrameRoundTrip(t *testing.T) {
+	var buf bytes.Buffer
+	require.NoError(t, writeFrame(&buf, []byte("first")))
+	require.NoError(t, writeFrame(&buf, nil))
+	require.NoError(t, writeFrame(&buf, []byte("second")))
+
+	// Two frames written back to back are merged in the buffer, and the
+	// one-byte reader forces every frame to be reassembled from fragments.
+	r := iotest.OneByteReader(&buf)
+
+	frame, err := readFrame(r)
+	require.NoError(t, err)
+	assert.Equal(t, []byte("first"), frame)
+
+	frame, err = readFrame(r)
+	require.NoError(t, err)
+	assert.Empty(t, frame)
+
+	frame, err = readFrame(r)
+	require.NoError(t, err)
+	assert.Equal(t, []byte("second"), frame)
+
+	_, err = readFrame(r)
+	assert.Equal(t, io.EOF, err)
+}
+
+func TestFrameRejectsOversizedMessage(t *testing.T) {
+	var buf bytes.Buffer
+	err := writeFrame(&buf, make([]byte, maxFrameLen+1))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "maximum frame length")
+	assert.Zero(t, buf.Len())
+}
+
+func TestFrameTruncatedBody(t *testing.T) {
+	_, err := readFrame(bytes.NewReader([]byte{0x00, 0x10, 0x01, 0x02}))
+	assert.Equal(t, io.ErrUnexpectedEOF, err)
+}
+
+func TestNoiseConnLargeWriteIsChunked(t *testing.T) {
+	initiator, responder := establishPair(t,
+		NewConnConfig("NN", true).WithHandshakeTimeout(5*time.Second),
+		NewConnConfig("NN", false).WithHandshakeTimeout(5*time.Second))
+
+	payload := make([]byte, 3*maxPlaintextLen+1234)
+	_, err := rand.Read(payload)
+	require.NoError(t, err)
+
+	writeDone := make(chan error, 1)
+	go func() {
+		n, err := initiator.Write(payload)
+		if err == nil && n != len(payload) {
+			err = io.ErrShortWrite
+		}
+		writeDone <- err
+	}()
+
+	received := make([]byte, len(payload))
+	_, err = io.ReadFull(responder, received)
+	require.NoError(t, err)
+	require.NoError(t, <-writeDone)
+
+	assert.True(t, bytes.Equal(payload, received), "payload should survive chunking")
+	assert.Equal(t, uint64(4), responder.recvCipher.Nonce(), "payload should span four transport messages")
+}
+
+func TestTransportPlaintextFormat(t *testing.T) {
+	tests := []struct {
+		name         string
+		messageTypes bool
+		want         []byte
+	}{
+		{"plain Noise by default", false, []byte("payload")},
+		{"typed envelope", true, append([]byte{msgTypeData}, "payload"...)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			initiator, responder := establishPair(t,
+				NewConnConfig("NN", true).WithMessageTypes(tt.messageTypes),
+				NewConnConfig("NN", false).WithMessageTypes(tt.messageTypes))
+			defer initiator.Close()
+			defer responder.Close()
+
+			go func() { _ = initiator.WriteMessage([]byte("payload")) }()
+
+			encrypted, err := responder.readEncryptedFrame()
+			require.NoError(t, err)
+			plaintext, err := responder.recvCipher.Decrypt(nil, nil, encrypted)
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, plaintext)
+		})
+	}
+}
+
+func TestNoiseConnSmallReadBuffersLeftover(t *testing.T) {
+	initiator, responder := establishPair(t,
+		NewConnConfig("NN", true).WithHandshakeTimeout(5*time.Second),
+		NewConnConfig("NN", false).WithHandshakeTimeout(5*time.Second))
+
+	message := []byte("a message that is longer than the reader's buffer")
+	go func() {
+		_, _ = initiator.Write(message)
+	}()
+
+	var received []byte
+	buf := make([]byte, 7)
+	for len(received) < len(message) {
+		n, err := responder.Read(buf)
+		require.NoError(t, err)
+		received = append(received, buf[:n]...)
+	}
+
+	assert.Equal(t, message, received)
+	assert.Equal(t, uint64(1), responder.recvCipher.Nonce(), "leftover bytes should come from the buffered frame")
+}
+
+func TestNoiseConnReassemblesSegmentedFrames(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer listener.Close()
+
+	accepted := make(chan net.Conn, 1)
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			close(accepted)
+			return
+		}
+		accepted <- conn
+	}()
+
+	clientTCP, err := net.Dial("tcp", listener.Addr().String())
+	require.NoError(t, err)
+	defer clientTCP.Close()
+	serverTCP, ok := <-accepted
+	require.True(t, ok)
+	defer serverTCP.Close()
+
+	client, err := NewNoiseConn(&fragmentingConn{Conn: clientTCP, fragment: 3}, NewConnConfig("NN", true))
+	require.NoError(t, err)
+	server, err := NewNoiseConn(serverTCP, NewConnConfig("NN", false))
+	require.NoError(t, err)
+
+	handshakeDone := make(chan error, 1)
+	go func() {
+		handshakeDone <- server.Handshake(t.Context())
+	}()
+	require.NoError(t, client.Handshake(t.Context()))
+	require.NoError(t, <-handshakeDone)
+
+	// Several writes arrive fragmented and coalesced in the TCP stream,
+	// yet each must be decrypted as a whole frame.
+	messages := [][]byte{[]byte("one"), []byte("two"), bytes.Repeat([]byte("three"), 1000)}
+	for _, msg := range messages {
+		_, err := client.Write(msg)
+		require.NoError(t, err)
+	}
+
+	var expected []byte
+	for _, msg := range messages {
+		expected = append(expected, msg...)
+	}
+
+	received := make([]byte, len(expected))
+	_, err = io.ReadFull(server, received)
+	require.NoError(t, err)
+	assert.Equal(t, expected, received)
+}
+
+func TestNoiseConnResumesFrameAfterReadDeadline(t *testing.T) {
+	client, server := establishTCPPair(t)
+
+	encrypted, err := client.encryptData(append([]byte{msgTypeData}, "resumed after timeout"...))
+	require.NoError(t, err)
+	frame := make([]byte, frameHeaderLen+len(encrypted))
+	binary.BigEndian.PutUint16(frame, uint16(len(encrypted)))
+	copy(frame[frameHeaderLen:], encrypted)
+
+	for _, split := range []int{1, frameHeaderLen + 5} {
+		// Only part of the frame arrives before the deadline fires.
+		_, err = client.underlying.Write(frame[:split])
+		require.NoError(t, err)
+		require.NoError(t, server.SetReadDeadline(time.Now().Add(50*time.Millisecond)))
+		_, err = server.Read(make([]byte, 64))
+		require.ErrorIs(t, err, os.ErrDeadlineExceeded)
+
+		// The rest of the frame completes it rather than starting a new one.
+		_, err = client.underlying.Write(frame[split:])
+		require.NoError(t, err)
+		require.NoError(t, server.SetReadDeadline(time.Now().Add(5*time.Second)))
+		buf := make([]byte, 64)
+		n, err := server.Read(buf)
+		require.NoError(t, err)
+		assert.Equal(t, "resumed after timeout", string(buf[:n]))
+
+		encrypted, err = client.encryptData(append([]byte{msgTypeData}, "resumed after timeout"...))
+		require.NoError(t, err)
+		copy(frame[frameHeaderLen:], encrypted)
+	}
+}
+
+func TestFrameReaderKeepsPartialFrame(t *testing.T) {
+	var buf bytes.Buffer
+	require.NoError(t, writeFrame(&buf, []byte("payload")))
+	wire := buf.Bytes()
+
+	var fr frameReader
+	for i := range wire[:len(wire)-1] {
+		timedOut := io.MultiReader(bytes.NewReader(wire[i:i+1]), iotest.ErrReader(os.ErrDeadlineExceeded))
+		_, err := fr.readFrame(timedOut)
+		require.ErrorIs(t, err, os.ErrDeadlineExceeded, "a frame split at byte %d is incomplete", i)
+	}
+	msg, err := fr.readFrame(bytes.NewReader(wire[len(wire)-1:]))
+	require.NoError(t, err)
+	assert.Equal(t, "payload", string(msg))
+
+	_, err = readFrame(bytes.NewReader(wire[:3]))
+	assert.ErrorIs(t, err, io.ErrUnexpectedEOF)
+}
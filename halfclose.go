@@ -0,0 +1,123 @@
+package noise
+
+import "github.com/samber/oops"
+
+// closeWriter is implemented by connections that can half-close their write
+// side, such as *net.TCPConn and *net.UnixConn.
+type closeWriter interface {
+	CloseWrite() error
+}
+
+// closeReader is implemented by connections that can half-close their read side.
+type closeReader interface {
+	CloseRead() error
+}
+
+// CloseWrite sends an authenticated end-of-stream message and then shuts down
+// the writing side of the underlying connection if it supports half-close.
+// The peer's Read returns io.EOF once it has read all data sent before the
+// end-of-stream message. A plain EOF from the transport without that message
+// is reported as a read error, so an attacker cannot truncate the stream.
+// Write fails with WRITE_CLOSED afterwards; reading is unaffected. Calling
+// CloseWrite again has no effect.
+//
+// The end-of-stream message requires MessageTypes. Without it CloseWrite only
+// half-closes the underlying connection, which must support half-close, and
+// the peer reads the transport's unauthenticated EOF.
+func (nc *NoiseConn) CloseWrite() error {
+	nc.writeMutex.Lock()
+	defer nc.writeMutex.Unlock()
+
+	if nc.writeClosed {
+		return nil
+	}
+
+	if err := nc.validateWriteState(); err != nil {
+		return err
+	}
+
+	if err := nc.configureWriteTimeout(); err != nil {
+		return err
+	}
+
+	if nc.config.MessageTypes {
+		if err := nc.sendEOF(); err != nil {
+			return err
+		}
+	} else if _, ok := nc.underlying.(closeWriter); !ok {
+		return messageTypesRequired("half-close over a transport without CloseWrite")
+	}
+	nc.writeClosed = true
+
+	if cw, ok := nc.underlying.(closeWriter); ok {
+		if err := cw.CloseWrite(); err != nil {
+			return oops.
+				Code("CLOSE_WRITE_FAILED").
+				In("noise").
+				With("remote_addr", nc.RemoteAddr().String()).
+				Wrapf(err, "failed to half-close underlying connection")
+		}
+	}
+
+	nc.logger.Debug("Write side closed")
+	return nil
+}
+
+// sendEOF writes the end-of-stream message. The caller must hold writeMutex.
+func (nc *NoiseConn) sendEOF() error {
+	encrypted, err := nc.encryptData([]byte{msgTypeEOF})
+	if err != nil {
+		return err
+	}
+
+	if err := writeFrame(nc.underlying, encrypted); err != nil {
+		return oops.
+			Code("CLOSE_WRITE_FAILED").
+			In("noise").
+			With("remote_addr", nc.RemoteAddr().String()).
+			Wrapf(err, "failed to send end-of-stream message")
+	}
+	return nil
+}
+
+// CloseRead shuts down the reading side of the connection. Read returns
+// io.EOF afterwards and any unread data is discarded. If the underlying
+// connection supports half-close its read side is shut down too, which also
+// unblocks a pending Read. Writing is unaffected.
+func (nc *NoiseConn) CloseRead() error {
+	if nc.isClosed() {
+		return oops.
+			Code("CONN_CLOSED").
+			In("noise").
+			With("state", nc.getState().String()).
+			Wrapf(ErrConnClosed, "connection is closed")
+	}
+
+	nc.stateMutex.Lock()
+	alreadyClosed := nc.readClosed
+	nc.readClosed = true
+	nc.stateMutex.Unlock()
+	if alreadyClosed {
+		return nil
+	}
+
+	if cr, ok := nc.underlying.(closeReader); ok {
+		if err := cr.CloseRead(); err != nil {
+			return oops.
+				Code("CLOSE_READ_FAILED").
+				In("noise").
+				With("remote_addr", nc.RemoteAddr().String()).
+				Wrapf(err, "failed to half-close underlying connection")
+		}
+	}
+
+	nc.logger.Debug("Read side closed")
+	return nil
+}
+
+// isReadClosed reports whether CloseRead has been called.
+func (nc *NoiseConn) isReadClosed() bool {
+	nc.stateMutex.RLock()
+	defer nc.stateMutex.RUnlock()
+	return nc.readClosed
+}
@@ -0,0 +1,160 @@
+package noise
+
+import (
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// establishTCPPair returns an NN NoiseConn pair with message types enabled,
+// connected over loopback TCP.
+func establishTCPPair(t *testing.T) (*NoiseConn, *NoiseConn) {
+	t.Helper()
+	return establishTCPPairWith(t, true)
+}
+
+// establishTCPPairWith returns an NN NoiseConn pair connected over loopback
+// TCP, with or without message types.
+func establishTCPPairWith(t *testing.T, messageTypes bool) (*NoiseConn, *NoiseConn) {
+	t.Helper()
+
+	tcpListener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	listener, err := NewNoiseListener(tcpListener, NewListenerConfig("NN").WithHandshakeTimeout(5*time.Second).WithMessageTypes(messageTypes))
+	require.NoError(t, err)
+	t.Cleanup(func() { listener.Close() })
+
+	accepted := make(chan *NoiseConn, 1)
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			accepted <- nil
+			return
+		}
+		nc := conn.(*NoiseConn)
+		if err := nc.Handshake(t.Context()); err != nil {
+			nc.Close()
+			nc = nil
+		}
+		accepted <- nc
+	}()
+
+	client, err := DialNoiseWithHandshake("tcp", tcpListener.Addr().String(), NewConnConfig("NN", true).WithMessageTypes(messageTypes))
+	require.NoError(t, err)
+	server := <-accepted
+	require.NotNil(t, server)
+	t.Cleanup(func() {
+		client.Close()
+		server.Close()
+	})
+	return client, server
+}
+
+func TestCloseWriteSignalsEOF(t *testing.T) {
+	for name, pair := range map[string]func(*testing.T) (*NoiseConn, *NoiseConn){
+		"pipe": func(t *testing.T) (*NoiseConn, *NoiseConn) {
+			return establishPair(t, NewConnConfig("NN", true).WithMessageTypes(true), NewConnConfig("NN", false).WithMessageTypes(true))
+		},
+		"tcp": establishTCPPair,
+	} {
+		t.Run(name, func(t *testing.T) {
+			client, server := pair(t)
+
+			go func() {
+				_, _ = client.Write([]byte("request"))
+				_ = client.CloseWrite()
+			}()
+			request, err := io.ReadAll(server)
+			require.NoError(t, err)
+			assert.Equal(t, "request", string(request))
+
+			_, err = server.Read(make([]byte, 1))
+			assert.Equal(t, io.EOF, err, "EOF is sticky")
+
+			go func() {
+				_, _ = server.Write([]byte("response"))
+				_ = server.CloseWrite()
+			}()
+			response, err := io.ReadAll(client)
+			require.NoError(t, err)
+			assert.Equal(t, "response", string(response))
+
+			_, err = client.Write([]byte("more"))
+			requireErrorCode(t, err, "WRITE_CLOSED")
+			assert.NoError(t, client.CloseWrite(), "CloseWrite is idempotent")
+		})
+	}
+}
+
+func TestTruncatedStreamIsNotEOF(t *testing.T) {
+	client, server := establishTCPPair(t)
+
+	go func() {
+		_, _ = client.Write([]byte("partial"))
+		_ = client.underlying.(*net.TCPConn).CloseWrite()
+	}()
+
+	buf := make([]byte, 7)
+	_, err := io.ReadFull(server, buf)
+	require.NoError(t, err)
+
+	_, err = server.Read(buf)
+	require.Error(t, err)
+	assert.NotEqual(t, io.EOF, err, "a transport EOF without the end-of-stream message is a truncation")
+	requireErrorCode(t, err, "UNDERLYING_READ_FAILED")
+}
+
+func TestCloseWriteWithoutMessageTypes(t *testing.T) {
+	client, server := establishTCPPairWith(t, false)
+
+	go func() {
+		_, _ = client.Write([]byte("request"))
+		_ = client.CloseWrite()
+	}()
+	request, err := io.ReadAll(server)
+	require.NoError(t, err, "the transport's EOF ends the stream")
+	assert.Equal(t, "request", string(request))
+
+	_, err = client.Write([]byte("more"))
+	requireErrorCode(t, err, "WRITE_CLOSED")
+	sendMessages(t, server, client, []string{"still writing"}, 0)
+
+	// Without an end-of-stream message a transport that cannot half-close
+	// has no way to signal EOF.
+	initiator, responder := establishPair(t, NewConnConfig("NN", true), NewConnConfig("NN", false))
+	defer responder.Close()
+	err = initiator.CloseWrite()
+	requireErrorCode(t, err, "MESSAGE_TYPES_REQUIRED")
+	assert.ErrorIs(t, err, ErrInvalidConfig)
+	sendMessages(t, initiator, responder, []string{"still open"}, 0)
+}
+
+func TestCloseReadUnblocksRead(t *testing.T) {
+	client, server := establishTCPPair(t)
+
+	readErr := make(chan error, 1)
+	go func() {
+		_, err := server.Read(make([]byte, 8))
+		readErr <- err
+	}()
+
+	time.Sleep(50 * time.Millisecond)
+	require.NoError(t, server.CloseRead())
+
+	select {
+	case err := <-readErr:
+		assert.Equal(t, io.EOF, err)
+	case <-time.After(2 * time.Second):
+		t.Fatal("Read was not unblocked by CloseRead")
+	}
+
+	_, err := server.Read(make([]byte, 8))
+	assert.Equal(t, io.EOF, err)
+
+	// The write side still works.
+	sendMessages(t, server, client, []string{"still writing"}, 0)
+}
@@ -1,6 +1,7 @@
 package handshake
 
 import (
+	"github.com/go-i2p/go-noise/internal"
 	"github.com/samber/oops"
 )
 
@@ -21,7 +22,7 @@ func NewPaddingModifier(name string, minPadding, maxPadding int) (*PaddingModifi
 			Code("INVALID_PADDING").
 			In("handshake").
 			With("min_padding", minPadding).
-			Errorf("minimum padding cannot be negative")
+			Wrapf(internal.ErrInvalidConfig, "minimum padding cannot be negative")
 	}
 
 	if maxPadding < minPadding {
@@ -30,7 +31,7 @@ func NewPaddingModifier(name string, minPadding, maxPadding int) (*PaddingModifi
 			In("handshake").
 			With("min_padding", minPadding).
 			With("max_padding", maxPadding).
-			Errorf("maximum padding cannot be less than minimum padding")
+			Wrapf(internal.ErrInvalidConfig, "maximum padding cannot be less than minimum padding")
 	}
 
 	return &PaddingModifier{
@@ -83,7 +84,7 @@ func (pm *PaddingModifier) ModifyInbound(phase HandshakePhase, data []byte) ([]b
 			In("handshake").
 			With("data_length", len(data)).
 			With("modifier_name", pm.name).
-			Errorf("padded data too short, missing length prefix")
+			Wrapf(internal.ErrProtocolViolation, "padded data too short, missing length prefix")
 	}
 
 	// Read original length from 4-byte big-endian prefix
@@ -96,7 +97,7 @@ func (pm *PaddingModifier) ModifyInbound(phase HandshakePhase, data []byte) ([]b
 			With("original_length", originalLen).
 			With("data_length", len(data)).
 			With("modifier_name", pm.name).
-			Errorf("invalid original length in padded data")
+			Wrapf(internal.ErrProtocolViolation, "invalid original length in padded data")
 	}
 
 	// Extract original data
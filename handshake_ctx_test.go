@@ -0,0 +1,136 @@
+package noise
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// silentPeer returns a conn whose peer reads everything and never responds.
+func silentPeer(t *testing.T) net.Conn {
+	t.Helper()
+	local, remote := net.Pipe()
+	go func() { _, _ = io.Copy(io.Discard, remote) }()
+	t.Cleanup(func() {
+		local.Close()
+		remote.Close()
+	})
+	return local
+}
+
+func TestHandshakeTimeoutWithSilentPeer(t *testing.T) {
+	for _, initiator := range []bool{true, false} {
+		config := NewConnConfig("XX", initiator).
+			WithStaticKey(newTestStaticKey(t)).
+			WithHandshakeTimeout(100 * time.Millisecond)
+		nc, err := NewNoiseConn(silentPeer(t), config)
+		require.NoError(t, err)
+
+		start := time.Now()
+		err = nc.Handshake(context.Background())
+		require.Error(t, err)
+		assert.True(t, errors.Is(err, context.DeadlineExceeded), "got %v", err)
+		assert.Less(t, time.Since(start), 2*time.Second)
+	}
+}
+
+func TestHandshakeCancelInterruptsRead(t *testing.T) {
+	config := NewConnConfig("XX", true).
+		WithStaticKey(newTestStaticKey(t)).
+		WithHandshakeTimeout(time.Minute)
+	nc, err := NewNoiseConn(silentPeer(t), config)
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(50*time.Millisecond, cancel)
+
+	start := time.Now()
+	err = nc.Handshake(ctx)
+	require.Error(t, err)
+	assert.True(t, errors.Is(err, context.Canceled), "got %v", err)
+	assert.Less(t, time.Since(start), 2*time.Second)
+	requireErrorCode(t, err, "HANDSHAKE_INTERRUPTED")
+}
+
+func TestHandshakeCancelOverTCP(t *testing.T) {
+	tcpListener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer tcpListener.Close()
+
+	go func() {
+		conn, err := tcpListener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		_, _ = io.Copy(io.Discard, conn)
+	}()
+
+	rawConn, err := net.Dial("tcp", tcpListener.Addr().String())
+	require.NoError(t, err)
+	nc, err := NewNoiseConn(rawConn, NewConnConfig("NN", true))
+	require.NoError(t, err)
+	defer nc.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	err = nc.Handshake(ctx)
+	assert.True(t, errors.Is(err, context.DeadlineExceeded), "got %v", err)
+	assert.Less(t, time.Since(start), 2*time.Second)
+}
+
+func TestHandshakeClearsDeadline(t *testing.T) {
+	initiator, responder := establishPair(t,
+		NewConnConfig("NN", true).WithHandshakeTimeout(200*time.Millisecond),
+		NewConnConfig("NN", false).WithHandshakeTimeout(200*time.Millisecond))
+
+	time.Sleep(300 * time.Millisecond)
+	sendMessages(t, initiator, responder, []string{"after the handshake deadline"}, 0)
+}
+
+func TestHandshakeRestoresCallerDeadline(t *testing.T) {
+	initiatorPipe, responderPipe := net.Pipe()
+	initiator, err := NewNoiseConn(initiatorPipe, NewConnConfig("NN", true))
+	require.NoError(t, err)
+	defer initiator.Close()
+	responder, err := NewNoiseConn(responderPipe, NewConnConfig("NN", false))
+	require.NoError(t, err)
+	defer responder.Close()
+
+	require.NoError(t, initiator.SetReadDeadline(time.Now().Add(300*time.Millisecond)))
+
+	errs := make(chan error, 1)
+	go func() { errs <- responder.Handshake(context.Background()) }()
+	require.NoError(t, initiator.Handshake(context.Background()))
+	require.NoError(t, <-errs)
+
+	start := time.Now()
+	_, err = initiator.Read(make([]byte, 16))
+	require.Error(t, err)
+	assert.True(t, errors.Is(err, os.ErrDeadlineExceeded), "got %v", err)
+	assert.Less(t, time.Since(start), 2*time.Second)
+}
+
+func TestHandshakeHonoursCallerDeadline(t *testing.T) {
+	config := NewConnConfig("XX", true).
+		WithStaticKey(newTestStaticKey(t)).
+		WithHandshakeTimeout(time.Minute)
+	nc, err := NewNoiseConn(silentPeer(t), config)
+	require.NoError(t, err)
+	require.NoError(t, nc.SetDeadline(time.Now().Add(100*time.Millisecond)))
+
+	start := time.Now()
+	err = nc.Handshake(context.Background())
+	require.Error(t, err)
+	assert.True(t, errors.Is(err, os.ErrDeadlineExceeded), "got %v", err)
+	assert.Less(t, time.Since(start), 2*time.Second)
+}
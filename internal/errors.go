@@ -0,0 +1,122 @@
+package internal
+
+import (
+	"errors"
+	"net"
+)
+
+// Error is a sentinel error category. Errors returned by the go-noise
+// packages wrap one so callers can match failures with errors.Is instead of
+// comparing oops codes. It implements net.Error.
+type Error struct {
+	msg     string
+	timeout bool
+	// also is a standard library error this category matches as well
+	also error
+}
+
+// Error implements the error interface.
+func (e *Error) Error() string {
+	return e.msg
+}
+
+// Timeout reports whether the error is a timeout.
+func (e *Error) Timeout() bool {
+	return e.timeout
+}
+
+// Temporary reports whether retrying may succeed. As in package net, only
+// timeouts are temporary.
+func (e *Error) Temporary() bool {
+	return e.timeout
+}
+
+// Is reports whether target is the standard library error this category
+// also matches, such as net.ErrClosed for closed connections.
+func (e *Error) Is(target error) bool {
+	return e.also != nil && target == e.also
+}
+
+// Sentinel errors shared by every go-noise package. The root package
+// re-exports them.
+var (
+	ErrConnClosed        = &Error{msg: "connection closed", also: net.ErrClosed}
+	ErrListenerClosed    = &Error{msg: "listener closed", also: net.ErrClosed}
+	ErrWriteClosed       = &Error{msg: "write side closed"}
+	ErrHandshakeNotDone  = &Error{msg: "handshake not complete"}
+	ErrHandshakeFailed   = &Error{msg: "handshake failed"}
+	ErrHandshakeTimeout  = &Error{msg: "handshake timed out", timeout: true}
+	ErrAuthFailed        = &Error{msg: "authentication failed"}
+	ErrPeerRejected      = &Error{msg: "peer rejected"}
+	ErrPeerTimeout       = &Error{msg: "peer timed out", timeout: true}
+	ErrMessageTooLarge   = &Error{msg: "message too large"}
+	ErrNonceExhausted    = &Error{msg: "nonce space exhausted"}
+	ErrProtocolViolation = &Error{msg: "protocol violation"}
+	ErrInvalidConfig     = &Error{msg: "invalid configuration"}
+	ErrShutdownTimeout   = &Error{msg: "shutdown timed out", timeout: true}
+)
+
+// markedError attaches a sentinel to an error without changing its message.
+type markedError struct {
+	err      error
+	sentinel error
+}
+
+func (e *markedError) Error() string {
+	return e.err.Error()
+}
+
+func (e *markedError) Unwrap() []error {
+	return []error{e.err, e.sentinel}
+}
+
+// Mark returns err marked with sentinel, so the result matches both with
+// errors.Is and keeps err's message. It returns nil if err is nil.
+func Mark(err, sentinel error) error {
+	if err == nil {
+		return nil
+	}
+	return &markedError{err: err, sentinel: sentinel}
+}
+
+// netError exposes the net.Error found in an error chain on the outermost
+// error, for callers that type-assert net.Error rather than use errors.As.
+type netError struct {
+	err error
+	ne  net.Error
+}
+
+func (e *netError) Error() string {
+	return e.err.Error()
+}
+
+func (e *netError) Unwrap() error {
+	return e.err
+}
+
+func (e *netError) Timeout() bool {
+	return e.ne.Timeout()
+}
+
+func (e *netError) Temporary() bool {
+	return e.ne.Temporary()
+}
+
+// NetError returns err such that a type assertion to net.Error succeeds
+// whenever a net.Error is wrapped anywhere in its chain. Accept loops such
+// as http.Server's rely on that assertion to retry temporary failures.
+// Errors without a net.Error in their chain, such as io.EOF, are returned
+// unchanged.
+func NetError(err error) error {
+	if err == nil {
+		return nil
+	}
+	if _, ok := err.(net.Error); ok {
+		return err
+	}
+	var ne net.Error
+	if !errors.As(err, &ne) {
+		return err
+	}
+	return &netError{err: err, ne: ne}
+}
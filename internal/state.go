@@ -43,6 +43,9 @@ type ConnectionMetrics struct {
 	BytesRead        int64
 	BytesWritten     int64
 	Created          time.Time
+
+	KeepalivesSent     int64
+	KeepalivesReceived int64
 }
 
 // NewConnectionMetrics creates a new ConnectionMetrics instance
@@ -97,3 +100,24 @@ func (m *ConnectionMetrics) GetStats() (bytesRead, bytesWritten int64, duration
 	defer m.mu.RUnlock()
 	return m.BytesRead, m.BytesWritten, m.HandshakeDuration()
 }
+
+// AddKeepaliveSent increments the keepalives sent counter
+func (m *ConnectionMetrics) AddKeepaliveSent() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.KeepalivesSent++
+}
+
+// AddKeepaliveReceived increments the keepalives received counter
+func (m *ConnectionMetrics) AddKeepaliveReceived() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.KeepalivesReceived++
+}
+
+// GetKeepaliveStats returns the keepalive counters
+func (m *ConnectionMetrics) GetKeepaliveStats() (sent, received int64) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.KeepalivesSent, m.KeepalivesReceived
+}
@@ -1,6 +1,7 @@
 package internal
 
 import (
+	"crypto/ecdh"
 	"crypto/rand"
 	"io"
 )
@@ -25,3 +26,12 @@ func RandomBytes(n int) ([]byte, error) {
 func ValidateKeySize(key []byte, expectedSize int) bool {
 	return len(key) == expectedSize
 }
+
+// X25519PublicKey derives the Curve25519 public key for the given private key
+func X25519PublicKey(privateKey []byte) ([]byte, error) {
+	key, err := ecdh.X25519().NewPrivateKey(privateKey)
+	if err != nil {
+		return nil, err
+	}
+	return key.PublicKey().Bytes(), nil
+}
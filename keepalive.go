@@ -0,0 +1,168 @@
+package noise
+
+import (
+	"errors"
+	"os"
+	"time"
+
+	"github.com/samber/oops"
+	"github.com/sirupsen/logrus"
+)
+
+// startKeepalive starts sending keepalives once the handshake has completed,
+// if KeepaliveInterval is set. The sender stops when the connection closes.
+func (nc *NoiseConn) startKeepalive() {
+	interval := nc.config.KeepaliveInterval
+	if interval <= 0 {
+		return
+	}
+
+	nc.closeMutex.Lock()
+	defer nc.closeMutex.Unlock()
+	if nc.isClosed() || nc.keepaliveDone != nil {
+		return
+	}
+	nc.keepaliveDone = make(chan struct{})
+
+	go nc.keepaliveLoop(interval, nc.keepaliveDone)
+}
+
+// stopKeepalive stops the keepalive sender. The caller must hold closeMutex.
+func (nc *NoiseConn) stopKeepalive() {
+	if nc.keepaliveDone != nil {
+		close(nc.keepaliveDone)
+	}
+}
+
+// keepaliveLoop sends a keepalive whenever the send side has been idle for a
+// full interval, until done is closed or sending fails.
+func (nc *NoiseConn) keepaliveLoop(interval time.Duration, done <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+			if err := nc.sendKeepalive(interval); err != nil {
+				nc.logger.WithFields(logrus.Fields{
+					"error": err.Error(),
+				}).Debug("Keepalive sender stopped")
+				return
+			}
+		}
+	}
+}
+
+// sendKeepalive sends an authenticated empty transport message unless
+// something else was sent within the last interval. It skips the tick if a
+// Write is in progress, since that write keeps the peer's Read alive anyway.
+func (nc *NoiseConn) sendKeepalive(interval time.Duration) error {
+	if !nc.writeMutex.TryLock() {
+		return nil
+	}
+	defer nc.writeMutex.Unlock()
+
+	if time.Since(nc.lastSend) < interval {
+		return nil
+	}
+
+	if err := nc.validateWriteState(); err != nil {
+		return err
+	}
+
+	if err := nc.configureWriteTimeout(); err != nil {
+		return err
+	}
+
+	if err := nc.rekeyIfDue(); err != nil {
+		return err
+	}
+
+	encrypted, err := nc.encryptData(nil)
+	if err != nil {
+		return err
+	}
+
+	if err := writeFrame(nc.underlying, encrypted); err != nil {
+		return oops.
+			Code("KEEPALIVE_FAILED").
+			In("noise").
+			With("remote_addr", nc.RemoteAddr().String()).
+			Wrapf(err, "failed to send keepalive")
+	}
+	nc.rekey.recordSent(0)
+	nc.lastSend = time.Now()
+	nc.metrics.AddKeepaliveSent()
+
+	nc.logger.Trace("Keepalive sent")
+	return nil
+}
+
+// readLimit returns the earliest read deadline requested by the caller or by
+// ReadTimeout for the current Read, or the zero time if there is none.
+func (nc *NoiseConn) readLimit() time.Time {
+	nc.stateMutex.RLock()
+	limit := nc.readDeadline
+	nc.stateMutex.RUnlock()
+
+	if nc.config.ReadTimeout > 0 {
+		timeout := time.Now().Add(nc.config.ReadTimeout)
+		if limit.IsZero() || timeout.Before(limit) {
+			limit = timeout
+		}
+	}
+	return limit
+}
+
+// armPeerTimeout sets the read deadline for the next frame so that Read fails
+// if the peer stays silent for KeepaliveTimeout, without extending limit.
+// It returns the peer deadline, or the zero time if the timeout is disabled.
+func (nc *NoiseConn) armPeerTimeout(limit time.Time) (time.Time, error) {
+	if nc.config.KeepaliveTimeout <= 0 {
+		return time.Time{}, nil
+	}
+
+	peerDeadline := time.Now().Add(nc.config.KeepaliveTimeout)
+	deadline := peerDeadline
+	if !limit.IsZero() && limit.Before(peerDeadline) {
+		deadline = limit
+	}
+
+	if err := nc.underlying.SetReadDeadline(deadline); err != nil {
+		return time.Time{}, oops.
+			Code("SET_DEADLINE_FAILED").
+			In("noise").
+			With("timeout", nc.config.KeepaliveTimeout).
+			Wrapf(err, "failed to set keepalive read deadline")
+	}
+	return peerDeadline, nil
+}
+
+// isPeerTimeout reports whether a read error was caused by the peer deadline
+// rather than by a deadline the caller asked for.
+func isPeerTimeout(err error, peerDeadline, limit time.Time) bool {
+	if peerDeadline.IsZero() || !errors.Is(err, os.ErrDeadlineExceeded) {
+		return false
+	}
+	return limit.IsZero() || peerDeadline.Before(limit)
+}
+
+// peerTimedOut closes the connection after the peer went silent and returns
+// the PEER_TIMEOUT error reported by Read.
+func (nc *NoiseConn) peerTimedOut() error {
+	nc.logger.WithFields(logrus.Fields{
+		"timeout":     nc.config.KeepaliveTimeout,
+		"remote_addr": nc.RemoteAddr().String(),
+	}).Debug("Peer timed out")
+
+	_ = nc.Close()
+
+	return oops.
+		Code("PEER_TIMEOUT").
+		In("noise").
+		With("timeout", nc.config.KeepaliveTimeout).
+		With("remote_addr", nc.RemoteAddr().String()).
+		Wrapf(ErrPeerTimeout, "no message received from peer within %s", nc.config.KeepaliveTimeout)
+}
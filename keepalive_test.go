@@ -0,0 +1,168 @@
+package noise
+
+import (
+	"errors"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/go-i2p/go-noise/internal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// readResult carries the outcome of a Read run in a goroutine.
+type readResult struct {
+	data string
+	err  error
+}
+
+// readAsync starts a Read on conn and returns a channel for its result.
+func readAsync(conn *NoiseConn) <-chan readResult {
+	results := make(chan readResult, 1)
+	go func() {
+		buf := make([]byte, 64)
+		n, err := conn.Read(buf)
+		results <- readResult{data: string(buf[:n]), err: err}
+	}()
+	return results
+}
+
+func TestKeepalivesAreSwallowedAndCounted(t *testing.T) {
+	initiator, responder := establishPair(t,
+		NewConnConfig("NN", true).WithMessageTypes(true).WithKeepalive(10*time.Millisecond, 0),
+		NewConnConfig("NN", false).WithMessageTypes(true))
+	defer initiator.Close()
+	defer responder.Close()
+
+	results := readAsync(responder)
+
+	require.Eventually(t, func() bool {
+		return responder.Snapshot().KeepalivesReceived >= 3
+	}, 2*time.Second, 5*time.Millisecond, "idle connection should carry keepalives")
+
+	select {
+	case res := <-results:
+		t.Fatalf("Read returned before any data was sent: %q, %v", res.data, res.err)
+	default:
+	}
+
+	_, err := initiator.Write([]byte("after idle"))
+	require.NoError(t, err)
+
+	res := <-results
+	require.NoError(t, res.err)
+	assert.Equal(t, "after idle", res.data)
+
+	sent := initiator.Snapshot().KeepalivesSent
+	assert.GreaterOrEqual(t, sent, int64(3))
+	assert.Zero(t, responder.Snapshot().KeepalivesSent)
+
+	bytesRead, _, _ := responder.GetConnectionMetrics()
+	assert.Equal(t, int64(len("after idle")), bytesRead, "keepalives carry no application data")
+}
+
+func TestKeepalivesKeepIdleConnectionOpen(t *testing.T) {
+	initiator, responder := establishPair(t,
+		NewConnConfig("NN", true).WithMessageTypes(true).WithKeepalive(10*time.Millisecond, 0),
+		NewConnConfig("NN", false).WithMessageTypes(true).WithKeepalive(0, 100*time.Millisecond))
+	defer initiator.Close()
+	defer responder.Close()
+
+	results := readAsync(responder)
+	time.Sleep(400 * time.Millisecond)
+
+	_, err := initiator.Write([]byte("still here"))
+	require.NoError(t, err)
+
+	res := <-results
+	require.NoError(t, res.err, "keepalives should reset the peer timeout")
+	assert.Equal(t, "still here", res.data)
+	assert.Equal(t, internal.StateEstablished, responder.GetConnectionState())
+}
+
+func TestKeepaliveTimeoutClosesSilentPeer(t *testing.T) {
+	initiator, responder := establishPair(t,
+		NewConnConfig("NN", true).WithMessageTypes(true),
+		NewConnConfig("NN", false).WithMessageTypes(true).WithKeepalive(0, 50*time.Millisecond))
+	defer initiator.Close()
+
+	start := time.Now()
+	_, err := responder.Read(make([]byte, 16))
+	requireErrorCode(t, err, "PEER_TIMEOUT")
+	assert.GreaterOrEqual(t, time.Since(start), 50*time.Millisecond)
+	assert.Equal(t, internal.StateClosed, responder.GetConnectionState())
+
+	_, err = responder.Write([]byte("too late"))
+	requireErrorCode(t, err, "CONN_CLOSED")
+}
+
+func TestKeepaliveTimeoutRespectsCallerDeadline(t *testing.T) {
+	initiator, responder := establishPair(t,
+		NewConnConfig("NN", true).WithMessageTypes(true),
+		NewConnConfig("NN", false).WithMessageTypes(true).WithKeepalive(0, 5*time.Second))
+	defer initiator.Close()
+	defer responder.Close()
+
+	require.NoError(t, responder.SetReadDeadline(time.Now().Add(30*time.Millisecond)))
+
+	_, err := responder.Read(make([]byte, 16))
+	require.Error(t, err)
+	assert.True(t, errors.Is(err, os.ErrDeadlineExceeded), "caller deadline should fire first: %v", err)
+	assert.Equal(t, internal.StateEstablished, responder.GetConnectionState())
+}
+
+func TestKeepaliveSenderStopsOnClose(t *testing.T) {
+	initiator, responder := establishPair(t,
+		NewConnConfig("NN", true).WithMessageTypes(true).WithKeepalive(5*time.Millisecond, 0),
+		NewConnConfig("NN", false).WithMessageTypes(true))
+	defer responder.Close()
+
+	results := readAsync(responder)
+	require.Eventually(t, func() bool {
+		return initiator.Snapshot().KeepalivesSent > 0
+	}, 2*time.Second, 5*time.Millisecond)
+
+	require.NoError(t, initiator.Close())
+	<-results
+
+	sent := initiator.Snapshot().KeepalivesSent
+	time.Sleep(30 * time.Millisecond)
+	assert.Equal(t, sent, initiator.Snapshot().KeepalivesSent)
+}
+
+func TestKeepaliveValidation(t *testing.T) {
+	tests := []struct {
+		name     string
+		interval time.Duration
+		timeout  time.Duration
+		wantErr  bool
+	}{
+		{"disabled", 0, 0, false},
+		{"interval only", time.Second, 0, false},
+		{"timeout only", 0, time.Second, false},
+		{"both", time.Second, 3 * time.Second, false},
+		{"negative interval", -time.Second, 0, true},
+		{"negative timeout", 0, -time.Second, true},
+		{"timeout not longer than interval", time.Second, time.Second, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			connErr := NewConnConfig("NN", true).WithMessageTypes(true).WithKeepalive(tt.interval, tt.timeout).Validate()
+			listenerErr := NewListenerConfig("NN").WithMessageTypes(true).WithKeepalive(tt.interval, tt.timeout).Validate()
+			if tt.wantErr {
+				requireErrorCode(t, connErr, "INVALID_KEEPALIVE")
+				requireErrorCode(t, listenerErr, "INVALID_KEEPALIVE")
+				return
+			}
+			assert.NoError(t, connErr)
+			assert.NoError(t, listenerErr)
+		})
+	}
+
+	// Keepalives are signalled with the typed envelope.
+	requireErrorCode(t, NewConnConfig("NN", true).WithKeepalive(time.Second, 0).Validate(), "MESSAGE_TYPES_REQUIRED")
+	requireErrorCode(t, NewListenerConfig("NN").WithKeepalive(time.Second, 0).Validate(), "MESSAGE_TYPES_REQUIRED")
+	assert.NoError(t, NewConnConfig("NN", true).WithKeepalive(0, time.Second).Validate(), "a peer timeout needs no signalling")
+}
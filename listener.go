@@ -5,6 +5,7 @@ import (
 	"sync"
 	"time"
 
+	"github.com/go-i2p/go-noise/internal"
 	"github.com/go-i2p/logger"
 	"github.com/samber/oops"
 	"github.com/sirupsen/logrus"
@@ -42,12 +43,46 @@ type NoiseListener struct {
 // ListenerConfig contains configuration for creating a NoiseListener.
 // It follows the builder pattern for optional configuration and validation.
 type ListenerConfig struct {
-	// Pattern is the Noise protocol pattern (e.g., "Noise_XX_25519_AESGCM_SHA256")
+	// Pattern is the Noise protocol name (e.g., "Noise_XX_25519_ChaChaPoly_BLAKE2s").
+	// A bare pattern such as "XX" uses the default 25519_AESGCM_SHA256 suite.
 	Pattern string
 
 	// StaticKey is the long-term static key for this listener (32 bytes for Curve25519)
 	StaticKey []byte
 
+	// RemoteKey is the initiator's static public key for patterns where the
+	// responder knows it in advance, e.g. "KK" or "K1N" (optional)
+	RemoteKey []byte
+
+	// PresharedKey is the optional symmetric key for pskN patterns (32 bytes)
+	PresharedKey []byte
+
+	// PresharedKeyPlacement is the pskN modifier position for PresharedKey
+	PresharedKeyPlacement int
+
+	// Prologue is optional data bound into the handshake hash of accepted connections
+	Prologue []byte
+
+	// NoisePipes answers failed IK first messages with XXfallback instead of failing
+	NoisePipes bool
+
+	// RekeyPolicy triggers automatic send cipher rekeying on accepted
+	// connections; it requires MessageTypes
+	RekeyPolicy RekeyPolicy
+
+	// MessageTypes enables the typed transport envelope on accepted
+	// connections; see ConnConfig.MessageTypes. Default: false
+	MessageTypes bool
+
+	// HandshakePayloadProvider supplies handshake payloads for accepted connections (optional)
+	HandshakePayloadProvider func(msgIndex int) []byte
+
+	// HandshakePayloadHandler receives handshake payloads on accepted connections (optional)
+	HandshakePayloadHandler func(payload HandshakePayload) error
+
+	// VerifyPeer authorizes each initiator's static key during the handshake (optional)
+	VerifyPeer func(remoteStatic []byte, payload []byte) error
+
 	// HandshakeTimeout is the maximum time to wait for handshake completion
 	// Default: 30 seconds
 	HandshakeTimeout time.Duration
@@ -59,6 +94,14 @@ type ListenerConfig struct {
 	// WriteTimeout is the timeout for write operations after handshake
 	// Default: no timeout (0)
 	WriteTimeout time.Duration
+
+	// KeepaliveInterval and KeepaliveTimeout configure keepalives on accepted
+	// connections; sending them requires MessageTypes. Default: disabled (0)
+	KeepaliveInterval time.Duration
+	KeepaliveTimeout  time.Duration
+
+	// keyPairErr is set when WithKeyPair was given a nil keypair
+	keyPairErr error
 }
 
 // NewListenerConfig creates a new ListenerConfig with sensible defaults.
@@ -78,6 +121,81 @@ func (lc *ListenerConfig) WithStaticKey(key []byte) *ListenerConfig {
 	return lc
 }
 
+// WithKeyPair sets the listener's static key from a keypair.
+// A nil keypair makes Validate fail.
+func (lc *ListenerConfig) WithKeyPair(kp *KeyPair) *ListenerConfig {
+	if lc.keyPairErr = nilKeyPairError(kp); lc.keyPairErr != nil {
+		return lc
+	}
+	lc.StaticKey = make([]byte, len(kp.Private))
+	copy(lc.StaticKey, kp.Private)
+	return lc
+}
+
+// WithRemoteKey sets the static public key every accepted initiator must
+// present. It is only needed for patterns with an initiator pre-message.
+func (lc *ListenerConfig) WithRemoteKey(key []byte) *ListenerConfig {
+	lc.RemoteKey = make([]byte, len(key))
+	copy(lc.RemoteKey, key)
+	return lc
+}
+
+// WithPresharedKey sets the pre-shared symmetric key and its pskN placement
+// for accepted connections. key must be 32 bytes.
+func (lc *ListenerConfig) WithPresharedKey(key []byte, placement int) *ListenerConfig {
+	lc.PresharedKey = make([]byte, len(key))
+	copy(lc.PresharedKey, key)
+	lc.PresharedKeyPlacement = placement
+	return lc
+}
+
+// WithPrologue sets the prologue bound into the handshake hash of accepted
+// connections. Dialing peers must supply an identical prologue.
+func (lc *ListenerConfig) WithPrologue(prologue []byte) *ListenerConfig {
+	lc.Prologue = make([]byte, len(prologue))
+	copy(lc.Prologue, prologue)
+	return lc
+}
+
+// WithHandshakePayloadProvider sets the handshake payload provider for accepted connections.
+func (lc *ListenerConfig) WithHandshakePayloadProvider(provider func(msgIndex int) []byte) *ListenerConfig {
+	lc.HandshakePayloadProvider = provider
+	return lc
+}
+
+// WithHandshakePayloadHandler sets the handshake payload callback for accepted connections.
+func (lc *ListenerConfig) WithHandshakePayloadHandler(handler func(payload HandshakePayload) error) *ListenerConfig {
+	lc.HandshakePayloadHandler = handler
+	return lc
+}
+
+// WithVerifyPeer sets the callback that authorizes each initiator's static
+// key. A rejected initiator's handshake fails with PEER_REJECTED.
+func (lc *ListenerConfig) WithVerifyPeer(verify func(remoteStatic []byte, payload []byte) error) *ListenerConfig {
+	lc.VerifyPeer = verify
+	return lc
+}
+
+// WithNoisePipes enables Noise Pipes on accepted connections: an IK first
+// message that cannot be decrypted, e.g. because the client cached an old
+// static key, is answered with an XXfallback handshake.
+func (lc *ListenerConfig) WithNoisePipes(enabled bool) *ListenerConfig {
+	lc.NoisePipes = enabled
+	return lc
+}
+
+// WithRekeyPolicy sets the automatic rekey policy for accepted connections.
+func (lc *ListenerConfig) WithRekeyPolicy(policy RekeyPolicy) *ListenerConfig {
+	lc.RekeyPolicy = policy
+	return lc
+}
+
+// WithMessageTypes enables the typed transport envelope on accepted connections.
+func (lc *ListenerConfig) WithMessageTypes(enabled bool) *ListenerConfig {
+	lc.MessageTypes = enabled
+	return lc
+}
+
 // WithHandshakeTimeout sets the handshake timeout.
 func (lc *ListenerConfig) WithHandshakeTimeout(timeout time.Duration) *ListenerConfig {
 	lc.HandshakeTimeout = timeout
@@ -96,21 +214,51 @@ func (lc *ListenerConfig) WithWriteTimeout(timeout time.Duration) *ListenerConfi
 	return lc
 }
 
+// WithKeepalive sets the keepalive interval and peer timeout for accepted connections.
+func (lc *ListenerConfig) WithKeepalive(interval, timeout time.Duration) *ListenerConfig {
+	lc.KeepaliveInterval = interval
+	lc.KeepaliveTimeout = timeout
+	return lc
+}
+
 // Validate checks if the configuration is valid.
 func (lc *ListenerConfig) Validate() error {
+	if lc.keyPairErr != nil {
+		return lc.keyPairErr
+	}
+
 	if lc.Pattern == "" {
 		return oops.
 			Code("INVALID_PATTERN").
 			In("noise").
-			Errorf("noise pattern is required")
+			Wrapf(ErrInvalidConfig, "noise pattern is required")
 	}
 
-	if _, err := parseHandshakePattern(lc.Pattern); err != nil {
+	if len(lc.PresharedKey) > 0 && len(lc.PresharedKey) != 32 {
+		return oops.
+			Code("INVALID_KEY_LENGTH").
+			In("noise").
+			With("key_length", len(lc.PresharedKey)).
+			With("pattern", lc.Pattern).
+			Wrapf(ErrInvalidConfig, "pre-shared key must be 32 bytes")
+	}
+
+	if _, err := resolveProtocol(lc.Pattern, lc.PresharedKey, lc.PresharedKeyPlacement); err != nil {
 		return oops.
 			Code("INVALID_PATTERN").
 			In("noise").
 			With("pattern", lc.Pattern).
-			Wrapf(err, "invalid noise pattern")
+			Wrapf(internal.Mark(err, ErrInvalidConfig), "invalid noise pattern")
+	}
+
+	if lc.NoisePipes {
+		if p, err := parseProtocolName(lc.Pattern); err != nil || p.Pattern.Name != "IK" || p.PSKPlacement >= 0 || len(lc.PresharedKey) > 0 {
+			return oops.
+				Code("INVALID_PATTERN").
+				In("noise").
+				With("pattern", lc.Pattern).
+				Wrapf(ErrInvalidConfig, "noise pipes requires the IK pattern without a pre-shared key")
+		}
 	}
 
 	if len(lc.StaticKey) > 0 && len(lc.StaticKey) != 32 {
@@ -119,7 +267,16 @@ func (lc *ListenerConfig) Validate() error {
 			In("noise").
 			With("key_length", len(lc.StaticKey)).
 			With("pattern", lc.Pattern).
-			Errorf("static key must be 32 bytes")
+			Wrapf(ErrInvalidConfig, "static key must be 32 bytes")
+	}
+
+	if len(lc.RemoteKey) > 0 && len(lc.RemoteKey) != 32 {
+		return oops.
+			Code("INVALID_KEY_LENGTH").
+			In("noise").
+			With("key_length", len(lc.RemoteKey)).
+			With("pattern", lc.Pattern).
+			Wrapf(ErrInvalidConfig, "remote key must be 32 bytes")
 	}
 
 	if lc.HandshakeTimeout <= 0 {
@@ -128,7 +285,15 @@ func (lc *ListenerConfig) Validate() error {
 			In("noise").
 			With("timeout", lc.HandshakeTimeout).
 			With("pattern", lc.Pattern).
-			Errorf("handshake timeout must be positive")
+			Wrapf(ErrInvalidConfig, "handshake timeout must be positive")
+	}
+
+	if err := validateKeepalive(lc.KeepaliveInterval, lc.KeepaliveTimeout); err != nil {
+		return err
+	}
+
+	if err := validateMessageTypes(lc.MessageTypes, lc.RekeyPolicy, lc.KeepaliveInterval); err != nil {
+		return err
 	}
 
 	return nil
@@ -139,11 +304,17 @@ func (lc *ListenerConfig) Validate() error {
 // configured as responders (non-initiators) using the provided configuration.
 func NewNoiseListener(underlying net.Listener, config *ListenerConfig) (*NoiseListener, error) {
 	if underlying == nil {
-		return nil, oops.Errorf("underlying listener cannot be nil")
+		return nil, oops.
+			Code("INVALID_LISTENER").
+			In("noise").
+			Wrapf(ErrInvalidConfig, "underlying listener cannot be nil")
 	}
 
 	if config == nil {
-		return nil, oops.Errorf("listener config cannot be nil")
+		return nil, oops.
+			Code("INVALID_CONFIG").
+			In("noise").
+			Wrapf(ErrInvalidConfig, "listener config cannot be nil")
 	}
 
 	if err := config.Validate(); err != nil {
@@ -151,11 +322,12 @@ func NewNoiseListener(underlying net.Listener, config *ListenerConfig) (*NoiseLi
 			Code("INVALID_CONFIG").
 			In("noise").
 			With("listener_addr", underlying.Addr().String()).
-			Wrapf(err, "invalid listener configuration")
+			Wrapf(internal.Mark(err, ErrInvalidConfig), "invalid listener configuration")
 	}
 
 	// Create Noise address for this listener
-	addr := NewNoiseAddr(underlying.Addr(), config.Pattern, "responder")
+	name := protocolName(config.Pattern, config.PresharedKey, config.PresharedKeyPlacement)
+	addr := NewNoiseAddr(underlying.Addr(), name, "responder")
 
 	nl := &NoiseListener{
 		underlying: underlying,
@@ -177,6 +349,12 @@ func NewNoiseListener(underlying net.Listener, config *ListenerConfig) (*NoiseLi
 // Accept waits for and returns the next connection to the listener.
 // The returned connection is wrapped in a NoiseConn configured as a responder.
 func (nl *NoiseListener) Accept() (net.Conn, error) {
+	conn, err := nl.accept()
+	return conn, internal.NetError(err)
+}
+
+// accept implements Accept.
+func (nl *NoiseListener) accept() (net.Conn, error) {
 	nl.acceptMutex.Lock()
 	defer nl.acceptMutex.Unlock()
 
@@ -185,7 +363,7 @@ func (nl *NoiseListener) Accept() (net.Conn, error) {
 			Code("LISTENER_CLOSED").
 			In("noise").
 			With("listener_addr", nl.addr.String()).
-			Errorf("listener is closed")
+			Wrapf(ErrListenerClosed, "listener is closed")
 	}
 
 	// Accept the underlying connection
@@ -203,7 +381,23 @@ func (nl *NoiseListener) Accept() (net.Conn, error) {
 								WithStaticKey(nl.config.StaticKey).
 								WithHandshakeTimeout(nl.config.HandshakeTimeout).
 								WithReadTimeout(nl.config.ReadTimeout).
-								WithWriteTimeout(nl.config.WriteTimeout)
+								WithWriteTimeout(nl.config.WriteTimeout).
+								WithKeepalive(nl.config.KeepaliveInterval, nl.config.KeepaliveTimeout)
+	if len(nl.config.RemoteKey) > 0 {
+		connConfig = connConfig.WithRemoteKey(nl.config.RemoteKey)
+	}
+	if len(nl.config.PresharedKey) > 0 {
+		connConfig = connConfig.WithPresharedKey(nl.config.PresharedKey, nl.config.PresharedKeyPlacement)
+	}
+	if len(nl.config.Prologue) > 0 {
+		connConfig = connConfig.WithPrologue(nl.config.Prologue)
+	}
+	connConfig.NoisePipes = nl.config.NoisePipes
+	connConfig.RekeyPolicy = nl.config.RekeyPolicy
+	connConfig.MessageTypes = nl.config.MessageTypes
+	connConfig.HandshakePayloadProvider = nl.config.HandshakePayloadProvider
+	connConfig.HandshakePayloadHandler = nl.config.HandshakePayloadHandler
+	connConfig.VerifyPeer = nl.config.VerifyPeer
 
 	// Wrap in NoiseConn
 	noiseConn, err := NewNoiseConn(underlying, connConfig)
@@ -193,6 +193,7 @@ func TestNewNoiseListener(t *testing.T) {
 
 			if tt.expectError {
 				assert.Error(t, err)
+				assert.ErrorIs(t, err, ErrInvalidConfig)
 				assert.Nil(t, listener)
 				if tt.errorType != "" {
 					assert.Contains(t, err.Error(), tt.errorType)
@@ -0,0 +1,135 @@
+package noise
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/go-i2p/go-noise/internal"
+	"github.com/samber/oops"
+	"github.com/sirupsen/logrus"
+)
+
+// MaxMessageSize is the largest message WriteMessage accepts. A Noise
+// transport message is limited to 65535 bytes, which must also hold the
+// 16-byte authentication tag and a one-byte message type.
+const MaxMessageSize = maxDataLen
+
+// MessageTooLargeError reports a message that does not fit in a single Noise
+// transport message. WriteMessage returns it wrapped in a MESSAGE_TOO_LARGE
+// error, so use errors.As to retrieve it. It matches ErrMessageTooLarge.
+type MessageTooLargeError struct {
+	// Size is the length of the rejected message
+	Size int
+}
+
+// Error implements the error interface.
+func (e *MessageTooLargeError) Error() string {
+	return fmt.Sprintf("message of %d bytes exceeds the %d byte limit", e.Size, MaxMessageSize)
+}
+
+// Is reports whether target is ErrMessageTooLarge.
+func (e *MessageTooLargeError) Is(target error) bool {
+	return target == ErrMessageTooLarge
+}
+
+// WriteMessage sends msg as exactly one Noise transport message, so the
+// peer's ReadMessage returns it whole. msg may be empty but must not exceed
+// MaxMessageSize.
+//
+// WriteMessage and Write produce the same data messages and may be mixed on
+// one connection: Write sends each chunk of up to MaxMessageSize bytes as
+// its own message. Like Write, WriteMessage may be called concurrently with
+// the read methods.
+func (nc *NoiseConn) WriteMessage(msg []byte) error {
+	return internal.NetError(nc.writeMessage(msg))
+}
+
+// writeMessage implements WriteMessage.
+func (nc *NoiseConn) writeMessage(msg []byte) error {
+	if len(msg) > MaxMessageSize {
+		return oops.
+			Code("MESSAGE_TOO_LARGE").
+			In("noise").
+			With("message_len", len(msg)).
+			With("max_message_len", MaxMessageSize).
+			Wrapf(&MessageTooLargeError{Size: len(msg)}, "message does not fit in one transport message")
+	}
+
+	nc.writeMutex.Lock()
+	defer nc.writeMutex.Unlock()
+
+	if err := nc.validateWriteState(); err != nil {
+		return err
+	}
+
+	if err := nc.configureWriteTimeout(); err != nil {
+		return err
+	}
+
+	return nc.writeDataMessage(msg)
+}
+
+// ReadMessage returns the data of the next Noise transport message, so
+// message boundaries set by the peer's WriteMessage are preserved. Empty
+// messages are returned as empty, non-nil slices. It returns io.EOF after
+// the peer's CloseWrite and a *RemoteCloseError after CloseWithReason.
+//
+// ReadMessage and Read share one receive buffer and may be mixed: if a Read
+// left part of a message unread, the next ReadMessage returns that remainder
+// rather than a whole message. Boundaries only match what the peer sent when
+// its data is written with WriteMessage, or with Writes of at most
+// MaxMessageSize bytes.
+func (nc *NoiseConn) ReadMessage() ([]byte, error) {
+	msg, err := nc.readMessage()
+	return msg, internal.NetError(err)
+}
+
+// readMessage implements ReadMessage.
+func (nc *NoiseConn) readMessage() ([]byte, error) {
+	nc.readMutex.Lock()
+	defer nc.readMutex.Unlock()
+
+	if err := nc.validateReadState(); err != nil {
+		return nil, err
+	}
+
+	if nc.isReadClosed() {
+		return nil, io.EOF
+	}
+
+	if len(nc.pendingPlaintext) > 0 {
+		return nc.takeMessage(nc.pendingPlaintext), nil
+	}
+
+	if nc.eofReceived {
+		return nil, io.EOF
+	}
+
+	if nc.remoteClose != nil {
+		return nil, nc.remoteClose
+	}
+
+	if err := nc.configureReadTimeout(); err != nil {
+		return nil, err
+	}
+
+	data, err := nc.readDataMessage(nc.readLimit())
+	if err != nil {
+		return nil, err
+	}
+	return nc.takeMessage(data), nil
+}
+
+// takeMessage returns msg to the caller and clears the receive buffer.
+// Every decryption allocates, so msg is not shared with later messages.
+func (nc *NoiseConn) takeMessage(msg []byte) []byte {
+	nc.pendingPlaintext = nil
+
+	nc.metrics.AddBytesRead(int64(len(msg)))
+
+	nc.logger.WithFields(logrus.Fields{
+		"message_len": len(msg),
+	}).Trace("Message read")
+
+	return msg
+}
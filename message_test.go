@@ -0,0 +1,107 @@
+package noise
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMessagesPreserveBoundaries(t *testing.T) {
+	initiator, responder := establishTCPPair(t)
+
+	msgs := [][]byte{
+		[]byte("first"),
+		{},
+		bytes.Repeat([]byte{0xAB}, 1000),
+		bytes.Repeat([]byte{0xCD}, MaxMessageSize),
+		[]byte("last"),
+	}
+
+	go func() {
+		for _, msg := range msgs {
+			if err := initiator.WriteMessage(msg); err != nil {
+				return
+			}
+		}
+	}()
+
+	for i, want := range msgs {
+		got, err := responder.ReadMessage()
+		require.NoError(t, err, "message %d", i)
+		require.NotNil(t, got, "message %d", i)
+		assert.Equal(t, want, got, "message %d", i)
+	}
+
+	bytesRead, _, _ := responder.GetConnectionMetrics()
+	var total int64
+	for _, msg := range msgs {
+		total += int64(len(msg))
+	}
+	assert.Equal(t, total, bytesRead)
+}
+
+func TestWriteMessageTooLarge(t *testing.T) {
+	initiator, responder := establishTCPPair(t)
+
+	err := initiator.WriteMessage(make([]byte, MaxMessageSize+1))
+	requireErrorCode(t, err, "MESSAGE_TOO_LARGE")
+
+	var tooLarge *MessageTooLargeError
+	require.True(t, errors.As(err, &tooLarge))
+	assert.Equal(t, MaxMessageSize+1, tooLarge.Size)
+
+	// The rejected message must not disturb the stream.
+	require.NoError(t, initiator.WriteMessage([]byte("ok")))
+	got, err := responder.ReadMessage()
+	require.NoError(t, err)
+	assert.Equal(t, []byte("ok"), got)
+}
+
+func TestMessagesMixWithStream(t *testing.T) {
+	initiator, responder := establishTCPPair(t)
+
+	// Write sends each chunk of up to MaxMessageSize bytes as one message.
+	large := bytes.Repeat([]byte("x"), MaxMessageSize+10)
+	go func() {
+		_, _ = initiator.Write([]byte("stream"))
+		_ = initiator.WriteMessage([]byte("message"))
+		_, _ = initiator.Write(large)
+		_ = initiator.CloseWrite()
+	}()
+
+	got, err := responder.ReadMessage()
+	require.NoError(t, err)
+	assert.Equal(t, []byte("stream"), got)
+
+	// A partial Read leaves the rest of the message for ReadMessage.
+	buf := make([]byte, 3)
+	n, err := responder.Read(buf)
+	require.NoError(t, err)
+	assert.Equal(t, "mes", string(buf[:n]))
+	got, err = responder.ReadMessage()
+	require.NoError(t, err)
+	assert.Equal(t, []byte("sage"), got)
+
+	got, err = responder.ReadMessage()
+	require.NoError(t, err)
+	assert.Len(t, got, MaxMessageSize)
+	got, err = responder.ReadMessage()
+	require.NoError(t, err)
+	assert.Len(t, got, 10)
+
+	_, err = responder.ReadMessage()
+	assert.ErrorIs(t, err, io.EOF)
+}
+
+func TestMessageMethodsRequireHandshake(t *testing.T) {
+	conn, err := createTestConnection()
+	require.NoError(t, err)
+
+	requireErrorCode(t, conn.WriteMessage([]byte("early")), "HANDSHAKE_NOT_DONE")
+	_, err = conn.ReadMessage()
+	requireErrorCode(t, err, "HANDSHAKE_NOT_DONE")
+}
@@ -0,0 +1,79 @@
+package mux
+
+import (
+	noise "github.com/go-i2p/go-noise"
+	"github.com/samber/oops"
+)
+
+// initialStreamWindow is the receive window every stream starts with.
+// Larger configured windows are announced with a window update.
+const initialStreamWindow = 256 * 1024
+
+// maxStreamWindow caps the per-stream receive window.
+const maxStreamWindow = 1 << 30
+
+// Config contains configuration for a multiplexed Session.
+// It follows the builder pattern for optional configuration and validation.
+type Config struct {
+	// AcceptBacklog is how many inbound streams may wait for AcceptStream
+	// before further streams are refused with a reset. Default: 256
+	AcceptBacklog int
+
+	// StreamWindow is the per-stream receive window in bytes: how much a
+	// peer may send on a stream before the application reads it.
+	// Default and minimum: 256 KiB
+	StreamWindow uint32
+
+	// ShutdownManager, if set, tracks the session's connection and drains
+	// the session when shutdown begins (optional)
+	ShutdownManager *noise.ShutdownManager
+}
+
+// NewConfig creates a new Config with sensible defaults.
+func NewConfig() *Config {
+	return &Config{
+		AcceptBacklog: 256,
+		StreamWindow:  initialStreamWindow,
+	}
+}
+
+// WithAcceptBacklog sets how many inbound streams may wait for AcceptStream.
+func (c *Config) WithAcceptBacklog(backlog int) *Config {
+	c.AcceptBacklog = backlog
+	return c
+}
+
+// WithStreamWindow sets the per-stream receive window in bytes.
+func (c *Config) WithStreamWindow(window uint32) *Config {
+	c.StreamWindow = window
+	return c
+}
+
+// WithShutdownManager sets the shutdown manager that drains the session.
+func (c *Config) WithShutdownManager(sm *noise.ShutdownManager) *Config {
+	c.ShutdownManager = sm
+	return c
+}
+
+// Validate checks if the configuration is valid.
+func (c *Config) Validate() error {
+	if c.AcceptBacklog <= 0 {
+		return oops.
+			Code("INVALID_BACKLOG").
+			In("mux").
+			With("accept_backlog", c.AcceptBacklog).
+			Wrapf(noise.ErrInvalidConfig, "accept backlog must be positive")
+	}
+
+	if c.StreamWindow < initialStreamWindow || c.StreamWindow > maxStreamWindow {
+		return oops.
+			Code("INVALID_WINDOW").
+			In("mux").
+			With("stream_window", c.StreamWindow).
+			With("min_window", initialStreamWindow).
+			With("max_window", maxStreamWindow).
+			Wrapf(noise.ErrInvalidConfig, "stream window must be between %d and %d bytes", initialStreamWindow, maxStreamWindow)
+	}
+
+	return nil
+}
@@ -0,0 +1,16 @@
+package mux
+
+import "errors"
+
+// Sentinel errors for stream failures. Session and stream errors also match
+// the go-noise sentinels where they apply: noise.ErrConnClosed for a closed
+// session or stream, noise.ErrWriteClosed after CloseWrite, and
+// noise.ErrProtocolViolation for malformed frames.
+var (
+	// ErrStreamReset reports a stream reset by either side.
+	ErrStreamReset = errors.New("stream reset")
+
+	// ErrGoAway reports an attempt to open a stream after either side sent
+	// GoAway, or once the session has used up its stream ids.
+	ErrGoAway = errors.New("session going away")
+)
@@ -0,0 +1,94 @@
+package mux
+
+import (
+	"encoding/binary"
+
+	noise "github.com/go-i2p/go-noise"
+	"github.com/samber/oops"
+)
+
+// Frame types. Every frame travels as one Noise transport message:
+//
+//	[type:1][flags:1][stream id:4][payload]
+const (
+	// frameData carries stream data and the SYN, FIN and RST flags
+	frameData byte = 0x00
+	// frameWindowUpdate grants the sender a 4-byte big-endian window increment
+	frameWindowUpdate byte = 0x01
+	// frameGoAway tells the peer not to open new streams; its stream id is 0
+	frameGoAway byte = 0x02
+)
+
+// Data frame flags.
+const (
+	// flagSYN opens a new stream
+	flagSYN byte = 0x01
+	// flagFIN half-closes the sender's side of a stream
+	flagFIN byte = 0x02
+	// flagRST abruptly terminates a stream in both directions; together
+	// with flagFIN it closes the stream after the data already sent
+	flagRST byte = 0x04
+)
+
+// headerLen is the size of the frame header.
+const headerLen = 6
+
+// maxPayload is the largest payload of one frame.
+const maxPayload = noise.MaxMessageSize - headerLen
+
+// frame is a decoded multiplexer frame.
+type frame struct {
+	typ     byte
+	flags   byte
+	id      uint32
+	payload []byte
+}
+
+// encodeFrame builds the message for one frame.
+func encodeFrame(typ, flags byte, id uint32, payload []byte) []byte {
+	msg := make([]byte, headerLen, headerLen+len(payload))
+	msg[0] = typ
+	msg[1] = flags
+	binary.BigEndian.PutUint32(msg[2:], id)
+	return append(msg, payload...)
+}
+
+// decodeFrame parses one frame from a Noise message.
+func decodeFrame(msg []byte) (frame, error) {
+	if len(msg) < headerLen {
+		return frame{}, oops.
+			Code("INVALID_FRAME").
+			In("mux").
+			With("frame_len", len(msg)).
+			Wrapf(noise.ErrProtocolViolation, "frame shorter than its header")
+	}
+
+	f := frame{
+		typ:     msg[0],
+		flags:   msg[1],
+		id:      binary.BigEndian.Uint32(msg[2:headerLen]),
+		payload: msg[headerLen:],
+	}
+
+	if f.typ == frameWindowUpdate && len(f.payload) != 4 {
+		return frame{}, oops.
+			Code("INVALID_FRAME").
+			In("mux").
+			With("stream_id", f.id).
+			With("payload_len", len(f.payload)).
+			Wrapf(noise.ErrProtocolViolation, "window update must carry a 4-byte increment")
+	}
+	return f, nil
+}
+
+// windowUpdate builds a window update frame for stream id.
+func windowUpdate(id, increment uint32) []byte {
+	var payload [4]byte
+	binary.BigEndian.PutUint32(payload[:], increment)
+	return encodeFrame(frameWindowUpdate, 0, id, payload[:])
+}
+
+// windowIncrement decodes the payload of a window update frame.
+func windowIncrement(payload []byte) uint32 {
+	return binary.BigEndian.Uint32(payload)
+}
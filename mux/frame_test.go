@@ -0,0 +1,38 @@
+package mux
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFrameRoundTrip(t *testing.T) {
+	f, err := decodeFrame(encodeFrame(frameData, flagSYN|flagFIN, 0x01020304, []byte("payload")))
+	require.NoError(t, err)
+	assert.Equal(t, frameData, f.typ)
+	assert.Equal(t, flagSYN|flagFIN, f.flags)
+	assert.Equal(t, uint32(0x01020304), f.id)
+	assert.Equal(t, "payload", string(f.payload))
+
+	f, err = decodeFrame(windowUpdate(7, 1<<20))
+	require.NoError(t, err)
+	assert.Equal(t, frameWindowUpdate, f.typ)
+	assert.Equal(t, uint32(1<<20), windowIncrement(f.payload))
+}
+
+func TestDecodeFrameRejectsMalformed(t *testing.T) {
+	_, err := decodeFrame([]byte{frameData, 0, 0})
+	requireErrorCode(t, err, "INVALID_FRAME")
+
+	_, err = decodeFrame(encodeFrame(frameWindowUpdate, 0, 1, []byte{1, 2}))
+	requireErrorCode(t, err, "INVALID_FRAME")
+}
+
+func TestConfigValidation(t *testing.T) {
+	assert.NoError(t, NewConfig().Validate())
+	assert.NoError(t, NewConfig().WithStreamWindow(maxStreamWindow).Validate())
+	requireErrorCode(t, NewConfig().WithAcceptBacklog(-1).Validate(), "INVALID_BACKLOG")
+	requireErrorCode(t, NewConfig().WithStreamWindow(initialStreamWindow-1).Validate(), "INVALID_WINDOW")
+	requireErrorCode(t, NewConfig().WithStreamWindow(maxStreamWindow+1).Validate(), "INVALID_WINDOW")
+}
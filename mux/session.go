@@ -0,0 +1,534 @@
+package mux
+
+import (
+	"context"
+	"math"
+	"net"
+	"sync"
+
+	noise "github.com/go-i2p/go-noise"
+	"github.com/go-i2p/go-noise/internal"
+	"github.com/go-i2p/logger"
+	"github.com/samber/oops"
+	"github.com/sirupsen/logrus"
+)
+
+// maxPendingResets bounds the resets waiting to be sent. Further resets are
+// dropped until the send loop catches up; only a peer flooding frames for
+// streams that do not exist produces that many.
+const maxPendingResets = 64
+
+// Session multiplexes bidirectional streams over one established NoiseConn.
+// The handshake initiator opens odd-numbered streams and the responder
+// even-numbered ones, so both sides may open streams at any time.
+// Session implements net.Listener, accepting streams opened by the peer.
+type Session struct {
+	conn   *noise.NoiseConn
+	config *Config
+	logger *logger.Logger
+
+	mu           sync.Mutex
+	streams      map[uint32]*Stream
+	nextID       uint32
+	localGoAway  bool
+	remoteGoAway bool
+	draining     bool
+
+	// accept queues streams opened by the peer
+	accept chan *Stream
+
+	// controlMu guards the control frames waiting for the send loop. They
+	// are queued without blocking, so the receive loop never waits on a
+	// write: window updates are merged per stream and resets are bounded.
+	controlMu      sync.Mutex
+	pendingWindows map[uint32]uint32
+	pendingResets  []uint32
+
+	// controlReady wakes the send loop when control frames are pending
+	controlReady chan struct{}
+
+	closed    chan struct{}
+	closeOnce sync.Once
+	closeErr  error
+}
+
+// NewSession starts multiplexing streams over conn, which must have completed
+// its handshake. The session owns conn from then on: reading or writing conn
+// directly corrupts the session. A nil config uses NewConfig.
+func NewSession(conn *noise.NoiseConn, config *Config) (*Session, error) {
+	if conn == nil {
+		return nil, oops.
+			Code("INVALID_CONN").
+			In("mux").
+			Wrapf(noise.ErrInvalidConfig, "noise connection cannot be nil")
+	}
+
+	if config == nil {
+		config = NewConfig()
+	}
+	if err := config.Validate(); err != nil {
+		return nil, oops.
+			Code("INVALID_CONFIG").
+			In("mux").
+			Wrapf(internal.Mark(err, noise.ErrInvalidConfig), "invalid session configuration")
+	}
+
+	if state := conn.GetConnectionState(); state != internal.StateEstablished {
+		return nil, oops.
+			Code("HANDSHAKE_NOT_DONE").
+			In("mux").
+			With("state", state.String()).
+			Wrapf(noise.ErrHandshakeNotDone, "session requires an established connection")
+	}
+
+	s := &Session{
+		conn:    conn,
+		config:  config,
+		logger:  log,
+		streams: make(map[uint32]*Stream),
+		nextID:  2,
+		accept:  make(chan *Stream, config.AcceptBacklog),
+		closed:  make(chan struct{}),
+
+		pendingWindows: make(map[uint32]uint32),
+		controlReady:   make(chan struct{}, 1),
+	}
+	if conn.Snapshot().Initiator {
+		s.nextID = 1
+	}
+
+	go s.receiveLoop()
+	go s.sendLoop()
+
+	if sm := config.ShutdownManager; sm != nil {
+		conn.SetShutdownManager(sm)
+		go s.watchShutdown(sm.Context())
+	}
+
+	s.logger.WithFields(logrus.Fields{
+		"local_addr":  conn.LocalAddr().String(),
+		"remote_addr": conn.RemoteAddr().String(),
+		"first_id":    s.nextID,
+	}).Debug("Mux session started")
+
+	return s, nil
+}
+
+// OpenStream opens a new stream to the peer. It fails once either side has
+// sent GoAway or the session has closed.
+func (s *Session) OpenStream() (*Stream, error) {
+	s.mu.Lock()
+	if err := s.openErrorLocked(); err != nil {
+		s.mu.Unlock()
+		return nil, err
+	}
+	id := s.nextID
+	s.nextID += 2
+	st := newStream(s, id)
+	s.streams[id] = st
+	s.mu.Unlock()
+
+	if err := s.writeFrame(frameData, flagSYN, id, nil); err != nil {
+		s.removeStream(id)
+		return nil, err
+	}
+	if extra := st.extendWindow(); extra > 0 {
+		s.queueWindowUpdate(id, extra)
+	}
+
+	s.logger.WithField("stream_id", id).Trace("Stream opened")
+	return st, nil
+}
+
+// openErrorLocked reports why no stream can be opened, if any.
+func (s *Session) openErrorLocked() error {
+	switch {
+	case s.isClosed():
+		return s.closedError()
+	case s.localGoAway:
+		return oops.
+			Code("SESSION_GOAWAY").
+			In("mux").
+			Wrapf(ErrGoAway, "session has sent GoAway")
+	case s.remoteGoAway:
+		return oops.
+			Code("REMOTE_GOAWAY").
+			In("mux").
+			Wrapf(ErrGoAway, "peer has sent GoAway")
+	case s.nextID > math.MaxUint32-2:
+		return oops.
+			Code("STREAM_IDS_EXHAUSTED").
+			In("mux").
+			With("next_id", s.nextID).
+			Wrapf(ErrGoAway, "no stream ids left in this session")
+	}
+	return nil
+}
+
+// AcceptStream waits for the peer to open a stream.
+func (s *Session) AcceptStream() (*Stream, error) {
+	select {
+	case st := <-s.accept:
+		return st, nil
+	case <-s.closed:
+		return nil, s.closedError()
+	}
+}
+
+// Accept implements net.Listener by returning the next stream from AcceptStream.
+func (s *Session) Accept() (net.Conn, error) {
+	st, err := s.AcceptStream()
+	if err != nil {
+		return nil, internal.NetError(err)
+	}
+	return st, nil
+}
+
+// Addr implements net.Listener by returning the connection's local address.
+func (s *Session) Addr() net.Addr {
+	return s.conn.LocalAddr()
+}
+
+// GoAway tells the peer not to open further streams and stops this side
+// from opening any. Inbound streams opened afterwards are reset; existing
+// streams continue until they finish.
+func (s *Session) GoAway() error {
+	s.mu.Lock()
+	if s.localGoAway {
+		s.mu.Unlock()
+		return nil
+	}
+	s.localGoAway = true
+	s.mu.Unlock()
+
+	s.logger.Debug("Sending GoAway")
+	return s.writeFrame(frameGoAway, 0, 0, nil)
+}
+
+// NumStreams returns the number of streams that have not yet finished.
+func (s *Session) NumStreams() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.streams)
+}
+
+// IsClosed reports whether the session has closed.
+func (s *Session) IsClosed() bool {
+	return s.isClosed()
+}
+
+// Close closes the session and its connection, failing all open streams.
+func (s *Session) Close() error {
+	return s.terminate(nil, func() error {
+		return s.conn.CloseWithReason(noise.CloseNormal, "session closed")
+	})
+}
+
+// drain sends GoAway and closes the session once its last stream finishes.
+func (s *Session) drain() {
+	if err := s.GoAway(); err != nil {
+		s.logger.WithField("error", err.Error()).Debug("GoAway not sent")
+	}
+
+	s.mu.Lock()
+	s.draining = true
+	remaining := len(s.streams)
+	s.mu.Unlock()
+
+	s.logger.WithField("streams", remaining).Debug("Draining mux session")
+	if remaining == 0 {
+		s.closeDrained()
+	}
+}
+
+// closeDrained closes a drained session, telling the peer the node is going down.
+func (s *Session) closeDrained() {
+	s.terminate(nil, func() error {
+		return s.conn.CloseWithReason(noise.CloseShutdown, "session drained")
+	})
+}
+
+// watchShutdown drains the session when the shutdown manager starts shutdown.
+// If the manager force-closes the connection first, the receive loop ends
+// the session instead.
+func (s *Session) watchShutdown(ctx context.Context) {
+	select {
+	case <-ctx.Done():
+		s.drain()
+	case <-s.closed:
+	}
+}
+
+// terminate closes the session once, recording cause for pending and future
+// operations, and closes the connection with closeConn.
+func (s *Session) terminate(cause error, closeConn func() error) error {
+	var err error
+	s.closeOnce.Do(func() {
+		s.closeErr = cause
+		s.mu.Lock()
+		streams := make([]*Stream, 0, len(s.streams))
+		for _, st := range s.streams {
+			streams = append(streams, st)
+		}
+		s.mu.Unlock()
+
+		close(s.closed)
+		err = closeConn()
+		for _, st := range streams {
+			st.notify()
+		}
+
+		fields := logrus.Fields{"streams": len(streams)}
+		if cause != nil {
+			fields["error"] = cause.Error()
+		}
+		s.logger.WithFields(fields).Debug("Mux session closed")
+	})
+	return err
+}
+
+// isClosed reports whether terminate has run.
+func (s *Session) isClosed() bool {
+	select {
+	case <-s.closed:
+		return true
+	default:
+		return false
+	}
+}
+
+// closedError returns the error for operations on a closed session. It must
+// only be called once closed is closed, which publishes closeErr.
+func (s *Session) closedError() error {
+	if cause := s.closeErr; cause != nil {
+		return oops.
+			Code("SESSION_CLOSED").
+			In("mux").
+			Wrapf(internal.Mark(cause, noise.ErrConnClosed), "mux session closed")
+	}
+	return oops.
+		Code("SESSION_CLOSED").
+		In("mux").
+		Wrapf(noise.ErrConnClosed, "mux session closed")
+}
+
+// writeFrame sends one frame, failing the session if the connection breaks.
+func (s *Session) writeFrame(typ, flags byte, id uint32, payload []byte) error {
+	if s.isClosed() {
+		return s.closedError()
+	}
+	if err := s.conn.WriteMessage(encodeFrame(typ, flags, id, payload)); err != nil {
+		s.terminate(err, s.conn.Close)
+		return s.closedError()
+	}
+	return nil
+}
+
+// queueWindowUpdate hands a window increment for stream id to the send
+// loop, adding it to any increment not yet sent.
+func (s *Session) queueWindowUpdate(id, increment uint32) {
+	s.controlMu.Lock()
+	s.pendingWindows[id] += increment
+	s.controlMu.Unlock()
+	s.wakeSendLoop()
+}
+
+// queueReset hands a reset of stream id to the send loop, dropping it if
+// maxPendingResets are already waiting.
+func (s *Session) queueReset(id uint32) {
+	s.controlMu.Lock()
+	if len(s.pendingResets) >= maxPendingResets {
+		s.controlMu.Unlock()
+		s.logger.WithField("stream_id", id).Debug("Reset dropped, too many pending")
+		return
+	}
+	s.pendingResets = append(s.pendingResets, id)
+	s.controlMu.Unlock()
+	s.wakeSendLoop()
+}
+
+// wakeSendLoop tells the send loop control frames are pending.
+func (s *Session) wakeSendLoop() {
+	select {
+	case s.controlReady <- struct{}{}:
+	default:
+	}
+}
+
+// sendLoop writes queued control frames.
+func (s *Session) sendLoop() {
+	for {
+		select {
+		case <-s.controlReady:
+			if err := s.flushControl(); err != nil {
+				s.terminate(err, s.conn.Close)
+				return
+			}
+		case <-s.closed:
+			return
+		}
+	}
+}
+
+// flushControl writes the pending window updates and resets.
+func (s *Session) flushControl() error {
+	s.controlMu.Lock()
+	windows, resets := s.pendingWindows, s.pendingResets
+	s.pendingWindows, s.pendingResets = make(map[uint32]uint32), nil
+	s.controlMu.Unlock()
+
+	for id, increment := range windows {
+		if err := s.conn.WriteMessage(windowUpdate(id, increment)); err != nil {
+			return err
+		}
+	}
+	for _, id := range resets {
+		if err := s.conn.WriteMessage(encodeFrame(frameData, flagRST, id, nil)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// receiveLoop reads and dispatches frames until the connection fails.
+func (s *Session) receiveLoop() {
+	for {
+		msg, err := s.conn.ReadMessage()
+		if err != nil {
+			s.terminate(err, s.conn.Close)
+			return
+		}
+
+		f, err := decodeFrame(msg)
+		if err != nil {
+			s.terminate(err, func() error {
+				return s.conn.CloseWithReason(noise.CloseProtocolError, "malformed mux frame")
+			})
+			return
+		}
+
+		s.handleFrame(f)
+	}
+}
+
+// handleFrame dispatches one inbound frame.
+func (s *Session) handleFrame(f frame) {
+	switch f.typ {
+	case frameGoAway:
+		s.mu.Lock()
+		s.remoteGoAway = true
+		s.mu.Unlock()
+		s.logger.Debug("Received GoAway")
+
+	case frameWindowUpdate:
+		if st := s.stream(f.id); st != nil {
+			st.grantSend(windowIncrement(f.payload))
+		}
+
+	case frameData:
+		s.handleData(f)
+
+	default:
+		s.logger.WithField("type", f.typ).Debug("Ignoring unknown frame type")
+	}
+}
+
+// handleData handles a data frame and any SYN, FIN or RST it carries.
+func (s *Session) handleData(f frame) {
+	if f.flags&flagSYN != 0 && !s.acceptStream(f.id) {
+		return
+	}
+
+	st := s.stream(f.id)
+	if st == nil {
+		// Never answer a reset with a reset, or the two sides would
+		// bounce them forever.
+		if f.flags&flagRST == 0 {
+			s.queueReset(f.id)
+		}
+		return
+	}
+
+	if f.flags&flagRST != 0 {
+		st.remoteReset(f.flags&flagFIN != 0)
+		return
+	}
+
+	if len(f.payload) > 0 {
+		if err := st.receive(f.payload); err != nil {
+			s.logger.WithFields(logrus.Fields{
+				"stream_id": f.id,
+				"error":     err.Error(),
+			}).Debug("Resetting stream")
+			st.abort()
+			s.queueReset(f.id)
+			return
+		}
+	}
+
+	if f.flags&flagFIN != 0 {
+		st.remoteFinish()
+	}
+}
+
+// acceptStream registers a stream opened by the peer. It returns false, after
+// resetting the stream, if the stream cannot be accepted.
+func (s *Session) acceptStream(id uint32) bool {
+	s.mu.Lock()
+	_, exists := s.streams[id]
+	// The peer's ids have the opposite parity to ours.
+	valid := id != 0 && id%2 != s.nextID%2 && !exists
+	refuse := !valid || s.localGoAway
+	var st *Stream
+	if !refuse {
+		st = newStream(s, id)
+		select {
+		case s.accept <- st:
+			s.streams[id] = st
+		default:
+			refuse = true
+		}
+	}
+	s.mu.Unlock()
+
+	if refuse {
+		s.logger.WithFields(logrus.Fields{
+			"stream_id": id,
+			"valid":     valid,
+		}).Debug("Refusing inbound stream")
+		if !exists {
+			s.queueReset(id)
+		}
+		return false
+	}
+
+	if extra := st.extendWindow(); extra > 0 {
+		s.queueWindowUpdate(id, extra)
+	}
+	return true
+}
+
+// stream returns the open stream with the given id, or nil.
+func (s *Session) stream(id uint32) *Stream {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.streams[id]
+}
+
+// removeStream forgets a finished stream, closing a draining session once
+// its last stream is gone.
+func (s *Session) removeStream(id uint32) {
+	s.mu.Lock()
+	if _, ok := s.streams[id]; !ok {
+		s.mu.Unlock()
+		return
+	}
+	delete(s.streams, id)
+	drained := s.draining && len(s.streams) == 0
+	s.mu.Unlock()
+
+	s.logger.WithField("stream_id", id).Trace("Stream finished")
+	if drained {
+		go s.closeDrained()
+	}
+}
@@ -0,0 +1,377 @@
+package mux
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"math"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	noise "github.com/go-i2p/go-noise"
+	"github.com/samber/oops"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// establishConns returns an NN client and server with message types
+// enabled that completed their handshake over loopback TCP.
+func establishConns(t *testing.T) (*noise.NoiseConn, *noise.NoiseConn) {
+	t.Helper()
+
+	tcpListener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	listener, err := noise.NewNoiseListener(tcpListener, noise.NewListenerConfig("NN").WithHandshakeTimeout(5*time.Second).WithMessageTypes(true))
+	require.NoError(t, err)
+	t.Cleanup(func() { listener.Close() })
+
+	accepted := make(chan *noise.NoiseConn, 1)
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			accepted <- nil
+			return
+		}
+		nc := conn.(*noise.NoiseConn)
+		if err := nc.Handshake(t.Context()); err != nil {
+			nc.Close()
+			nc = nil
+		}
+		accepted <- nc
+	}()
+
+	client, err := noise.DialNoiseWithHandshake("tcp", tcpListener.Addr().String(), noise.NewConnConfig("NN", true).WithMessageTypes(true))
+	require.NoError(t, err)
+	server := <-accepted
+	require.NotNil(t, server)
+	t.Cleanup(func() {
+		client.Close()
+		server.Close()
+	})
+	return client, server
+}
+
+// sessionPair returns client and server sessions over a fresh connection.
+func sessionPair(t *testing.T, clientConfig, serverConfig *Config) (*Session, *Session) {
+	t.Helper()
+	clientConn, serverConn := establishConns(t)
+
+	client, err := NewSession(clientConn, clientConfig)
+	require.NoError(t, err)
+	server, err := NewSession(serverConn, serverConfig)
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		client.Close()
+		server.Close()
+	})
+	return client, server
+}
+
+// requireErrorCode asserts that err is an oops error with the given code.
+func requireErrorCode(t *testing.T, err error, code string) {
+	t.Helper()
+	require.Error(t, err)
+	oopsErr, ok := oops.AsOops(err)
+	require.True(t, ok, "expected an oops error, got %T: %v", err, err)
+	assert.Equal(t, code, oopsErr.Code())
+}
+
+// echo serves streams from session, echoing each until the peer half-closes.
+func echo(session *Session) {
+	for {
+		st, err := session.AcceptStream()
+		if err != nil {
+			return
+		}
+		go func() {
+			io.Copy(st, st)
+			st.Close()
+		}()
+	}
+}
+
+func TestSessionConcurrentStreams(t *testing.T) {
+	client, server := sessionPair(t, nil, nil)
+	go echo(server)
+
+	const streams = 20
+	var wg sync.WaitGroup
+	for i := 0; i < streams; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			st, err := client.OpenStream()
+			if !assert.NoError(t, err) {
+				return
+			}
+			defer st.Close()
+
+			payload := bytes.Repeat([]byte(fmt.Sprintf("stream %d;", i)), 10000)
+			go func() {
+				st.Write(payload)
+				st.CloseWrite()
+			}()
+
+			got, err := io.ReadAll(st)
+			assert.NoError(t, err)
+			assert.Equal(t, payload, got)
+		}(i)
+	}
+	wg.Wait()
+
+	require.Eventually(t, func() bool {
+		return client.NumStreams() == 0 && server.NumStreams() == 0
+	}, 5*time.Second, 10*time.Millisecond, "finished streams should be forgotten")
+}
+
+func TestSessionStreamIDs(t *testing.T) {
+	client, server := sessionPair(t, nil, nil)
+
+	for _, want := range []uint32{1, 3, 5} {
+		st, err := client.OpenStream()
+		require.NoError(t, err)
+		assert.Equal(t, want, st.StreamID())
+
+		accepted, err := server.AcceptStream()
+		require.NoError(t, err)
+		assert.Equal(t, want, accepted.StreamID())
+	}
+
+	// The responder opens even-numbered streams.
+	st, err := server.OpenStream()
+	require.NoError(t, err)
+	assert.Equal(t, uint32(2), st.StreamID())
+
+	conn, err := client.Accept()
+	require.NoError(t, err)
+	assert.Equal(t, uint32(2), conn.(*Stream).StreamID())
+	assert.Equal(t, client.Addr(), conn.LocalAddr())
+}
+
+func TestSessionGoAway(t *testing.T) {
+	client, server := sessionPair(t, nil, nil)
+	go echo(server)
+
+	existing, err := client.OpenStream()
+	require.NoError(t, err)
+
+	// A stream whose SYN crosses the GoAway is reset, so make sure the
+	// server has accepted this one first.
+	_, err = existing.Write([]byte("ping;"))
+	require.NoError(t, err)
+	_, err = io.ReadFull(existing, make([]byte, 5))
+	require.NoError(t, err)
+
+	require.NoError(t, server.GoAway())
+	_, err = server.OpenStream()
+	requireErrorCode(t, err, "SESSION_GOAWAY")
+	assert.ErrorIs(t, err, ErrGoAway)
+
+	require.Eventually(t, func() bool {
+		_, err := client.OpenStream()
+		return err != nil
+	}, 5*time.Second, 10*time.Millisecond, "the peer's GoAway should stop new streams")
+	_, err = client.OpenStream()
+	requireErrorCode(t, err, "REMOTE_GOAWAY")
+	assert.ErrorIs(t, err, ErrGoAway)
+
+	// Streams opened before GoAway keep working.
+	_, err = existing.Write([]byte("still here"))
+	require.NoError(t, err)
+	require.NoError(t, existing.CloseWrite())
+	got, err := io.ReadAll(existing)
+	require.NoError(t, err)
+	assert.Equal(t, "still here", string(got))
+	existing.Close()
+}
+
+func TestSessionStreamIDsExhausted(t *testing.T) {
+	client, _ := sessionPair(t, nil, nil)
+	client.mu.Lock()
+	client.nextID = math.MaxUint32
+	client.mu.Unlock()
+
+	_, err := client.OpenStream()
+	requireErrorCode(t, err, "STREAM_IDS_EXHAUSTED")
+	assert.ErrorIs(t, err, ErrGoAway)
+}
+
+func TestSessionRefusesStreamsAfterGoAway(t *testing.T) {
+	client, server := sessionPair(t, nil, nil)
+	require.NoError(t, server.GoAway())
+
+	// Open a stream as if the GoAway had not arrived yet.
+	st := newStream(client, 101)
+	client.mu.Lock()
+	client.streams[101] = st
+	client.mu.Unlock()
+	require.NoError(t, client.writeFrame(frameData, flagSYN, 101, nil))
+
+	_, err := st.Read(make([]byte, 1))
+	requireErrorCode(t, err, "STREAM_RESET")
+}
+
+func TestSessionCloseFailsStreams(t *testing.T) {
+	client, server := sessionPair(t, nil, nil)
+
+	st, err := client.OpenStream()
+	require.NoError(t, err)
+	accepted, err := server.AcceptStream()
+	require.NoError(t, err)
+
+	readErr := make(chan error, 1)
+	go func() {
+		_, err := accepted.Read(make([]byte, 1))
+		readErr <- err
+	}()
+
+	require.NoError(t, client.Close())
+	assert.True(t, client.IsClosed())
+
+	_, err = st.Write([]byte("too late"))
+	requireErrorCode(t, err, "SESSION_CLOSED")
+	assert.ErrorIs(t, err, noise.ErrConnClosed)
+	assert.ErrorIs(t, err, net.ErrClosed)
+	_, err = client.OpenStream()
+	requireErrorCode(t, err, "SESSION_CLOSED")
+
+	select {
+	case err := <-readErr:
+		require.Error(t, err)
+		var closeErr *noise.RemoteCloseError
+		assert.ErrorAs(t, err, &closeErr)
+	case <-time.After(5 * time.Second):
+		t.Fatal("the peer's streams should fail when the session closes")
+	}
+
+	_, err = server.AcceptStream()
+	assert.Error(t, err)
+	assert.True(t, server.IsClosed())
+}
+
+func TestSessionShutdownDrainsStreams(t *testing.T) {
+	sm := noise.NewShutdownManager(10 * time.Second)
+	client, server := sessionPair(t, nil, NewConfig().WithShutdownManager(sm))
+
+	st, err := client.OpenStream()
+	require.NoError(t, err)
+	_, err = st.Write([]byte("request"))
+	require.NoError(t, err)
+	accepted, err := server.AcceptStream()
+	require.NoError(t, err)
+
+	shutdownDone := make(chan error, 1)
+	go func() { shutdownDone <- sm.Shutdown() }()
+
+	require.Eventually(t, func() bool {
+		_, err := client.OpenStream()
+		return err != nil
+	}, 5*time.Second, 10*time.Millisecond, "draining should send GoAway")
+	assert.False(t, server.IsClosed(), "in-flight streams keep the session open")
+
+	// The in-flight stream completes normally.
+	buf := make([]byte, 7)
+	_, err = io.ReadFull(accepted, buf)
+	require.NoError(t, err)
+	assert.Equal(t, "request", string(buf))
+	_, err = accepted.Write([]byte("response"))
+	require.NoError(t, err)
+	require.NoError(t, accepted.Close())
+
+	require.NoError(t, st.CloseWrite())
+	got, err := io.ReadAll(st)
+	require.NoError(t, err)
+	assert.Equal(t, "response", string(got))
+
+	select {
+	case err := <-shutdownDone:
+		assert.NoError(t, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("shutdown should finish once the last stream does")
+	}
+	assert.True(t, server.IsClosed())
+
+	require.Eventually(t, client.IsClosed, 5*time.Second, 10*time.Millisecond,
+		"the peer's session should end with the connection")
+}
+
+func TestSessionShutdownWithoutStreams(t *testing.T) {
+	sm := noise.NewShutdownManager(10 * time.Second)
+	_, server := sessionPair(t, nil, NewConfig().WithShutdownManager(sm))
+
+	require.NoError(t, sm.Shutdown())
+	assert.True(t, server.IsClosed())
+}
+
+func TestNewSessionErrors(t *testing.T) {
+	_, err := NewSession(nil, nil)
+	requireErrorCode(t, err, "INVALID_CONN")
+
+	local, remote := net.Pipe()
+	defer remote.Close()
+	nc, err := noise.NewNoiseConn(local, noise.NewConnConfig("NN", true))
+	require.NoError(t, err)
+	defer nc.Close()
+	_, err = NewSession(nc, nil)
+	requireErrorCode(t, err, "HANDSHAKE_NOT_DONE")
+
+	clientConn, _ := establishConns(t)
+	_, err = NewSession(clientConn, NewConfig().WithAcceptBacklog(0))
+	requireErrorCode(t, err, "INVALID_BACKLOG")
+}
+
+// pipeConns returns an NN client and server that completed their handshake
+// over an unbuffered pipe, so a side that stops reading stalls its peer's
+// writes at once.
+func pipeConns(t *testing.T) (*noise.NoiseConn, *noise.NoiseConn) {
+	t.Helper()
+	clientPipe, serverPipe := net.Pipe()
+	client, err := noise.NewNoiseConn(clientPipe, noise.NewConnConfig("NN", true))
+	require.NoError(t, err)
+	server, err := noise.NewNoiseConn(serverPipe, noise.NewConnConfig("NN", false))
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		client.Close()
+		server.Close()
+	})
+
+	errs := make(chan error, 1)
+	go func() { errs <- server.Handshake(t.Context()) }()
+	require.NoError(t, client.Handshake(t.Context()))
+	require.NoError(t, <-errs)
+	return client, server
+}
+
+func TestSessionReceiveLoopDoesNotBlockOnResets(t *testing.T) {
+	clientConn, peer := pipeConns(t)
+	client, err := NewSession(clientConn, nil)
+	require.NoError(t, err)
+	t.Cleanup(func() { client.Close() })
+
+	// The peer never reads, so the resets the session owes it cannot be
+	// sent. The session must keep reading regardless.
+	written := make(chan error, 1)
+	go func() {
+		for id := uint32(2); id < 2+4*maxPendingResets; id += 2 {
+			if err := peer.WriteMessage(encodeFrame(frameData, 0, id, []byte("x"))); err != nil {
+				written <- err
+				return
+			}
+		}
+		written <- peer.WriteMessage(encodeFrame(frameGoAway, 0, 0, nil))
+	}()
+
+	select {
+	case err := <-written:
+		require.NoError(t, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("the session stopped reading while its resets were pending")
+	}
+	require.Eventually(t, func() bool {
+		client.mu.Lock()
+		defer client.mu.Unlock()
+		return client.remoteGoAway
+	}, 5*time.Second, 10*time.Millisecond)
+}
@@ -0,0 +1,443 @@
+package mux
+
+import (
+	"bytes"
+	"io"
+	"math"
+	"net"
+	"os"
+	"sync"
+	"time"
+
+	noise "github.com/go-i2p/go-noise"
+	"github.com/go-i2p/go-noise/internal"
+	"github.com/samber/oops"
+)
+
+// Stream is one bidirectional stream of a Session. It implements net.Conn.
+// Each direction has its own flow-control window: a writer blocks once it has
+// sent a full window the reader has not yet consumed.
+type Stream struct {
+	id      uint32
+	session *Session
+
+	mu sync.Mutex
+
+	// recvBuf holds received data not yet read
+	recvBuf bytes.Buffer
+	// recvWindow is the full receive window of this stream
+	recvWindow uint32
+	// recvAvail is how many more bytes the peer may send
+	recvAvail uint32
+	// consumed counts bytes read but not yet returned to the peer's window
+	consumed uint32
+
+	// sendWindow is how many more bytes may be sent
+	sendWindow uint32
+
+	// localFinished is set once this side has sent FIN
+	localFinished bool
+	// remoteFinished is set once the peer has sent FIN
+	remoteFinished bool
+	// readClosed is set by Close; later inbound data is discarded
+	readClosed bool
+	// reset is set once either side has reset the stream
+	reset bool
+	// writeReset is set once the peer has closed the stream; data it sent
+	// before stays readable but writes fail
+	writeReset bool
+
+	readDeadline  time.Time
+	writeDeadline time.Time
+
+	// readReady and writeReady wake blocked readers and writers
+	readReady  chan struct{}
+	writeReady chan struct{}
+}
+
+// newStream creates a stream with the protocol's initial windows.
+func newStream(s *Session, id uint32) *Stream {
+	return &Stream{
+		id:         id,
+		session:    s,
+		recvWindow: initialStreamWindow,
+		recvAvail:  initialStreamWindow,
+		sendWindow: initialStreamWindow,
+		readReady:  make(chan struct{}, 1),
+		writeReady: make(chan struct{}, 1),
+	}
+}
+
+// StreamID returns the stream's identifier within its session.
+func (st *Stream) StreamID() uint32 {
+	return st.id
+}
+
+// Read reads data from the stream. It returns io.EOF once the peer has
+// half-closed the stream and all its data has been read.
+func (st *Stream) Read(b []byte) (int, error) {
+	n, err := st.read(b)
+	return n, internal.NetError(err)
+}
+
+// read implements Read.
+func (st *Stream) read(b []byte) (int, error) {
+	for {
+		st.mu.Lock()
+		if st.reset {
+			st.mu.Unlock()
+			return 0, st.resetError()
+		}
+		if st.recvBuf.Len() > 0 {
+			n, _ := st.recvBuf.Read(b)
+			increment := st.consumeLocked(n)
+			st.mu.Unlock()
+
+			if increment > 0 {
+				st.session.queueWindowUpdate(st.id, increment)
+			}
+			return n, nil
+		}
+		if st.remoteFinished {
+			st.mu.Unlock()
+			return 0, io.EOF
+		}
+		if st.readClosed {
+			st.mu.Unlock()
+			return 0, st.closedError("read")
+		}
+		deadline := st.readDeadline
+		st.mu.Unlock()
+
+		if st.session.isClosed() {
+			return 0, st.session.closedError()
+		}
+		if err := st.wait(st.readReady, deadline, "read"); err != nil {
+			return 0, err
+		}
+	}
+}
+
+// consumeLocked accounts for n bytes read and returns the window increment
+// to send, or 0 while less than half the window has been consumed.
+func (st *Stream) consumeLocked(n int) uint32 {
+	st.consumed += uint32(n)
+	if st.consumed < st.recvWindow/2 {
+		return 0
+	}
+	increment := st.consumed
+	st.consumed = 0
+	st.recvAvail += increment
+	return increment
+}
+
+// Write writes data to the stream, blocking while the peer's window is full.
+func (st *Stream) Write(b []byte) (int, error) {
+	n, err := st.write(b)
+	return n, internal.NetError(err)
+}
+
+// write implements Write.
+func (st *Stream) write(b []byte) (int, error) {
+	written := 0
+	for written < len(b) {
+		st.mu.Lock()
+		if st.reset || st.writeReset {
+			st.mu.Unlock()
+			return written, st.resetError()
+		}
+		if st.localFinished {
+			st.mu.Unlock()
+			return written, st.closedError("write")
+		}
+		if st.sendWindow == 0 {
+			deadline := st.writeDeadline
+			st.mu.Unlock()
+
+			if st.session.isClosed() {
+				return written, st.session.closedError()
+			}
+			if err := st.wait(st.writeReady, deadline, "write"); err != nil {
+				return written, err
+			}
+			continue
+		}
+		n := min(len(b)-written, int(st.sendWindow), maxPayload)
+		st.sendWindow -= uint32(n)
+		more := st.sendWindow > 0
+		st.mu.Unlock()
+
+		// A window update wakes only one writer; pass the wake-up on so
+		// other blocked writers can use what is left of the window.
+		if more {
+			signal(st.writeReady)
+		}
+
+		if err := st.session.writeFrame(frameData, 0, st.id, b[written:written+n]); err != nil {
+			return written, err
+		}
+		written += n
+	}
+	return written, nil
+}
+
+// CloseWrite half-closes the stream: the peer reads io.EOF once it has
+// consumed the data already written, and may keep writing.
+func (st *Stream) CloseWrite() error {
+	st.mu.Lock()
+	if st.localFinished || st.reset || st.writeReset {
+		st.mu.Unlock()
+		return nil
+	}
+	st.localFinished = true
+	st.mu.Unlock()
+	st.notify()
+
+	err := st.session.writeFrame(frameData, flagFIN, st.id, nil)
+	st.finishIfDone()
+	return err
+}
+
+// Close closes both directions of the stream and releases it from the
+// session; data already written is still delivered. If the peer has not
+// half-closed yet it is sent FIN together with RST: it can still read what
+// was sent before Close followed by io.EOF, but its writes fail with
+// ErrStreamReset. Use Reset to abandon the stream in both directions.
+func (st *Stream) Close() error {
+	st.mu.Lock()
+	st.readClosed = true
+	st.recvBuf.Reset()
+	if st.remoteFinished || st.reset || st.writeReset {
+		st.mu.Unlock()
+		return st.CloseWrite()
+	}
+	st.localFinished = true
+	st.mu.Unlock()
+	st.notify()
+	st.session.removeStream(st.id)
+
+	return st.session.writeFrame(frameData, flagFIN|flagRST, st.id, nil)
+}
+
+// Reset abruptly terminates both directions of the stream. Pending and
+// future reads and writes on either side fail.
+func (st *Stream) Reset() error {
+	st.mu.Lock()
+	if st.reset {
+		st.mu.Unlock()
+		return nil
+	}
+	st.reset = true
+	st.mu.Unlock()
+	st.notify()
+	st.session.removeStream(st.id)
+
+	return st.session.writeFrame(frameData, flagRST, st.id, nil)
+}
+
+// LocalAddr returns the local address of the session's connection.
+func (st *Stream) LocalAddr() net.Addr {
+	return st.session.conn.LocalAddr()
+}
+
+// RemoteAddr returns the remote address of the session's connection.
+func (st *Stream) RemoteAddr() net.Addr {
+	return st.session.conn.RemoteAddr()
+}
+
+// SetDeadline sets the read and write deadlines.
+func (st *Stream) SetDeadline(t time.Time) error {
+	st.mu.Lock()
+	st.readDeadline = t
+	st.writeDeadline = t
+	st.mu.Unlock()
+	st.notify()
+	return nil
+}
+
+// SetReadDeadline sets the deadline for Read calls.
+func (st *Stream) SetReadDeadline(t time.Time) error {
+	st.mu.Lock()
+	st.readDeadline = t
+	st.mu.Unlock()
+	st.notify()
+	return nil
+}
+
+// SetWriteDeadline sets the deadline for Write calls.
+func (st *Stream) SetWriteDeadline(t time.Time) error {
+	st.mu.Lock()
+	st.writeDeadline = t
+	st.mu.Unlock()
+	st.notify()
+	return nil
+}
+
+// receive buffers inbound data. It fails if the peer exceeded its window.
+func (st *Stream) receive(payload []byte) error {
+	st.mu.Lock()
+	if uint32(len(payload)) > st.recvAvail {
+		avail := st.recvAvail
+		st.mu.Unlock()
+		return oops.
+			Code("FLOW_CONTROL_VIOLATION").
+			In("mux").
+			With("stream_id", st.id).
+			With("payload_len", len(payload)).
+			With("window", avail).
+			Wrapf(noise.ErrProtocolViolation, "peer exceeded the stream window")
+	}
+	st.recvAvail -= uint32(len(payload))
+
+	var increment uint32
+	if st.readClosed {
+		increment = st.consumeLocked(len(payload))
+	} else {
+		st.recvBuf.Write(payload)
+	}
+	st.mu.Unlock()
+
+	if increment > 0 {
+		st.session.queueWindowUpdate(st.id, increment)
+	}
+	st.notify()
+	return nil
+}
+
+// extendWindow raises the receive window to the configured size and returns
+// the increment to announce to the peer.
+func (st *Stream) extendWindow() uint32 {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	extra := st.session.config.StreamWindow - st.recvWindow
+	st.recvWindow += extra
+	st.recvAvail += extra
+	return extra
+}
+
+// grantSend adds a window increment from the peer.
+func (st *Stream) grantSend(increment uint32) {
+	st.mu.Lock()
+	if st.sendWindow > math.MaxUint32-increment {
+		st.sendWindow = math.MaxUint32
+	} else {
+		st.sendWindow += increment
+	}
+	st.mu.Unlock()
+	st.notify()
+}
+
+// remoteFinish records the peer's FIN.
+func (st *Stream) remoteFinish() {
+	st.mu.Lock()
+	st.remoteFinished = true
+	st.mu.Unlock()
+	st.notify()
+	st.finishIfDone()
+}
+
+// remoteReset records the peer's RST. A reset carrying FIN comes from the
+// peer closing the stream: data it sent before stays readable and only
+// writing fails.
+func (st *Stream) remoteReset(finished bool) {
+	if !finished {
+		st.abort()
+		return
+	}
+	st.mu.Lock()
+	st.remoteFinished = true
+	st.writeReset = true
+	st.mu.Unlock()
+	st.notify()
+	st.session.removeStream(st.id)
+}
+
+// abort marks the stream reset without telling the peer.
+func (st *Stream) abort() {
+	st.mu.Lock()
+	st.reset = true
+	st.mu.Unlock()
+	st.notify()
+	st.session.removeStream(st.id)
+}
+
+// finishIfDone removes the stream once both sides have sent FIN.
+func (st *Stream) finishIfDone() {
+	st.mu.Lock()
+	done := st.localFinished && st.remoteFinished
+	st.mu.Unlock()
+	if done {
+		st.session.removeStream(st.id)
+	}
+}
+
+// notify wakes any blocked reader and writer so they re-check the stream.
+func (st *Stream) notify() {
+	signal(st.readReady)
+	signal(st.writeReady)
+}
+
+// signal wakes one waiter on ch without blocking.
+func signal(ch chan struct{}) {
+	select {
+	case ch <- struct{}{}:
+	default:
+	}
+}
+
+// wait blocks until ready fires, the deadline passes or the session closes.
+func (st *Stream) wait(ready <-chan struct{}, deadline time.Time, op string) error {
+	var timeout <-chan time.Time
+	if !deadline.IsZero() {
+		d := time.Until(deadline)
+		if d <= 0 {
+			return st.deadlineError(op)
+		}
+		timer := time.NewTimer(d)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+
+	select {
+	case <-ready:
+		return nil
+	case <-st.session.closed:
+		return nil
+	case <-timeout:
+		return st.deadlineError(op)
+	}
+}
+
+// resetError returns the error for operations on a reset stream.
+func (st *Stream) resetError() error {
+	return oops.
+		Code("STREAM_RESET").
+		In("mux").
+		With("stream_id", st.id).
+		Wrapf(ErrStreamReset, "stream was reset")
+}
+
+// closedError returns the error for operations on a closed stream direction.
+func (st *Stream) closedError(op string) error {
+	sentinel := noise.ErrConnClosed
+	if op == "write" {
+		sentinel = noise.ErrWriteClosed
+	}
+	return oops.
+		Code("STREAM_CLOSED").
+		In("mux").
+		With("stream_id", st.id).
+		With("operation", op).
+		Wrapf(sentinel, "stream is closed for %s", op)
+}
+
+// deadlineError reports an expired deadline. It wraps os.ErrDeadlineExceeded
+// so callers can detect timeouts with errors.Is.
+func (st *Stream) deadlineError(op string) error {
+	return oops.
+		Code("DEADLINE_EXCEEDED").
+		In("mux").
+		With("stream_id", st.id).
+		With("operation", op).
+		Wrapf(os.ErrDeadlineExceeded, "stream %s deadline exceeded", op)
+}
@@ -0,0 +1,276 @@
+package mux
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"net"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStreamFlowControl(t *testing.T) {
+	client, server := sessionPair(t, nil, nil)
+
+	st, err := client.OpenStream()
+	require.NoError(t, err)
+	accepted, err := server.AcceptStream()
+	require.NoError(t, err)
+
+	// Nobody reads, so the writer stops after one window.
+	payload := bytes.Repeat([]byte{0xab}, 3*initialStreamWindow)
+	require.NoError(t, st.SetWriteDeadline(time.Now().Add(200*time.Millisecond)))
+	n, err := st.Write(payload)
+	requireErrorCode(t, err, "DEADLINE_EXCEEDED")
+	assert.True(t, errors.Is(err, os.ErrDeadlineExceeded))
+	assert.Equal(t, initialStreamWindow, n)
+
+	// Reading reopens the window and the rest goes through.
+	require.NoError(t, st.SetWriteDeadline(time.Time{}))
+	writeErr := make(chan error, 1)
+	go func() {
+		_, err := st.Write(payload[n:])
+		if err == nil {
+			err = st.CloseWrite()
+		}
+		writeErr <- err
+	}()
+
+	got, err := io.ReadAll(accepted)
+	require.NoError(t, err)
+	assert.Equal(t, payload, got)
+	require.NoError(t, <-writeErr)
+}
+
+func TestStreamConfiguredWindow(t *testing.T) {
+	const window = 4 * initialStreamWindow
+	client, server := sessionPair(t, nil, NewConfig().WithStreamWindow(window))
+
+	st, err := client.OpenStream()
+	require.NoError(t, err)
+	_, err = server.AcceptStream()
+	require.NoError(t, err)
+
+	// The larger window is announced when the stream is accepted.
+	require.Eventually(t, func() bool {
+		st.mu.Lock()
+		defer st.mu.Unlock()
+		return st.sendWindow == window
+	}, 5*time.Second, 10*time.Millisecond)
+
+	require.NoError(t, st.SetWriteDeadline(time.Now().Add(5*time.Second)))
+	n, err := st.Write(make([]byte, window))
+	require.NoError(t, err)
+	assert.Equal(t, window, n)
+}
+
+func TestStreamFlowControlViolationResets(t *testing.T) {
+	client, server := sessionPair(t, nil, nil)
+
+	st, err := client.OpenStream()
+	require.NoError(t, err)
+	accepted, err := server.AcceptStream()
+	require.NoError(t, err)
+
+	// Ignore the window and send more than it allows.
+	chunk := make([]byte, maxPayload)
+	for sent := 0; sent <= initialStreamWindow; sent += len(chunk) {
+		require.NoError(t, client.writeFrame(frameData, 0, st.StreamID(), chunk))
+	}
+
+	_, err = st.Read(make([]byte, 1))
+	requireErrorCode(t, err, "STREAM_RESET")
+	_, err = io.ReadAll(accepted)
+	requireErrorCode(t, err, "STREAM_RESET")
+	assert.False(t, server.IsClosed(), "only the stream is reset")
+}
+
+func TestStreamHalfClose(t *testing.T) {
+	client, server := sessionPair(t, nil, nil)
+
+	st, err := client.OpenStream()
+	require.NoError(t, err)
+	_, err = st.Write([]byte("question"))
+	require.NoError(t, err)
+	require.NoError(t, st.CloseWrite())
+
+	accepted, err := server.AcceptStream()
+	require.NoError(t, err)
+	got, err := io.ReadAll(accepted)
+	require.NoError(t, err)
+	assert.Equal(t, "question", string(got))
+
+	_, err = st.Write([]byte("more"))
+	requireErrorCode(t, err, "STREAM_CLOSED")
+
+	// The other direction stays open.
+	_, err = accepted.Write([]byte("answer"))
+	require.NoError(t, err)
+	require.NoError(t, accepted.CloseWrite())
+	got, err = io.ReadAll(st)
+	require.NoError(t, err)
+	assert.Equal(t, "answer", string(got))
+
+	require.Eventually(t, func() bool {
+		return client.NumStreams() == 0 && server.NumStreams() == 0
+	}, 5*time.Second, 10*time.Millisecond)
+}
+
+func TestStreamReset(t *testing.T) {
+	client, server := sessionPair(t, nil, nil)
+
+	st, err := client.OpenStream()
+	require.NoError(t, err)
+	accepted, err := server.AcceptStream()
+	require.NoError(t, err)
+
+	readErr := make(chan error, 1)
+	go func() {
+		_, err := accepted.Read(make([]byte, 1))
+		readErr <- err
+	}()
+
+	require.NoError(t, st.Reset())
+	assert.Zero(t, client.NumStreams())
+	_, err = st.Write([]byte("x"))
+	requireErrorCode(t, err, "STREAM_RESET")
+	assert.ErrorIs(t, err, ErrStreamReset)
+
+	select {
+	case err := <-readErr:
+		requireErrorCode(t, err, "STREAM_RESET")
+	case <-time.After(5 * time.Second):
+		t.Fatal("reset should wake the peer's reader")
+	}
+	_, err = accepted.Write([]byte("x"))
+	requireErrorCode(t, err, "STREAM_RESET")
+	assert.Zero(t, server.NumStreams())
+}
+
+func TestStreamCloseReleasesStream(t *testing.T) {
+	client, server := sessionPair(t, nil, nil)
+
+	st, err := client.OpenStream()
+	require.NoError(t, err)
+	accepted, err := server.AcceptStream()
+	require.NoError(t, err)
+
+	_, err = accepted.Write([]byte("reply"))
+	require.NoError(t, err)
+	require.NoError(t, accepted.Close())
+	assert.Zero(t, server.NumStreams(), "Close must not wait for the peer's FIN")
+	_, err = accepted.Read(make([]byte, 1))
+	requireErrorCode(t, err, "STREAM_CLOSED")
+
+	// The peer still reads what was sent before Close, then EOF.
+	got, err := io.ReadAll(st)
+	require.NoError(t, err)
+	assert.Equal(t, "reply", string(got))
+
+	// Its writes fail instead of stalling on a window nobody reads.
+	require.NoError(t, st.SetWriteDeadline(time.Now().Add(5*time.Second)))
+	_, err = st.Write(make([]byte, 2*initialStreamWindow))
+	requireErrorCode(t, err, "STREAM_RESET")
+	assert.Zero(t, client.NumStreams())
+}
+
+func TestStreamCloseDoesNotStallDrain(t *testing.T) {
+	client, server := sessionPair(t, nil, nil)
+
+	st, err := client.OpenStream()
+	require.NoError(t, err)
+	_, err = server.AcceptStream()
+	require.NoError(t, err)
+
+	// The peer never half-closes, yet closing the stream lets the
+	// draining session finish.
+	client.drain()
+	assert.False(t, client.IsClosed(), "the open stream holds the drain")
+	require.NoError(t, st.Close())
+
+	require.Eventually(t, client.IsClosed, 5*time.Second, 10*time.Millisecond,
+		"closing the last stream should finish the drain")
+}
+
+func TestStreamConcurrentWriters(t *testing.T) {
+	client, server := sessionPair(t, nil, nil)
+
+	st, err := client.OpenStream()
+	require.NoError(t, err)
+	accepted, err := server.AcceptStream()
+	require.NoError(t, err)
+
+	// Exhaust the window so both writers block on it.
+	_, err = st.Write(make([]byte, initialStreamWindow))
+	require.NoError(t, err)
+
+	const each = 64 * 1024
+	var wg sync.WaitGroup
+	errs := make(chan error, 2)
+	for range 2 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := st.Write(make([]byte, each))
+			errs <- err
+		}()
+	}
+
+	// Reading half the window returns it in a single update, which is
+	// enough for both writers; each must wake and finish.
+	time.Sleep(50 * time.Millisecond)
+	_, err = io.ReadFull(accepted, make([]byte, initialStreamWindow/2))
+	require.NoError(t, err)
+
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("a window update should wake every blocked writer")
+	}
+	for range 2 {
+		require.NoError(t, <-errs)
+	}
+	_, err = io.ReadFull(accepted, make([]byte, initialStreamWindow/2+2*each))
+	require.NoError(t, err)
+}
+
+func TestStreamReadDeadline(t *testing.T) {
+	client, _ := sessionPair(t, nil, nil)
+
+	st, err := client.OpenStream()
+	require.NoError(t, err)
+
+	require.NoError(t, st.SetReadDeadline(time.Now().Add(50*time.Millisecond)))
+	_, err = st.Read(make([]byte, 1))
+	requireErrorCode(t, err, "DEADLINE_EXCEEDED")
+	assert.True(t, errors.Is(err, os.ErrDeadlineExceeded))
+	ne, ok := err.(net.Error)
+	require.True(t, ok, "stream errors should satisfy net.Error")
+	assert.True(t, ne.Timeout())
+
+	// Moving the deadline wakes a blocked reader.
+	require.NoError(t, st.SetReadDeadline(time.Time{}))
+	readErr := make(chan error, 1)
+	go func() {
+		_, err := st.Read(make([]byte, 1))
+		readErr <- err
+	}()
+	time.Sleep(20 * time.Millisecond)
+	require.NoError(t, st.SetReadDeadline(time.Now()))
+	select {
+	case err := <-readErr:
+		assert.True(t, errors.Is(err, os.ErrDeadlineExceeded))
+	case <-time.After(5 * time.Second):
+		t.Fatal("deadline change should wake the reader")
+	}
+}
@@ -7,6 +7,7 @@ import (
 	"fmt"
 	"net"
 
+	noise "github.com/go-i2p/go-noise"
 	"github.com/samber/oops"
 )
 
@@ -35,7 +36,7 @@ func NewNTCP2Addr(underlying net.Addr, routerHash []byte, role string) (*NTCP2Ad
 		return nil, oops.
 			Code("INVALID_UNDERLYING_ADDR").
 			In("ntcp2").
-			Errorf("underlying address cannot be nil")
+			Wrapf(noise.ErrInvalidConfig, "underlying address cannot be nil")
 	}
 
 	if len(routerHash) != 32 {
@@ -43,7 +44,7 @@ func NewNTCP2Addr(underlying net.Addr, routerHash []byte, role string) (*NTCP2Ad
 			Code("INVALID_ROUTER_HASH").
 			In("ntcp2").
 			With("hash_length", len(routerHash)).
-			Errorf("router hash must be exactly 32 bytes")
+			Wrapf(noise.ErrInvalidConfig, "router hash must be exactly 32 bytes")
 	}
 
 	if role != "initiator" && role != "responder" {
@@ -51,7 +52,7 @@ func NewNTCP2Addr(underlying net.Addr, routerHash []byte, role string) (*NTCP2Ad
 			Code("INVALID_ROLE").
 			In("ntcp2").
 			With("role", role).
-			Errorf("role must be 'initiator' or 'responder'")
+			Wrapf(noise.ErrInvalidConfig, "role must be 'initiator' or 'responder'")
 	}
 
 	// Make defensive copy of router hash
@@ -73,7 +74,7 @@ func (na *NTCP2Addr) WithDestinationHash(destHash []byte) (*NTCP2Addr, error) {
 			Code("INVALID_DEST_HASH").
 			In("ntcp2").
 			With("hash_length", len(destHash)).
-			Errorf("destination hash must be exactly 32 bytes or nil")
+			Wrapf(noise.ErrInvalidConfig, "destination hash must be exactly 32 bytes or nil")
 	}
 
 	// Create new instance with defensive copy
@@ -105,7 +106,7 @@ func (na *NTCP2Addr) WithSessionTag(sessionTag []byte) (*NTCP2Addr, error) {
 			Code("INVALID_SESSION_TAG").
 			In("ntcp2").
 			With("tag_length", len(sessionTag)).
-			Errorf("session tag must be exactly 8 bytes or nil")
+			Wrapf(noise.ErrInvalidConfig, "session tag must be exactly 8 bytes or nil")
 	}
 
 	// Create new instance with defensive copy
@@ -4,6 +4,7 @@ import (
 	"crypto/aes"
 	"crypto/cipher"
 
+	noise "github.com/go-i2p/go-noise"
 	"github.com/go-i2p/go-noise/handshake"
 	"github.com/samber/oops"
 )
@@ -27,7 +28,7 @@ func NewAESObfuscationModifier(name string, routerHash, iv []byte) (*AESObfuscat
 			Code("INVALID_ROUTER_HASH").
 			In("ntcp2").
 			With("hash_length", len(routerHash)).
-			Errorf("router hash must be exactly 32 bytes")
+			Wrapf(noise.ErrInvalidConfig, "router hash must be exactly 32 bytes")
 	}
 
 	if len(iv) != 16 {
@@ -35,7 +36,7 @@ func NewAESObfuscationModifier(name string, routerHash, iv []byte) (*AESObfuscat
 			Code("INVALID_IV").
 			In("ntcp2").
 			With("iv_length", len(iv)).
-			Errorf("IV must be exactly 16 bytes")
+			Wrapf(noise.ErrInvalidConfig, "IV must be exactly 16 bytes")
 	}
 
 	// Make defensive copies
@@ -85,7 +86,7 @@ func (aom *AESObfuscationModifier) ModifyOutbound(phase handshake.HandshakePhase
 				Code("MISSING_AES_STATE").
 				In("ntcp2").
 				With("modifier_name", aom.name).
-				Errorf("AES state not available for message 2")
+				Wrapf(noise.ErrHandshakeFailed, "AES state not available for message 2")
 		}
 		mode = cipher.NewCBCEncrypter(block, aom.aesState)
 	default:
@@ -131,7 +132,7 @@ func (aom *AESObfuscationModifier) ModifyInbound(phase handshake.HandshakePhase,
 				Code("MISSING_AES_STATE").
 				In("ntcp2").
 				With("modifier_name", aom.name).
-				Errorf("AES state not available for message 2")
+				Wrapf(noise.ErrHandshakeFailed, "AES state not available for message 2")
 		}
 		mode = cipher.NewCBCDecrypter(block, aom.aesState)
 	default:
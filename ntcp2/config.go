@@ -100,7 +100,7 @@ func NewNTCP2Config(routerHash []byte, initiator bool) (*NTCP2Config, error) {
 			Code("INVALID_ROUTER_HASH").
 			In("ntcp2").
 			With("hash_length", len(routerHash)).
-			Errorf("router hash must be exactly 32 bytes")
+			Wrapf(noise.ErrInvalidConfig, "router hash must be exactly 32 bytes")
 	}
 
 	// Make defensive copy of router hash
@@ -260,7 +260,7 @@ func (nc *NTCP2Config) validateBasicConfiguration() error {
 		return oops.
 			Code("MISSING_PATTERN").
 			In("ntcp2").
-			Errorf("noise pattern is required")
+			Wrapf(noise.ErrInvalidConfig, "noise pattern is required")
 	}
 
 	// Validate router hash
@@ -269,7 +269,7 @@ func (nc *NTCP2Config) validateBasicConfiguration() error {
 			Code("INVALID_ROUTER_HASH").
 			In("ntcp2").
 			With("hash_length", len(nc.RouterHash)).
-			Errorf("router hash must be exactly 32 bytes")
+			Wrapf(noise.ErrInvalidConfig, "router hash must be exactly 32 bytes")
 	}
 
 	return nil
@@ -283,7 +283,7 @@ func (nc *NTCP2Config) validateCryptographicParameters() error {
 			Code("INVALID_STATIC_KEY").
 			In("ntcp2").
 			With("key_length", len(nc.StaticKey)).
-			Errorf("static key must be 32 bytes")
+			Wrapf(noise.ErrInvalidConfig, "static key must be 32 bytes")
 	}
 
 	// Validate remote router hash if provided
@@ -292,7 +292,7 @@ func (nc *NTCP2Config) validateCryptographicParameters() error {
 			Code("INVALID_REMOTE_ROUTER_HASH").
 			In("ntcp2").
 			With("hash_length", len(nc.RemoteRouterHash)).
-			Errorf("remote router hash must be 32 bytes")
+			Wrapf(noise.ErrInvalidConfig, "remote router hash must be 32 bytes")
 	}
 
 	// For initiator connections, remote router hash is required
@@ -300,7 +300,7 @@ func (nc *NTCP2Config) validateCryptographicParameters() error {
 		return oops.
 			Code("MISSING_REMOTE_ROUTER_HASH").
 			In("ntcp2").
-			Errorf("remote router hash is required for initiator connections")
+			Wrapf(noise.ErrInvalidConfig, "remote router hash is required for initiator connections")
 	}
 
 	// Validate AES obfuscation IV if provided
@@ -309,7 +309,7 @@ func (nc *NTCP2Config) validateCryptographicParameters() error {
 			Code("INVALID_OBFUSCATION_IV").
 			In("ntcp2").
 			With("iv_length", len(nc.ObfuscationIV)).
-			Errorf("obfuscation IV must be 16 bytes")
+			Wrapf(noise.ErrInvalidConfig, "obfuscation IV must be 16 bytes")
 	}
 
 	return nil
@@ -323,7 +323,7 @@ func (nc *NTCP2Config) validateTimeoutConfiguration() error {
 			Code("INVALID_HANDSHAKE_TIMEOUT").
 			In("ntcp2").
 			With("timeout", nc.HandshakeTimeout).
-			Errorf("handshake timeout must be positive")
+			Wrapf(noise.ErrInvalidConfig, "handshake timeout must be positive")
 	}
 
 	// Validate retry configuration
@@ -332,7 +332,7 @@ func (nc *NTCP2Config) validateTimeoutConfiguration() error {
 			Code("INVALID_RETRY_COUNT").
 			In("ntcp2").
 			With("retries", nc.HandshakeRetries).
-			Errorf("handshake retries must be >= -1")
+			Wrapf(noise.ErrInvalidConfig, "handshake retries must be >= -1")
 	}
 
 	if nc.RetryBackoff < 0 {
@@ -340,7 +340,7 @@ func (nc *NTCP2Config) validateTimeoutConfiguration() error {
 			Code("INVALID_RETRY_BACKOFF").
 			In("ntcp2").
 			With("backoff", nc.RetryBackoff).
-			Errorf("retry backoff must be non-negative")
+			Wrapf(noise.ErrInvalidConfig, "retry backoff must be non-negative")
 	}
 
 	return nil
@@ -354,7 +354,7 @@ func (nc *NTCP2Config) validateFrameConfiguration() error {
 			Code("INVALID_MAX_FRAME_SIZE").
 			In("ntcp2").
 			With("max_size", nc.MaxFrameSize).
-			Errorf("max frame size must be positive")
+			Wrapf(noise.ErrInvalidConfig, "max frame size must be positive")
 	}
 
 	if nc.MinPaddingSize < 0 {
@@ -362,7 +362,7 @@ func (nc *NTCP2Config) validateFrameConfiguration() error {
 			Code("INVALID_MIN_PADDING").
 			In("ntcp2").
 			With("min_padding", nc.MinPaddingSize).
-			Errorf("min padding size must be non-negative")
+			Wrapf(noise.ErrInvalidConfig, "min padding size must be non-negative")
 	}
 
 	if nc.MaxPaddingSize < nc.MinPaddingSize {
@@ -371,7 +371,7 @@ func (nc *NTCP2Config) validateFrameConfiguration() error {
 			In("ntcp2").
 			With("min_padding", nc.MinPaddingSize).
 			With("max_padding", nc.MaxPaddingSize).
-			Errorf("max padding size must be >= min padding size")
+			Wrapf(noise.ErrInvalidConfig, "max padding size must be >= min padding size")
 	}
 
 	return nil
@@ -5,6 +5,7 @@ import (
 	"time"
 
 	noise "github.com/go-i2p/go-noise"
+	"github.com/go-i2p/go-noise/internal"
 	"github.com/go-i2p/logger"
 	"github.com/samber/oops"
 )
@@ -33,21 +34,21 @@ func NewNTCP2Conn(noiseConn *noise.NoiseConn, localAddr, remoteAddr *NTCP2Addr)
 		return nil, oops.
 			Code("INVALID_NOISE_CONN").
 			In("ntcp2").
-			Errorf("noise connection cannot be nil")
+			Wrapf(noise.ErrInvalidConfig, "noise connection cannot be nil")
 	}
 
 	if localAddr == nil {
 		return nil, oops.
 			Code("INVALID_LOCAL_ADDR").
 			In("ntcp2").
-			Errorf("local address cannot be nil")
+			Wrapf(noise.ErrInvalidConfig, "local address cannot be nil")
 	}
 
 	if remoteAddr == nil {
 		return nil, oops.
 			Code("INVALID_REMOTE_ADDR").
 			In("ntcp2").
-			Errorf("remote address cannot be nil")
+			Wrapf(noise.ErrInvalidConfig, "remote address cannot be nil")
 	}
 	conn := &NTCP2Conn{
 		noiseConn:  noiseConn,
@@ -68,13 +69,13 @@ func NewNTCP2Conn(noiseConn *noise.NoiseConn, localAddr, remoteAddr *NTCP2Addr)
 func (nc *NTCP2Conn) Read(b []byte) (int, error) {
 	n, err := nc.noiseConn.Read(b)
 	if err != nil {
-		return 0, oops.
+		return 0, internal.NetError(oops.
 			Code("READ_FAILED").
 			In("ntcp2").
 			With("local_addr", nc.localAddr.String()).
 			With("remote_addr", nc.remoteAddr.String()).
 			With("bytes_requested", len(b)).
-			Wrapf(err, "ntcp2 read failed")
+			Wrapf(err, "ntcp2 read failed"))
 	}
 
 	nc.logger.Trace("NTCP2 data read",
@@ -90,13 +91,13 @@ func (nc *NTCP2Conn) Read(b []byte) (int, error) {
 func (nc *NTCP2Conn) Write(b []byte) (int, error) {
 	n, err := nc.noiseConn.Write(b)
 	if err != nil {
-		return 0, oops.
+		return 0, internal.NetError(oops.
 			Code("WRITE_FAILED").
 			In("ntcp2").
 			With("local_addr", nc.localAddr.String()).
 			With("remote_addr", nc.remoteAddr.String()).
 			With("bytes_to_write", len(b)).
-			Wrapf(err, "ntcp2 write failed")
+			Wrapf(err, "ntcp2 write failed"))
 	}
 
 	nc.logger.Trace("NTCP2 data written",
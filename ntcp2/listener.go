@@ -6,6 +6,7 @@ import (
 	"sync"
 
 	noise "github.com/go-i2p/go-noise"
+	"github.com/go-i2p/go-noise/internal"
 	"github.com/go-i2p/logger"
 	"github.com/samber/oops"
 )
@@ -65,14 +66,14 @@ func validateListenerInput(underlying net.Listener, config *NTCP2Config) error {
 		return oops.
 			Code("INVALID_UNDERLYING_LISTENER").
 			In("ntcp2").
-			Errorf("underlying listener cannot be nil")
+			Wrapf(noise.ErrInvalidConfig, "underlying listener cannot be nil")
 	}
 
 	if config == nil {
 		return oops.
 			Code("INVALID_CONFIG").
 			In("ntcp2").
-			Errorf("ntcp2 config cannot be nil")
+			Wrapf(noise.ErrInvalidConfig, "ntcp2 config cannot be nil")
 	}
 
 	if err := config.Validate(); err != nil {
@@ -80,7 +81,7 @@ func validateListenerInput(underlying net.Listener, config *NTCP2Config) error {
 			Code("INVALID_CONFIG").
 			In("ntcp2").
 			With("listener_addr", underlying.Addr().String()).
-			Wrapf(err, "invalid ntcp2 listener configuration")
+			Wrapf(internal.Mark(err, noise.ErrInvalidConfig), "invalid ntcp2 listener configuration")
 	}
 
 	return nil
@@ -162,7 +163,7 @@ func (nl *NTCP2Listener) validateAndCastNoiseConn(conn net.Conn) (*noise.NoiseCo
 			Code("INVALID_CONN_TYPE").
 			In("ntcp2").
 			With("listener_addr", nl.addr.String()).
-			Errorf("expected *noise.NoiseConn from noise listener")
+			Wrapf(noise.ErrInvalidConfig, "expected *noise.NoiseConn from noise listener")
 	}
 	return actualNoiseConn, nil
 }
@@ -201,6 +202,12 @@ func (nl *NTCP2Listener) wrapInNTCP2Conn(noiseConn *noise.NoiseConn, remoteAddr
 // Accept waits for and returns the next connection to the listener.
 // The returned connection is wrapped in an NTCP2Conn configured as a responder.
 func (nl *NTCP2Listener) Accept() (net.Conn, error) {
+	conn, err := nl.accept()
+	return conn, internal.NetError(err)
+}
+
+// accept implements Accept.
+func (nl *NTCP2Listener) accept() (net.Conn, error) {
 	nl.acceptMutex.Lock()
 	defer nl.acceptMutex.Unlock()
 
@@ -229,7 +236,7 @@ func (nl *NTCP2Listener) validateAcceptState() error {
 			Code("LISTENER_CLOSED").
 			In("ntcp2").
 			With("listener_addr", nl.addr.String()).
-			Errorf("ntcp2 listener is closed")
+			Wrapf(noise.ErrListenerClosed, "ntcp2 listener is closed")
 	}
 	return nil
 }
@@ -7,6 +7,7 @@ import (
 	"testing"
 	"time"
 
+	noise "github.com/go-i2p/go-noise"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -329,6 +330,10 @@ func TestNTCP2ListenerAcceptAfterClose(t *testing.T) {
 	assert.Error(t, err)
 	assert.Nil(t, conn)
 	assert.Contains(t, err.Error(), "ntcp2 listener is closed")
+	assert.ErrorIs(t, err, noise.ErrListenerClosed)
+	assert.ErrorIs(t, err, net.ErrClosed)
+	_, ok := err.(net.Error)
+	assert.True(t, ok, "Accept errors should satisfy net.Error")
 }
 
 func TestNTCP2ListenerConcurrentClose(t *testing.T) {
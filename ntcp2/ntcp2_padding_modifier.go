@@ -5,6 +5,7 @@ import (
 	"encoding/binary"
 	"math"
 
+	noise "github.com/go-i2p/go-noise"
 	"github.com/go-i2p/go-noise/handshake"
 	"github.com/samber/oops"
 )
@@ -55,7 +56,7 @@ func NewNTCP2PaddingModifierWithRatio(name string, minPadding, maxPadding int, u
 			Code("INVALID_PADDING").
 			In("ntcp2").
 			With("min_padding", minPadding).
-			Errorf("minimum padding cannot be negative")
+			Wrapf(noise.ErrInvalidConfig, "minimum padding cannot be negative")
 	}
 
 	if maxPadding < minPadding {
@@ -64,7 +65,7 @@ func NewNTCP2PaddingModifierWithRatio(name string, minPadding, maxPadding int, u
 			In("ntcp2").
 			With("min_padding", minPadding).
 			With("max_padding", maxPadding).
-			Errorf("maximum padding cannot be less than minimum padding")
+			Wrapf(noise.ErrInvalidConfig, "maximum padding cannot be less than minimum padding")
 	}
 
 	// I2P NTCP2 spec: maximum single block data size is 65516 bytes
@@ -73,7 +74,7 @@ func NewNTCP2PaddingModifierWithRatio(name string, minPadding, maxPadding int, u
 			Code("INVALID_PADDING").
 			In("ntcp2").
 			With("max_padding", maxPadding).
-			Errorf("maximum padding cannot exceed 65516 bytes (I2P NTCP2 spec limit)")
+			Wrapf(noise.ErrInvalidConfig, "maximum padding cannot exceed 65516 bytes (I2P NTCP2 spec limit)")
 	}
 
 	// I2P NTCP2 spec: padding ratio range is 0.0 to 15.9375
@@ -82,7 +83,7 @@ func NewNTCP2PaddingModifierWithRatio(name string, minPadding, maxPadding int, u
 			Code("INVALID_PADDING_RATIO").
 			In("ntcp2").
 			With("padding_ratio", paddingRatio).
-			Errorf("padding ratio must be between 0.0 and 15.9375 (I2P NTCP2 spec)")
+			Wrapf(noise.ErrInvalidConfig, "padding ratio must be between 0.0 and 15.9375 (I2P NTCP2 spec)")
 	}
 
 	return &NTCP2PaddingModifier{
@@ -321,7 +322,7 @@ func (npm *NTCP2PaddingModifier) SetPaddingRatio(ratio float64) error {
 			Code("INVALID_PADDING_RATIO").
 			In("ntcp2").
 			With("padding_ratio", ratio).
-			Errorf("padding ratio must be between 0.0 and 15.9375 (I2P NTCP2 spec)")
+			Wrapf(noise.ErrInvalidConfig, "padding ratio must be between 0.0 and 15.9375 (I2P NTCP2 spec)")
 	}
 	npm.paddingRatio = ratio
 	return nil
@@ -345,7 +346,7 @@ func (npm *NTCP2PaddingModifier) SetPaddingLimits(minPadding, maxPadding int) er
 			Code("INVALID_PADDING").
 			In("ntcp2").
 			With("min_padding", minPadding).
-			Errorf("minimum padding cannot be negative")
+			Wrapf(noise.ErrInvalidConfig, "minimum padding cannot be negative")
 	}
 
 	if maxPadding < minPadding {
@@ -354,7 +355,7 @@ func (npm *NTCP2PaddingModifier) SetPaddingLimits(minPadding, maxPadding int) er
 			In("ntcp2").
 			With("min_padding", minPadding).
 			With("max_padding", maxPadding).
-			Errorf("maximum padding cannot be less than minimum padding")
+			Wrapf(noise.ErrInvalidConfig, "maximum padding cannot be less than minimum padding")
 	}
 
 	if maxPadding > 65516 {
@@ -362,7 +363,7 @@ func (npm *NTCP2PaddingModifier) SetPaddingLimits(minPadding, maxPadding int) er
 			Code("INVALID_PADDING").
 			In("ntcp2").
 			With("max_padding", maxPadding).
-			Errorf("maximum padding cannot exceed 65516 bytes (I2P NTCP2 spec limit)")
+			Wrapf(noise.ErrInvalidConfig, "maximum padding cannot exceed 65516 bytes (I2P NTCP2 spec limit)")
 	}
 
 	npm.minPadding = minPadding
@@ -5,6 +5,7 @@ import (
 	"net"
 
 	noise "github.com/go-i2p/go-noise"
+	"github.com/go-i2p/go-noise/internal"
 	"github.com/samber/oops"
 )
 
@@ -52,7 +53,7 @@ func DialNTCP2WithHandshakeContext(ctx context.Context, network, addr string, co
 			In("ntcp2").
 			With("network", network).
 			With("address", addr).
-			Wrapf(err, "NTCP2 handshake failed")
+			Wrapf(internal.Mark(err, noise.ErrHandshakeFailed), "NTCP2 handshake failed")
 	}
 
 	return ntcp2Conn, nil
@@ -121,14 +122,14 @@ func validateWrapConnParams(conn net.Conn, config *NTCP2Config) error {
 		return oops.
 			Code("INVALID_CONNECTION").
 			In("ntcp2").
-			Errorf("connection cannot be nil")
+			Wrapf(noise.ErrInvalidConfig, "connection cannot be nil")
 	}
 
 	if config == nil {
 		return oops.
 			Code("INVALID_CONFIG").
 			In("ntcp2").
-			Errorf("config cannot be nil")
+			Wrapf(noise.ErrInvalidConfig, "config cannot be nil")
 	}
 
 	return nil
@@ -176,7 +177,7 @@ func validateDialParams(network, addr string, config *NTCP2Config) error {
 		return oops.
 			Code("CONFIG_VALIDATION_FAILED").
 			In("ntcp2").
-			Wrapf(err, "NTCP2 config validation failed")
+			Wrapf(internal.Mark(err, noise.ErrInvalidConfig), "NTCP2 config validation failed")
 	}
 
 	return nil
@@ -188,21 +189,21 @@ func validateBasicDialParams(network, addr string, config *NTCP2Config) error {
 		return oops.
 			Code("INVALID_NETWORK").
 			In("ntcp2").
-			Errorf("network cannot be empty")
+			Wrapf(noise.ErrInvalidConfig, "network cannot be empty")
 	}
 
 	if addr == "" {
 		return oops.
 			Code("INVALID_ADDRESS").
 			In("ntcp2").
-			Errorf("address cannot be empty")
+			Wrapf(noise.ErrInvalidConfig, "address cannot be empty")
 	}
 
 	if config == nil {
 		return oops.
 			Code("INVALID_CONFIG").
 			In("ntcp2").
-			Errorf("config cannot be nil")
+			Wrapf(noise.ErrInvalidConfig, "config cannot be nil")
 	}
 
 	return nil
@@ -214,7 +215,7 @@ func validateDialConfiguration(config *NTCP2Config) error {
 		return oops.
 			Code("INVALID_INITIATOR_FLAG").
 			In("ntcp2").
-			Errorf("dial operations require initiator=true in config")
+			Wrapf(noise.ErrInvalidConfig, "dial operations require initiator=true in config")
 	}
 
 	return nil
@@ -235,7 +236,7 @@ func validateListenParams(network, addr string, config *NTCP2Config) error {
 		return oops.
 			Code("CONFIG_VALIDATION_FAILED").
 			In("ntcp2").
-			Wrapf(err, "NTCP2 config validation failed")
+			Wrapf(internal.Mark(err, noise.ErrInvalidConfig), "NTCP2 config validation failed")
 	}
 
 	return nil
@@ -247,21 +248,21 @@ func validateBasicListenParams(network, addr string, config *NTCP2Config) error
 		return oops.
 			Code("INVALID_NETWORK").
 			In("ntcp2").
-			Errorf("network cannot be empty")
+			Wrapf(noise.ErrInvalidConfig, "network cannot be empty")
 	}
 
 	if addr == "" {
 		return oops.
 			Code("INVALID_ADDRESS").
 			In("ntcp2").
-			Errorf("address cannot be empty")
+			Wrapf(noise.ErrInvalidConfig, "address cannot be empty")
 	}
 
 	if config == nil {
 		return oops.
 			Code("INVALID_CONFIG").
 			In("ntcp2").
-			Errorf("config cannot be nil")
+			Wrapf(noise.ErrInvalidConfig, "config cannot be nil")
 	}
 
 	return nil
@@ -273,7 +274,7 @@ func validateListenConfiguration(config *NTCP2Config) error {
 		return oops.
 			Code("INVALID_INITIATOR_FLAG").
 			In("ntcp2").
-			Errorf("listen operations require initiator=false in config")
+			Wrapf(noise.ErrInvalidConfig, "listen operations require initiator=false in config")
 	}
 
 	return nil
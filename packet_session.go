@@ -0,0 +1,582 @@
+package noise
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"net"
+	"time"
+
+	"github.com/go-i2p/noise"
+	"github.com/samber/oops"
+	"github.com/sirupsen/logrus"
+)
+
+// Datagram types. Every datagram starts with one of these.
+const (
+	// packetTypeHandshake is followed by the message index and the handshake message
+	packetTypeHandshake byte = 0x01
+	// packetTypeTransport is followed by an 8-byte big-endian nonce and the ciphertext
+	packetTypeTransport byte = 0x02
+)
+
+// Header sizes of the two datagram types.
+const (
+	handshakeHeaderLen = 2
+	transportHeaderLen = 1 + 8
+)
+
+// errHandshakeSuperseded ends a handshake replaced by one the peer started,
+// for example after a simultaneous open; waiters retry with the new one.
+// It is never returned to callers.
+var errHandshakeSuperseded = errors.New("handshake superseded by the peer's handshake")
+
+// packetPeer is the session state for one remote address.
+// All fields are guarded by NoisePacketConn.mu.
+type packetPeer struct {
+	// addr is the peer's underlying address
+	addr net.Addr
+
+	// handshake is the handshake in progress, if any
+	handshake *packetHandshake
+
+	// finished is the last completed handshake, kept to answer retransmissions
+	finished *packetHandshake
+
+	// transport holds the keys of the established session, if any
+	transport *packetTransport
+
+	// pending holds the keys of a newer handshake we answered while a
+	// session was established. They replace transport once a datagram
+	// authenticates under them, so a forged first message cannot end the
+	// session.
+	pending *packetTransport
+
+	// lastActive is when authenticated traffic last passed in either direction
+	lastActive time.Time
+}
+
+// packetHandshake tracks one handshake with a peer.
+type packetHandshake struct {
+	state     *noise.HandshakeState
+	initiator bool
+
+	// count is the number of messages in the pattern, next the index of the
+	// next message to send or receive
+	count int
+	next  int
+
+	// first is the first handshake message, as received by a responder
+	first []byte
+
+	// lastSent is the last handshake datagram sent, lastIndex its message
+	// index (or -1) and sentAt when it was last sent
+	lastSent  []byte
+	lastIndex int
+	sentAt    time.Time
+
+	started time.Time
+
+	// done is closed when the handshake completes or fails; err is set first
+	done chan struct{}
+	err  error
+}
+
+// ourTurn reports whether the next handshake message is ours to send.
+// The initiator sends the even-numbered messages.
+func (h *packetHandshake) ourTurn() bool {
+	return (h.next%2 == 0) == h.initiator
+}
+
+// packetTransport holds the keys of an established session.
+type packetTransport struct {
+	send, recv noise.Cipher
+
+	// sendNonce is the explicit nonce of the next datagram sent
+	sendNonce uint64
+
+	// replay filters duplicate and replayed nonces
+	replay replayWindow
+
+	// peerStatic is the peer's static key, if the pattern conveyed it
+	peerStatic []byte
+
+	// receiveOnly is set on the responder of a one-way pattern, which must not send
+	receiveOnly bool
+
+	// confirmed is set once an authenticated datagram arrives, which shows
+	// the peer completed the handshake
+	confirmed bool
+}
+
+// establish returns the session with addr, starting a handshake as
+// initiator if there is none. It waits for a handshake in progress, until
+// ctx is done or deadline is closed.
+func (pc *NoisePacketConn) establish(ctx context.Context, addr net.Addr, deadline <-chan struct{}) (*packetTransport, error) {
+	for {
+		if isClosedChan(pc.done) {
+			return nil, pc.closedError()
+		}
+
+		pc.mu.Lock()
+		peer := pc.peers[addr.String()]
+		if peer != nil && peer.transport != nil {
+			t := peer.transport
+			pc.mu.Unlock()
+			return t, nil
+		}
+
+		var h *packetHandshake
+		if peer != nil && peer.handshake != nil {
+			h = peer.handshake
+		} else {
+			var err error
+			if h, err = pc.startHandshake(addr); err != nil {
+				pc.mu.Unlock()
+				return nil, err
+			}
+		}
+		pc.mu.Unlock()
+
+		select {
+		case <-h.done:
+			if h.err != nil && !errors.Is(h.err, errHandshakeSuperseded) {
+				return nil, h.err
+			}
+		case <-ctx.Done():
+			return nil, oops.
+				Code("HANDSHAKE_INTERRUPTED").
+				In("noise").
+				With("remote_addr", addr.String()).
+				Wrapf(markInterrupted(ctx.Err()), "handshake interrupted")
+		case <-deadline:
+			return nil, deadlineError("write")
+		case <-pc.done:
+			return nil, pc.closedError()
+		}
+	}
+}
+
+// startHandshake begins a handshake with addr as initiator.
+// The caller must hold mu.
+func (pc *NoisePacketConn) startHandshake(addr net.Addr) (*packetHandshake, error) {
+	h, err := pc.newHandshake(true)
+	if err != nil {
+		return nil, err
+	}
+
+	peer := pc.peerFor(addr)
+	peer.handshake = h
+	if err := pc.sendHandshakeMessage(peer, h); err != nil {
+		pc.failHandshake(peer, h, err)
+		return nil, err
+	}
+	return h, nil
+}
+
+// newHandshake creates the handshake state for one session.
+func (pc *NoisePacketConn) newHandshake(initiator bool) (*packetHandshake, error) {
+	hs, err := createHandshakeState(pc.config.connConfig(initiator))
+	if err != nil {
+		return nil, err
+	}
+
+	return &packetHandshake{
+		state:     hs,
+		initiator: initiator,
+		count:     len(pc.protocol.Pattern.Messages),
+		lastIndex: -1,
+		started:   time.Now(),
+		done:      make(chan struct{}),
+	}, nil
+}
+
+// peerFor returns the peer for addr, creating it if needed.
+// The caller must hold mu.
+func (pc *NoisePacketConn) peerFor(addr net.Addr) *packetPeer {
+	peer := pc.peers[addr.String()]
+	if peer == nil {
+		peer = &packetPeer{addr: addr, lastActive: time.Now()}
+		pc.peers[addr.String()] = peer
+	}
+	return peer
+}
+
+// handlePacket dispatches one received datagram. Malformed and
+// unauthenticated datagrams are dropped, as a lossy network would.
+func (pc *NoisePacketConn) handlePacket(packet []byte, addr net.Addr) {
+	if len(packet) == 0 {
+		return
+	}
+
+	switch packet[0] {
+	case packetTypeHandshake:
+		if len(packet) < handshakeHeaderLen {
+			return
+		}
+		pc.mu.Lock()
+		pc.handleHandshakePacket(addr, int(packet[1]), packet[handshakeHeaderLen:])
+		pc.mu.Unlock()
+	case packetTypeTransport:
+		if len(packet) < transportHeaderLen+cipherTagLen {
+			return
+		}
+		pc.handleTransportPacket(addr, packet)
+	default:
+		pc.logger.WithFields(logrus.Fields{
+			"remote_addr": addr.String(),
+			"packet_type": packet[0],
+		}).Trace("Unknown datagram type dropped")
+	}
+}
+
+// handleHandshakePacket processes a handshake message, starting a
+// responder handshake for a new first message and answering retransmitted
+// messages with the reply already sent. The caller must hold mu.
+func (pc *NoisePacketConn) handleHandshakePacket(addr net.Addr, index int, body []byte) {
+	peer := pc.peers[addr.String()]
+
+	if index == 0 {
+		if peer != nil && pc.answerDuplicateFirst(peer, body) {
+			return
+		}
+		replacing := peer != nil && peer.handshake != nil && !peer.handshake.initiator
+		if pc.responders >= maxResponderHandshakes && !replacing {
+			pc.logger.WithFields(logrus.Fields{
+				"remote_addr": addr.String(),
+				"pending":     pc.responders,
+			}).Debug("First handshake message dropped, too many pending handshakes")
+			return
+		}
+		if peer != nil && peer.handshake != nil && peer.handshake.initiator {
+			h := peer.handshake
+			// Both sides started at once: the side whose first message
+			// sorts lower stays initiator and the other answers as
+			// responder. Both sides see both messages, unlike addresses,
+			// which differ behind NAT or on a wildcard bind.
+			if h.lastIndex == 0 && bytes.Compare(h.lastSent[handshakeHeaderLen:], body) < 0 {
+				return
+			}
+			pc.failHandshake(peer, h, errHandshakeSuperseded)
+		}
+		pc.respondToHandshake(addr, body)
+		return
+	}
+
+	if peer == nil {
+		return
+	}
+
+	if h := peer.handshake; h != nil && index == h.next && !h.ourTurn() {
+		if err := pc.readHandshakeMessage(peer, h, body); err != nil {
+			pc.failHandshake(peer, h, err)
+		}
+		return
+	}
+
+	pc.retransmitAnswer(peer, index)
+}
+
+// respondToHandshake starts a responder handshake from a first message.
+// An established session stays in use until the peer sends under the new
+// keys. The caller must hold mu.
+func (pc *NoisePacketConn) respondToHandshake(addr net.Addr, first []byte) {
+	h, err := pc.newHandshake(false)
+	if err != nil {
+		pc.logger.WithFields(logrus.Fields{
+			"remote_addr": addr.String(),
+			"error":       err.Error(),
+		}).Debug("Failed to start responder handshake")
+		return
+	}
+	h.first = cloneBytes(first)
+
+	peer := pc.peerFor(addr)
+	if peer.handshake != nil {
+		pc.failHandshake(peer, peer.handshake, errHandshakeSuperseded)
+		peer = pc.peerFor(addr)
+	}
+	peer.handshake = h
+	pc.responders++
+
+	if err := pc.readHandshakeMessage(peer, h, first); err != nil {
+		pc.failHandshake(peer, h, err)
+	}
+}
+
+// readHandshakeMessage processes the peer's next handshake message and
+// sends the reply, if it is our turn. The caller must hold mu.
+func (pc *NoisePacketConn) readHandshakeMessage(peer *packetPeer, h *packetHandshake, body []byte) error {
+	_, cs1, cs2, err := h.state.ReadMessage(nil, body)
+	if err != nil {
+		return oops.
+			Code("READ_MESSAGE_FAILED").
+			In("noise").
+			With("remote_addr", peer.addr.String()).
+			With("message_index", h.next).
+			Wrapf(markHandshakeReadError(err), "failed to read handshake message")
+	}
+	h.next++
+
+	if cs1 != nil {
+		pc.completeHandshake(peer, h, cs1, cs2)
+		return nil
+	}
+	if h.ourTurn() {
+		return pc.sendHandshakeMessage(peer, h)
+	}
+	return nil
+}
+
+// sendHandshakeMessage writes and sends our next handshake message.
+// The caller must hold mu.
+func (pc *NoisePacketConn) sendHandshakeMessage(peer *packetPeer, h *packetHandshake) error {
+	msg, cs1, cs2, err := h.state.WriteMessage(nil, nil)
+	if err != nil {
+		return oops.
+			Code("WRITE_MESSAGE_FAILED").
+			In("noise").
+			With("remote_addr", peer.addr.String()).
+			With("message_index", h.next).
+			Wrapf(err, "failed to write handshake message")
+	}
+
+	packet := append([]byte{packetTypeHandshake, byte(h.next)}, msg...)
+	h.lastSent = packet
+	h.lastIndex = h.next
+	h.sentAt = time.Now()
+	h.next++
+
+	if err := pc.writePacket(packet, peer.addr); err != nil {
+		return err
+	}
+
+	if cs1 != nil {
+		pc.completeHandshake(peer, h, cs1, cs2)
+	}
+	return nil
+}
+
+// completeHandshake installs the session keys and releases waiters.
+// The caller must hold mu.
+func (pc *NoisePacketConn) completeHandshake(peer *packetPeer, h *packetHandshake, cs1, cs2 *noise.CipherState) {
+	// cs1 carries initiator-to-responder traffic.
+	send, recv := cs1, cs2
+	if !h.initiator {
+		send, recv = cs2, cs1
+	}
+
+	t := &packetTransport{
+		send:        send.Cipher(),
+		recv:        recv.Cipher(),
+		peerStatic:  cloneBytes(h.state.PeerStatic()),
+		receiveOnly: h.count == 1 && !h.initiator,
+	}
+	// Anyone can send a first message from the peer's address, so a
+	// responder keeps the established session until the new keys are used.
+	if h.initiator || peer.transport == nil {
+		peer.transport = t
+		peer.pending = nil
+	} else {
+		peer.pending = t
+	}
+	peer.handshake = nil
+	peer.finished = h
+	peer.lastActive = time.Now()
+	h.state = nil
+	close(h.done)
+	if !h.initiator {
+		pc.responders--
+	}
+
+	pc.logger.WithFields(logrus.Fields{
+		"remote_addr": peer.addr.String(),
+		"initiator":   h.initiator,
+	}).Debug("Datagram handshake completed")
+}
+
+// failHandshake ends a handshake with err and forgets the peer if it has
+// no established session. The caller must hold mu.
+func (pc *NoisePacketConn) failHandshake(peer *packetPeer, h *packetHandshake, err error) {
+	h.err = err
+	close(h.done)
+	if !h.initiator {
+		pc.responders--
+	}
+	if peer.handshake == h {
+		peer.handshake = nil
+	}
+	if peer.transport == nil && peer.handshake == nil {
+		delete(pc.peers, peer.addr.String())
+	}
+
+	if !errors.Is(err, errHandshakeSuperseded) {
+		pc.logger.WithFields(logrus.Fields{
+			"remote_addr": peer.addr.String(),
+			"initiator":   h.initiator,
+			"error":       err.Error(),
+		}).Debug("Datagram handshake failed")
+	}
+}
+
+// answerDuplicateFirst resends our reply if body repeats the first message
+// of a handshake we answered. The caller must hold mu.
+func (pc *NoisePacketConn) answerDuplicateFirst(peer *packetPeer, body []byte) bool {
+	for _, h := range []*packetHandshake{peer.handshake, peer.finished} {
+		if h != nil && !h.initiator && bytes.Equal(h.first, body) {
+			if h.lastIndex == 1 {
+				_ = pc.writePacket(h.lastSent, peer.addr)
+			}
+			return true
+		}
+	}
+	return false
+}
+
+// retransmitAnswer resends our last handshake message if it answered the
+// message with the given index, which the peer evidently did not receive.
+// The caller must hold mu.
+func (pc *NoisePacketConn) retransmitAnswer(peer *packetPeer, index int) {
+	for _, h := range []*packetHandshake{peer.handshake, peer.finished} {
+		if h != nil && index < h.next && h.lastIndex == index+1 {
+			_ = pc.writePacket(h.lastSent, peer.addr)
+			return
+		}
+	}
+}
+
+// sweepSessions retransmits unanswered handshake messages, fails handshakes
+// older than HandshakeTimeout and removes idle sessions.
+//
+// Only the initiator retransmits. A responder resending on a timer would
+// turn one forged first message into a stream of replies to the forged
+// address; it answers the initiator's retransmissions instead.
+func (pc *NoisePacketConn) sweepSessions(now time.Time) {
+	pc.mu.Lock()
+	defer pc.mu.Unlock()
+
+	for key, peer := range pc.peers {
+		if h := peer.handshake; h != nil {
+			if now.Sub(h.started) >= pc.config.HandshakeTimeout {
+				pc.failHandshake(peer, h, oops.
+					Code("HANDSHAKE_TIMEOUT").
+					In("noise").
+					With("remote_addr", peer.addr.String()).
+					With("timeout", pc.config.HandshakeTimeout).
+					Wrapf(ErrHandshakeTimeout, "datagram handshake timed out"))
+				continue
+			}
+			if h.initiator && !h.ourTurn() && h.lastIndex == h.next-1 && now.Sub(h.sentAt) >= pc.config.HandshakeRetransmit {
+				_ = pc.writePacket(h.lastSent, peer.addr)
+				h.sentAt = now
+			}
+			continue
+		}
+
+		// Nothing answers the final message, so an initiator that sent it
+		// repeats it until the responder is heard from.
+		if f := peer.finished; f != nil && f.initiator && f.count > 1 && f.lastIndex == f.count-1 &&
+			peer.transport != nil && !peer.transport.confirmed &&
+			now.Sub(f.started) < pc.config.HandshakeTimeout && now.Sub(f.sentAt) >= pc.config.HandshakeRetransmit {
+			_ = pc.writePacket(f.lastSent, peer.addr)
+			f.sentAt = now
+		}
+
+		if pc.config.IdleTimeout > 0 && now.Sub(peer.lastActive) >= pc.config.IdleTimeout {
+			delete(pc.peers, key)
+			pc.logger.WithFields(logrus.Fields{
+				"remote_addr": key,
+				"idle":        now.Sub(peer.lastActive),
+			}).Debug("Idle datagram session expired")
+		}
+	}
+}
+
+// sealTransport encrypts p for the session t with addr under the next
+// explicit nonce.
+func (pc *NoisePacketConn) sealTransport(t *packetTransport, addr net.Addr, p []byte) ([]byte, error) {
+	pc.mu.Lock()
+	if t.receiveOnly {
+		pc.mu.Unlock()
+		return nil, oops.
+			Code("RECEIVE_ONLY_SESSION").
+			In("noise").
+			With("remote_addr", addr.String()).
+			Wrapf(ErrWriteClosed, "the responder of a one-way pattern cannot send")
+	}
+	nonce := t.sendNonce
+	if nonce >= maxTransportNonce {
+		pc.mu.Unlock()
+		return nil, nonceExhaustedError("send", nonce)
+	}
+	t.sendNonce++
+	if peer := pc.peers[addr.String()]; peer != nil && peer.transport == t {
+		peer.lastActive = time.Now()
+	}
+	pc.mu.Unlock()
+
+	packet := make([]byte, transportHeaderLen, transportHeaderLen+len(p)+cipherTagLen)
+	packet[0] = packetTypeTransport
+	binary.BigEndian.PutUint64(packet[1:], nonce)
+	return t.send.Encrypt(packet, nonce, nil, p), nil
+}
+
+// handleTransportPacket authenticates a transport datagram, drops replays
+// and queues the plaintext for ReadFrom. A datagram that authenticates under
+// pending keys makes them the session's keys.
+func (pc *NoisePacketConn) handleTransportPacket(addr net.Addr, packet []byte) {
+	nonce := binary.BigEndian.Uint64(packet[1:transportHeaderLen])
+
+	pc.mu.Lock()
+	peer := pc.peers[addr.String()]
+	if peer == nil {
+		pc.mu.Unlock()
+		return
+	}
+	var candidates []*packetTransport
+	for _, t := range []*packetTransport{peer.transport, peer.pending} {
+		if t != nil && t.replay.check(nonce) {
+			candidates = append(candidates, t)
+		}
+	}
+	pc.mu.Unlock()
+
+	var (
+		t         *packetTransport
+		plaintext []byte
+	)
+	for _, candidate := range candidates {
+		var err error
+		if plaintext, err = candidate.recv.Decrypt(nil, nonce, nil, packet[transportHeaderLen:]); err == nil {
+			t = candidate
+			break
+		}
+	}
+	if t == nil {
+		pc.logger.WithFields(logrus.Fields{
+			"remote_addr": addr.String(),
+			"nonce":       nonce,
+		}).Trace("Unauthenticated datagram dropped")
+		return
+	}
+
+	pc.mu.Lock()
+	accepted := t.replay.accept(nonce)
+	if accepted {
+		t.confirmed = true
+		if peer.pending == t {
+			peer.transport = t
+			peer.pending = nil
+			pc.logger.WithField("remote_addr", addr.String()).Debug("Datagram session switched to new keys")
+		}
+	}
+	if accepted && peer.transport == t {
+		peer.lastActive = time.Now()
+	}
+	pc.mu.Unlock()
+
+	if accepted {
+		pc.deliver(plaintext, addr)
+	}
+}
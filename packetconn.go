@@ -0,0 +1,610 @@
+package noise
+
+import (
+	"context"
+	"net"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/go-i2p/go-noise/internal"
+	"github.com/go-i2p/logger"
+	"github.com/samber/oops"
+	"github.com/sirupsen/logrus"
+)
+
+// maxUDPPayload is the largest payload of a UDP datagram over IPv4.
+const maxUDPPayload = 65507
+
+// MaxPacketSize is the largest payload WriteTo accepts: a UDP datagram less
+// the transport header and the authentication tag.
+const MaxPacketSize = maxUDPPayload - transportHeaderLen - cipherTagLen
+
+// packetQueueLen is how many decrypted datagrams wait for ReadFrom before
+// further datagrams are dropped.
+const packetQueueLen = 256
+
+// maxResponderHandshakes bounds the responder handshakes in progress. A
+// first message costs nothing to forge, so past this many further first
+// messages are dropped until some of the pending handshakes finish.
+const maxResponderHandshakes = 1024
+
+// PacketConfig contains configuration for creating a NoisePacketConn.
+// Every remote address gets its own handshake and session; the local side
+// is the initiator for sessions it starts with WriteTo or Handshake and the
+// responder for sessions a peer starts.
+type PacketConfig struct {
+	// Pattern is the Noise protocol name (e.g., "Noise_XX_25519_AESGCM_SHA256").
+	// A bare pattern such as "XX" uses the default 25519_AESGCM_SHA256 suite.
+	Pattern string
+
+	// StaticKey is the long-term static key (32 bytes for Curve25519)
+	StaticKey []byte
+
+	// RemoteKey is the static public key known in advance for patterns with a
+	// pre-message, e.g. the responder's key for "IK" (optional)
+	RemoteKey []byte
+
+	// PresharedKey is the optional symmetric key for pskN patterns (32 bytes)
+	PresharedKey []byte
+
+	// PresharedKeyPlacement is the pskN modifier position for PresharedKey
+	PresharedKeyPlacement int
+
+	// Prologue is optional data bound into every handshake hash
+	Prologue []byte
+
+	// HandshakeTimeout is the maximum time a handshake may take
+	// Default: 30 seconds
+	HandshakeTimeout time.Duration
+
+	// HandshakeRetransmit is how long the initiator waits for the peer's
+	// next handshake message before resending its last one. The responder
+	// never resends on its own; it answers the initiator's resends. An
+	// initiator that sent the final handshake message repeats it at this
+	// interval until the responder's first datagram arrives, for at most
+	// HandshakeTimeout. It is also how often sessions are checked for expiry.
+	// Default: 1 second
+	HandshakeRetransmit time.Duration
+
+	// IdleTimeout removes a session after this long without authenticated
+	// traffic in either direction. Default: 2 minutes (0 = never)
+	IdleTimeout time.Duration
+
+	// keyPairErr is set when WithKeyPair was given a nil keypair
+	keyPairErr error
+}
+
+// NewPacketConfig creates a new PacketConfig with sensible defaults.
+func NewPacketConfig(pattern string) *PacketConfig {
+	return &PacketConfig{
+		Pattern:             pattern,
+		HandshakeTimeout:    30 * time.Second,
+		HandshakeRetransmit: 1 * time.Second,
+		IdleTimeout:         2 * time.Minute,
+	}
+}
+
+// WithStaticKey sets the static key.
+// key must be 32 bytes for Curve25519.
+func (pc *PacketConfig) WithStaticKey(key []byte) *PacketConfig {
+	pc.StaticKey = make([]byte, len(key))
+	copy(pc.StaticKey, key)
+	return pc
+}
+
+// WithKeyPair sets the static key from a keypair.
+// A nil keypair makes Validate fail.
+func (pc *PacketConfig) WithKeyPair(kp *KeyPair) *PacketConfig {
+	if pc.keyPairErr = nilKeyPairError(kp); pc.keyPairErr != nil {
+		return pc
+	}
+	return pc.WithStaticKey(kp.Private)
+}
+
+// WithRemoteKey sets the static public key known in advance.
+// key must be 32 bytes for Curve25519.
+func (pc *PacketConfig) WithRemoteKey(key []byte) *PacketConfig {
+	pc.RemoteKey = make([]byte, len(key))
+	copy(pc.RemoteKey, key)
+	return pc
+}
+
+// WithPresharedKey sets the pre-shared symmetric key and its pskN placement.
+// key must be 32 bytes.
+func (pc *PacketConfig) WithPresharedKey(key []byte, placement int) *PacketConfig {
+	pc.PresharedKey = make([]byte, len(key))
+	copy(pc.PresharedKey, key)
+	pc.PresharedKeyPlacement = placement
+	return pc
+}
+
+// WithPrologue sets the prologue bound into every handshake.
+func (pc *PacketConfig) WithPrologue(prologue []byte) *PacketConfig {
+	pc.Prologue = make([]byte, len(prologue))
+	copy(pc.Prologue, prologue)
+	return pc
+}
+
+// WithHandshakeTimeout sets the handshake timeout.
+func (pc *PacketConfig) WithHandshakeTimeout(timeout time.Duration) *PacketConfig {
+	pc.HandshakeTimeout = timeout
+	return pc
+}
+
+// WithHandshakeRetransmit sets the handshake retransmission interval.
+func (pc *PacketConfig) WithHandshakeRetransmit(interval time.Duration) *PacketConfig {
+	pc.HandshakeRetransmit = interval
+	return pc
+}
+
+// WithIdleTimeout sets how long an unused session is kept.
+func (pc *PacketConfig) WithIdleTimeout(timeout time.Duration) *PacketConfig {
+	pc.IdleTimeout = timeout
+	return pc
+}
+
+// Validate checks if the configuration is valid.
+func (pc *PacketConfig) Validate() error {
+	if pc.keyPairErr != nil {
+		return pc.keyPairErr
+	}
+
+	for _, initiator := range []bool{true, false} {
+		if err := pc.connConfig(initiator).Validate(); err != nil {
+			return err
+		}
+	}
+
+	if pc.HandshakeRetransmit <= 0 {
+		return oops.
+			Code("INVALID_TIMEOUT").
+			In("noise").
+			With("retransmit", pc.HandshakeRetransmit).
+			With("pattern", pc.Pattern).
+			Wrapf(ErrInvalidConfig, "handshake retransmit interval must be positive")
+	}
+
+	if pc.IdleTimeout < 0 {
+		return oops.
+			Code("INVALID_TIMEOUT").
+			In("noise").
+			With("idle_timeout", pc.IdleTimeout).
+			With("pattern", pc.Pattern).
+			Wrapf(ErrInvalidConfig, "idle timeout must be non-negative")
+	}
+
+	return nil
+}
+
+// connConfig returns the equivalent stream configuration for one role,
+// which creates the handshake state of each session.
+func (pc *PacketConfig) connConfig(initiator bool) *ConnConfig {
+	config := NewConnConfig(pc.Pattern, initiator).
+		WithHandshakeTimeout(pc.HandshakeTimeout)
+	config.StaticKey = pc.StaticKey
+	config.RemoteKey = pc.RemoteKey
+	config.PresharedKey = pc.PresharedKey
+	config.PresharedKeyPlacement = pc.PresharedKeyPlacement
+	config.Prologue = pc.Prologue
+	return config
+}
+
+// NoisePacketConn implements net.PacketConn for Noise over datagrams.
+// It performs a separate handshake with each remote address and keeps a
+// session per peer. Transport messages carry an explicit nonce, so
+// datagrams may be lost, duplicated or reordered; duplicates and replays
+// are dropped by a sliding-window filter.
+type NoisePacketConn struct {
+	// underlying is the wrapped packet connection
+	underlying net.PacketConn
+
+	// config contains the Noise protocol configuration for all sessions
+	config *PacketConfig
+
+	// protocol is the resolved Noise protocol shared by all sessions
+	protocol *protocol
+
+	// addr is the Noise address of the local end
+	addr *NoiseAddr
+
+	// logger for connection events
+	logger *logger.Logger
+
+	// mu protects peers and the sessions they hold
+	mu sync.Mutex
+
+	// peers maps remote addresses to their sessions
+	peers map[string]*packetPeer
+
+	// responders counts the responder handshakes in progress
+	responders int
+
+	// inbound queues decrypted datagrams for ReadFrom
+	inbound chan packetDatagram
+
+	// readDeadline and writeDeadline implement the net.PacketConn deadlines
+	readDeadline  *packetDeadline
+	writeDeadline *packetDeadline
+
+	// done is closed by Close
+	done      chan struct{}
+	closeOnce sync.Once
+
+	// recvErr is the error that stopped the receive loop, set before recvDone
+	// is closed; it is the closed error if Close stopped it
+	recvErr  error
+	recvDone chan struct{}
+
+	// wg tracks the background goroutines
+	wg sync.WaitGroup
+}
+
+// packetDatagram is a decrypted datagram waiting for ReadFrom.
+type packetDatagram struct {
+	data []byte
+	addr net.Addr
+}
+
+// NewNoisePacketConn creates a NoisePacketConn that wraps the underlying
+// packet connection and starts processing incoming datagrams.
+func NewNoisePacketConn(underlying net.PacketConn, config *PacketConfig) (*NoisePacketConn, error) {
+	if underlying == nil {
+		return nil, oops.
+			Code("INVALID_CONN").
+			In("noise").
+			Wrapf(ErrInvalidConfig, "underlying packet connection cannot be nil")
+	}
+
+	if config == nil {
+		return nil, oops.
+			Code("INVALID_CONFIG").
+			In("noise").
+			Wrapf(ErrInvalidConfig, "packet config cannot be nil")
+	}
+
+	if err := config.Validate(); err != nil {
+		return nil, oops.
+			Code("INVALID_CONFIG").
+			In("noise").
+			With("local_addr", underlying.LocalAddr().String()).
+			Wrapf(internal.Mark(err, ErrInvalidConfig), "invalid packet configuration")
+	}
+
+	// Resolution cannot fail once the configuration has been validated.
+	protocol, _ := resolveProtocol(config.Pattern, config.PresharedKey, config.PresharedKeyPlacement)
+
+	pc := &NoisePacketConn{
+		underlying:    underlying,
+		config:        config,
+		protocol:      protocol,
+		addr:          NewNoiseAddr(underlying.LocalAddr(), protocol.Name, "peer"),
+		logger:        log,
+		peers:         make(map[string]*packetPeer),
+		inbound:       make(chan packetDatagram, packetQueueLen),
+		readDeadline:  newPacketDeadline(),
+		writeDeadline: newPacketDeadline(),
+		done:          make(chan struct{}),
+		recvDone:      make(chan struct{}),
+	}
+
+	pc.wg.Add(2)
+	go pc.receiveLoop()
+	go pc.maintainSessions()
+
+	pc.logger.WithFields(logrus.Fields{
+		"protocol":   protocol.Name,
+		"local_addr": underlying.LocalAddr().String(),
+	}).Debug("NoisePacketConn created")
+
+	return pc, nil
+}
+
+// ReadFrom reads the next decrypted datagram from any peer. The returned
+// address is the peer's underlying address and can be passed to WriteTo.
+// If p is too small the rest of the datagram is discarded.
+func (pc *NoisePacketConn) ReadFrom(p []byte) (int, net.Addr, error) {
+	n, addr, err := pc.readFrom(p)
+	return n, addr, internal.NetError(err)
+}
+
+// readFrom implements ReadFrom.
+func (pc *NoisePacketConn) readFrom(p []byte) (int, net.Addr, error) {
+	if isClosedChan(pc.done) {
+		return 0, nil, pc.closedError()
+	}
+
+	select {
+	case d := <-pc.inbound:
+		return copy(p, d.data), d.addr, nil
+	default:
+	}
+
+	select {
+	case d := <-pc.inbound:
+		return copy(p, d.data), d.addr, nil
+	case <-pc.done:
+		return 0, nil, pc.closedError()
+	case <-pc.recvDone:
+		return 0, nil, pc.recvErr
+	case <-pc.readDeadline.wait():
+		return 0, nil, deadlineError("read")
+	}
+}
+
+// WriteTo encrypts p and sends it to addr as one datagram. If there is no
+// session with addr yet, WriteTo first performs a handshake as initiator,
+// bounded by HandshakeTimeout and the write deadline.
+func (pc *NoisePacketConn) WriteTo(p []byte, addr net.Addr) (int, error) {
+	n, err := pc.writeTo(p, addr)
+	return n, internal.NetError(err)
+}
+
+// writeTo implements WriteTo.
+func (pc *NoisePacketConn) writeTo(p []byte, addr net.Addr) (int, error) {
+	if len(p) > MaxPacketSize {
+		return 0, oops.
+			Code("PACKET_TOO_LARGE").
+			In("noise").
+			With("packet_len", len(p)).
+			With("max_packet_len", MaxPacketSize).
+			Wrapf(ErrMessageTooLarge, "datagram payload exceeds %d bytes", MaxPacketSize)
+	}
+
+	addr = underlyingAddr(addr)
+	t, err := pc.establish(context.Background(), addr, pc.writeDeadline.wait())
+	if err != nil {
+		return 0, err
+	}
+
+	packet, err := pc.sealTransport(t, addr, p)
+	if err != nil {
+		return 0, err
+	}
+
+	if err := pc.writePacket(packet, addr); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// Handshake establishes a session with addr as initiator unless one exists.
+// WriteTo does this implicitly; calling Handshake first separates handshake
+// failures from write failures and allows a context to bound the wait.
+func (pc *NoisePacketConn) Handshake(ctx context.Context, addr net.Addr) error {
+	_, err := pc.establish(ctx, underlyingAddr(addr), nil)
+	return err
+}
+
+// PeerStatic returns the static public key authenticated by the session
+// with addr, or nil if there is no session or the pattern conveys none.
+func (pc *NoisePacketConn) PeerStatic(addr net.Addr) []byte {
+	pc.mu.Lock()
+	defer pc.mu.Unlock()
+
+	peer := pc.peers[underlyingAddr(addr).String()]
+	if peer == nil || peer.transport == nil {
+		return nil
+	}
+	return cloneBytes(peer.transport.peerStatic)
+}
+
+// Close closes the connection and discards all sessions.
+// Pending handshakes fail with CONN_CLOSED.
+func (pc *NoisePacketConn) Close() error {
+	var err error
+	pc.closeOnce.Do(func() {
+		close(pc.done)
+		pc.logger.Debug("Closing NoisePacketConn")
+
+		if closeErr := pc.underlying.Close(); closeErr != nil {
+			err = oops.
+				Code("UNDERLYING_CLOSE_FAILED").
+				In("noise").
+				With("local_addr", pc.addr.String()).
+				Wrapf(closeErr, "failed to close underlying packet connection")
+		}
+		pc.wg.Wait()
+
+		pc.mu.Lock()
+		defer pc.mu.Unlock()
+		for _, peer := range pc.peers {
+			if peer.handshake != nil {
+				pc.failHandshake(peer, peer.handshake, pc.closedError())
+			}
+		}
+		pc.peers = make(map[string]*packetPeer)
+	})
+	return err
+}
+
+// LocalAddr returns the local network address.
+func (pc *NoisePacketConn) LocalAddr() net.Addr {
+	return pc.addr
+}
+
+// SetDeadline sets the read and write deadlines.
+func (pc *NoisePacketConn) SetDeadline(t time.Time) error {
+	if err := pc.SetReadDeadline(t); err != nil {
+		return err
+	}
+	return pc.SetWriteDeadline(t)
+}
+
+// SetReadDeadline sets the deadline for ReadFrom.
+func (pc *NoisePacketConn) SetReadDeadline(t time.Time) error {
+	pc.readDeadline.set(t)
+	return nil
+}
+
+// SetWriteDeadline sets the deadline for WriteTo, including any handshake it waits for.
+func (pc *NoisePacketConn) SetWriteDeadline(t time.Time) error {
+	pc.writeDeadline.set(t)
+	if err := pc.underlying.SetWriteDeadline(t); err != nil {
+		return oops.
+			Code("SET_WRITE_DEADLINE_FAILED").
+			In("noise").
+			With("deadline", t).
+			Wrapf(err, "failed to set write deadline on underlying connection")
+	}
+	return nil
+}
+
+// receiveLoop reads datagrams from the underlying connection until it fails
+// or is closed.
+func (pc *NoisePacketConn) receiveLoop() {
+	defer pc.wg.Done()
+
+	buf := make([]byte, maxFrameLen)
+	for {
+		n, addr, err := pc.underlying.ReadFrom(buf)
+		if err != nil {
+			select {
+			case <-pc.done:
+				pc.recvErr = pc.closedError()
+			default:
+				pc.recvErr = oops.
+					Code("UNDERLYING_READ_FAILED").
+					In("noise").
+					With("local_addr", pc.addr.String()).
+					Wrapf(err, "underlying packet connection read failed")
+			}
+			close(pc.recvDone)
+			return
+		}
+		pc.handlePacket(buf[:n], addr)
+	}
+}
+
+// maintainSessions retransmits unanswered handshake messages and expires
+// stale handshakes and idle sessions until the connection is closed.
+func (pc *NoisePacketConn) maintainSessions() {
+	defer pc.wg.Done()
+
+	ticker := time.NewTicker(pc.config.HandshakeRetransmit)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-pc.done:
+			return
+		case now := <-ticker.C:
+			pc.sweepSessions(now)
+		}
+	}
+}
+
+// deliver queues a decrypted datagram for ReadFrom, dropping it if the
+// queue is full as a congested socket would.
+func (pc *NoisePacketConn) deliver(data []byte, addr net.Addr) {
+	select {
+	case pc.inbound <- packetDatagram{data: data, addr: addr}:
+	default:
+		pc.logger.WithFields(logrus.Fields{
+			"remote_addr": addr.String(),
+		}).Debug("Datagram dropped, receive queue full")
+	}
+}
+
+// writePacket sends one datagram to addr.
+func (pc *NoisePacketConn) writePacket(packet []byte, addr net.Addr) error {
+	if _, err := pc.underlying.WriteTo(packet, addr); err != nil {
+		return oops.
+			Code("UNDERLYING_WRITE_FAILED").
+			In("noise").
+			With("remote_addr", addr.String()).
+			With("packet_len", len(packet)).
+			Wrapf(err, "underlying packet connection write failed")
+	}
+	return nil
+}
+
+// closedError reports use of a closed NoisePacketConn.
+func (pc *NoisePacketConn) closedError() error {
+	return oops.
+		Code("CONN_CLOSED").
+		In("noise").
+		With("local_addr", pc.addr.String()).
+		Wrapf(ErrConnClosed, "packet connection is closed")
+}
+
+// deadlineError reports an expired read or write deadline. It wraps
+// os.ErrDeadlineExceeded so callers can detect it with errors.Is.
+func deadlineError(op string) error {
+	return oops.
+		Code("DEADLINE_EXCEEDED").
+		In("noise").
+		With("operation", op).
+		Wrapf(os.ErrDeadlineExceeded, "%s deadline exceeded", op)
+}
+
+// underlyingAddr unwraps a NoiseAddr so sessions are keyed by the address
+// the underlying connection reports.
+func underlyingAddr(addr net.Addr) net.Addr {
+	if na, ok := addr.(*NoiseAddr); ok && na.Underlying() != nil {
+		return na.Underlying()
+	}
+	return addr
+}
+
+// packetDeadline is a deadline that can be waited on and moved while a
+// caller is blocked, in the manner of net.Pipe.
+type packetDeadline struct {
+	mu     sync.Mutex
+	timer  *time.Timer
+	cancel chan struct{}
+}
+
+// newPacketDeadline returns a deadline that is not set.
+func newPacketDeadline() *packetDeadline {
+	return &packetDeadline{cancel: make(chan struct{})}
+}
+
+// set moves the deadline to t. The zero time clears it.
+func (d *packetDeadline) set(t time.Time) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.timer != nil && !d.timer.Stop() {
+		<-d.cancel // Wait for the timer callback to finish
+	}
+	d.timer = nil
+
+	closed := isClosedChan(d.cancel)
+	if t.IsZero() {
+		if closed {
+			d.cancel = make(chan struct{})
+		}
+		return
+	}
+
+	if dur := time.Until(t); dur > 0 {
+		if closed {
+			d.cancel = make(chan struct{})
+		}
+		cancel := d.cancel
+		d.timer = time.AfterFunc(dur, func() { close(cancel) })
+		return
+	}
+
+	if !closed {
+		close(d.cancel)
+	}
+}
+
+// wait returns a channel that is closed when the deadline passes.
+func (d *packetDeadline) wait() chan struct{} {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.cancel
+}
+
+// isClosedChan reports whether c has been closed.
+func isClosedChan(c <-chan struct{}) bool {
+	select {
+	case <-c:
+		return true
+	default:
+		return false
+	}
+}
@@ -0,0 +1,570 @@
+package noise
+
+import (
+	"context"
+	"errors"
+	"net"
+	"os"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newUDPPacketConn wraps a loopback UDP socket in a NoisePacketConn.
+func newUDPPacketConn(t *testing.T, config *PacketConfig) *NoisePacketConn {
+	t.Helper()
+	udp, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+	return wrapPacketConn(t, udp, config)
+}
+
+// wrapPacketConn wraps underlying in a NoisePacketConn closed at cleanup.
+func wrapPacketConn(t *testing.T, underlying net.PacketConn, config *PacketConfig) *NoisePacketConn {
+	t.Helper()
+	pc, err := NewNoisePacketConn(underlying, config)
+	require.NoError(t, err)
+	t.Cleanup(func() { pc.Close() })
+	return pc
+}
+
+// xxPacketConfig returns a fast-retransmitting XX configuration with a new static key.
+func xxPacketConfig(t *testing.T) (*PacketConfig, []byte) {
+	private, public := newTestKeyPair(t)
+	return NewPacketConfig("XX").
+		WithStaticKey(private).
+		WithHandshakeTimeout(5 * time.Second).
+		WithHandshakeRetransmit(20 * time.Millisecond), public
+}
+
+// readPacket reads one datagram with a timeout.
+func readPacket(t *testing.T, pc *NoisePacketConn) (string, net.Addr) {
+	t.Helper()
+	require.NoError(t, pc.SetReadDeadline(time.Now().Add(5*time.Second)))
+	buf := make([]byte, 2048)
+	n, addr, err := pc.ReadFrom(buf)
+	require.NoError(t, err)
+	return string(buf[:n]), addr
+}
+
+// peerCount returns the number of sessions, including pending handshakes.
+func peerCount(pc *NoisePacketConn) int {
+	pc.mu.Lock()
+	defer pc.mu.Unlock()
+	return len(pc.peers)
+}
+
+func TestPacketConnRoundTrip(t *testing.T) {
+	serverConfig, serverPublic := xxPacketConfig(t)
+	clientConfig, clientPublic := xxPacketConfig(t)
+	server := newUDPPacketConn(t, serverConfig)
+	client := newUDPPacketConn(t, clientConfig)
+
+	_, err := client.WriteTo([]byte("ping"), server.LocalAddr())
+	require.NoError(t, err)
+
+	msg, from := readPacket(t, server)
+	assert.Equal(t, "ping", msg)
+	assert.Equal(t, client.underlying.LocalAddr().String(), from.String())
+	assert.Equal(t, clientPublic, server.PeerStatic(from))
+
+	_, err = server.WriteTo([]byte("pong"), from)
+	require.NoError(t, err)
+
+	msg, from = readPacket(t, client)
+	assert.Equal(t, "pong", msg)
+	assert.Equal(t, server.underlying.LocalAddr().String(), from.String())
+	assert.Equal(t, serverPublic, client.PeerStatic(server.LocalAddr()))
+
+	assert.Equal(t, "noise+udp", server.LocalAddr().Network())
+}
+
+func TestPacketConnSessionPerPeer(t *testing.T) {
+	serverConfig, _ := xxPacketConfig(t)
+	server := newUDPPacketConn(t, serverConfig)
+
+	clients := make([]*NoisePacketConn, 3)
+	publics := make(map[string][]byte)
+	for i := range clients {
+		config, public := xxPacketConfig(t)
+		clients[i] = newUDPPacketConn(t, config)
+		publics[clients[i].underlying.LocalAddr().String()] = public
+	}
+
+	var wg sync.WaitGroup
+	for _, client := range clients {
+		wg.Add(1)
+		go func(client *NoisePacketConn) {
+			defer wg.Done()
+			_, err := client.WriteTo([]byte("hello"), server.LocalAddr())
+			assert.NoError(t, err)
+		}(client)
+	}
+	wg.Wait()
+
+	for range clients {
+		msg, from := readPacket(t, server)
+		assert.Equal(t, "hello", msg)
+		assert.Equal(t, publics[from.String()], server.PeerStatic(from))
+		_, err := server.WriteTo([]byte("reply to "+from.String()), from)
+		require.NoError(t, err)
+	}
+	assert.Equal(t, len(clients), peerCount(server))
+
+	for _, client := range clients {
+		msg, _ := readPacket(t, client)
+		assert.Equal(t, "reply to "+client.underlying.LocalAddr().String(), msg)
+	}
+}
+
+func TestPacketConnReorderingAndReplay(t *testing.T) {
+	serverConfig, _ := xxPacketConfig(t)
+	clientConfig, _ := xxPacketConfig(t)
+	server := newUDPPacketConn(t, serverConfig)
+	client := newUDPPacketConn(t, clientConfig)
+
+	serverAddr := server.underlying.LocalAddr()
+	require.NoError(t, client.Handshake(t.Context(), serverAddr))
+
+	client.mu.Lock()
+	transport := client.peers[serverAddr.String()].transport
+	client.mu.Unlock()
+
+	packets := make([][]byte, 5)
+	for i := range packets {
+		packet, err := client.sealTransport(transport, serverAddr, []byte{byte('a' + i)})
+		require.NoError(t, err)
+		packets[i] = packet
+	}
+
+	// Deliver out of order with duplicates, as the network might.
+	for _, i := range []int{3, 1, 0, 1, 4, 3, 2, 0} {
+		_, err := client.underlying.WriteTo(packets[i], serverAddr)
+		require.NoError(t, err)
+	}
+
+	var got string
+	for range packets {
+		msg, _ := readPacket(t, server)
+		got += msg
+	}
+	assert.Equal(t, "dbaec", got)
+
+	require.NoError(t, server.SetReadDeadline(time.Now().Add(100*time.Millisecond)))
+	_, _, err := server.ReadFrom(make([]byte, 16))
+	assert.True(t, errors.Is(err, os.ErrDeadlineExceeded), "replayed datagrams must be dropped: %v", err)
+}
+
+// lossyPacketConn drops the first drop outgoing handshake datagrams.
+type lossyPacketConn struct {
+	net.PacketConn
+	drop    int32
+	dropped atomic.Int32
+}
+
+func (l *lossyPacketConn) WriteTo(p []byte, addr net.Addr) (int, error) {
+	if len(p) > 0 && p[0] == packetTypeHandshake && l.dropped.Load() < l.drop {
+		l.dropped.Add(1)
+		return len(p), nil
+	}
+	return l.PacketConn.WriteTo(p, addr)
+}
+
+func TestPacketConnHandshakeSurvivesLoss(t *testing.T) {
+	for _, lossy := range []string{"initiator", "responder"} {
+		t.Run(lossy, func(t *testing.T) {
+			serverConfig, _ := xxPacketConfig(t)
+			clientConfig, _ := xxPacketConfig(t)
+
+			serverUDP, err := net.ListenPacket("udp", "127.0.0.1:0")
+			require.NoError(t, err)
+			clientUDP, err := net.ListenPacket("udp", "127.0.0.1:0")
+			require.NoError(t, err)
+
+			var serverUnderlying, clientUnderlying net.PacketConn = serverUDP, clientUDP
+			lossyConn := &lossyPacketConn{drop: 2}
+			if lossy == "initiator" {
+				lossyConn.PacketConn = clientUDP
+				clientUnderlying = lossyConn
+			} else {
+				lossyConn.PacketConn = serverUDP
+				serverUnderlying = lossyConn
+			}
+
+			server := wrapPacketConn(t, serverUnderlying, serverConfig)
+			client := wrapPacketConn(t, clientUnderlying, clientConfig)
+
+			_, err = client.WriteTo([]byte("through the loss"), server.LocalAddr())
+			require.NoError(t, err)
+
+			msg, _ := readPacket(t, server)
+			assert.Equal(t, "through the loss", msg)
+			assert.Equal(t, int32(2), lossyConn.dropped.Load())
+		})
+	}
+}
+
+// dropIndexPacketConn drops the first outgoing handshake datagram with the
+// given message index.
+type dropIndexPacketConn struct {
+	net.PacketConn
+	index   byte
+	dropped atomic.Bool
+}
+
+func (d *dropIndexPacketConn) WriteTo(p []byte, addr net.Addr) (int, error) {
+	if len(p) >= handshakeHeaderLen && p[0] == packetTypeHandshake && p[1] == d.index && d.dropped.CompareAndSwap(false, true) {
+		return len(p), nil
+	}
+	return d.PacketConn.WriteTo(p, addr)
+}
+
+func TestPacketConnHandshakeSurvivesLostFinalMessage(t *testing.T) {
+	serverConfig, _ := xxPacketConfig(t)
+	clientConfig, _ := xxPacketConfig(t)
+	server := newUDPPacketConn(t, serverConfig)
+
+	clientUDP, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+	dropper := &dropIndexPacketConn{PacketConn: clientUDP, index: 2}
+	client := wrapPacketConn(t, dropper, clientConfig)
+
+	// The client is done once it sends message 2, so only its repeat of
+	// that message lets the server finish and reply.
+	require.NoError(t, client.Handshake(context.Background(), server.LocalAddr()))
+	_, err = server.WriteTo([]byte("after the lost message"), client.LocalAddr())
+	require.NoError(t, err)
+
+	msg, _ := readPacket(t, client)
+	assert.Equal(t, "after the lost message", msg)
+	assert.True(t, dropper.dropped.Load())
+}
+
+// countingPacketConn counts and discards outgoing datagrams.
+type countingPacketConn struct {
+	net.PacketConn
+	mu     sync.Mutex
+	writes map[string]int
+}
+
+func (c *countingPacketConn) WriteTo(p []byte, addr net.Addr) (int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.writes[addr.String()]++
+	return len(p), nil
+}
+
+func (c *countingPacketConn) total() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	total := 0
+	for _, n := range c.writes {
+		total += n
+	}
+	return total
+}
+
+func TestPacketConnResponderDoesNotAmplifyForgedFirstMessages(t *testing.T) {
+	udp, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+	counter := &countingPacketConn{PacketConn: udp, writes: make(map[string]int)}
+	config, _ := xxPacketConfig(t)
+	server := wrapPacketConn(t, counter, config.WithHandshakeTimeout(time.Minute))
+
+	forged := func(port int) net.Addr {
+		return &net.UDPAddr{IP: net.IPv4(192, 0, 2, 1), Port: port}
+	}
+	_, ephemeral := newTestKeyPair(t)
+	first := append([]byte{packetTypeHandshake, 0}, ephemeral...)
+
+	server.handlePacket(first, forged(1))
+	now := time.Now()
+	for i := 1; i <= 10; i++ {
+		server.sweepSessions(now.Add(time.Duration(i) * config.HandshakeRetransmit))
+	}
+	assert.Equal(t, 1, counter.writes[forged(1).String()], "the responder answers once and never resends")
+
+	for port := 2; port <= maxResponderHandshakes+10; port++ {
+		server.handlePacket(first, forged(port))
+	}
+	assert.Equal(t, maxResponderHandshakes, peerCount(server))
+	assert.Equal(t, maxResponderHandshakes, counter.total())
+}
+
+func TestPacketConnForgedFirstMessageKeepsSession(t *testing.T) {
+	config := func() *PacketConfig {
+		return NewPacketConfig("NN").
+			WithHandshakeTimeout(5 * time.Second).
+			WithHandshakeRetransmit(20 * time.Millisecond)
+	}
+	server := newUDPPacketConn(t, config())
+	client := newUDPPacketConn(t, config())
+
+	serverAddr := server.underlying.LocalAddr()
+	clientAddr := client.underlying.LocalAddr()
+	_, err := client.WriteTo([]byte("before"), serverAddr)
+	require.NoError(t, err)
+	msg, _ := readPacket(t, server)
+	assert.Equal(t, "before", msg)
+
+	// A first message forged from the client's address completes a
+	// responder handshake on its own in a two-message pattern.
+	_, ephemeral := newTestKeyPair(t)
+	server.handlePacket(append([]byte{packetTypeHandshake, 0}, ephemeral...), clientAddr)
+
+	_, err = client.WriteTo([]byte("after"), serverAddr)
+	require.NoError(t, err)
+	msg, _ = readPacket(t, server)
+	assert.Equal(t, "after", msg, "the established session must survive the forgery")
+
+	_, err = server.WriteTo([]byte("reply"), clientAddr)
+	require.NoError(t, err)
+	msg, _ = readPacket(t, client)
+	assert.Equal(t, "reply", msg)
+}
+
+func TestPacketConnRestartedPeerSwitchesKeys(t *testing.T) {
+	serverConfig, _ := xxPacketConfig(t)
+	clientConfig, _ := xxPacketConfig(t)
+	server := newUDPPacketConn(t, serverConfig)
+	client := newUDPPacketConn(t, clientConfig)
+
+	serverAddr := server.underlying.LocalAddr()
+	clientAddr := client.underlying.LocalAddr()
+	_, err := client.WriteTo([]byte("first run"), serverAddr)
+	require.NoError(t, err)
+	msg, _ := readPacket(t, server)
+	assert.Equal(t, "first run", msg)
+
+	// The client restarts on the same address without its session keys.
+	require.NoError(t, client.Close())
+	udp, err := net.ListenPacket("udp", clientAddr.String())
+	require.NoError(t, err)
+	restarted := wrapPacketConn(t, udp, clientConfig)
+
+	_, err = restarted.WriteTo([]byte("second run"), serverAddr)
+	require.NoError(t, err)
+	msg, _ = readPacket(t, server)
+	assert.Equal(t, "second run", msg)
+
+	// The server now sends under the new keys.
+	_, err = server.WriteTo([]byte("reply"), clientAddr)
+	require.NoError(t, err)
+	msg, _ = readPacket(t, restarted)
+	assert.Equal(t, "reply", msg)
+}
+
+func TestPacketConnHandshakeTimeout(t *testing.T) {
+	silent, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer silent.Close()
+
+	config, _ := xxPacketConfig(t)
+	client := newUDPPacketConn(t, config.WithHandshakeTimeout(150*time.Millisecond))
+
+	_, err = client.WriteTo([]byte("anyone?"), silent.LocalAddr())
+	requireErrorCode(t, err, "HANDSHAKE_TIMEOUT")
+	assert.Zero(t, peerCount(client), "failed handshakes are forgotten")
+
+	// The first message was retransmitted while waiting.
+	require.NoError(t, silent.SetReadDeadline(time.Now().Add(time.Second)))
+	buf := make([]byte, 2048)
+	received := 0
+	for {
+		if _, _, err := silent.ReadFrom(buf); err != nil {
+			break
+		}
+		received++
+	}
+	assert.Greater(t, received, 1)
+}
+
+func TestPacketConnSimultaneousOpen(t *testing.T) {
+	aConfig, _ := xxPacketConfig(t)
+	bConfig, _ := xxPacketConfig(t)
+	a := newUDPPacketConn(t, aConfig)
+	b := newUDPPacketConn(t, bConfig)
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		_, err := a.WriteTo([]byte("from a"), b.LocalAddr())
+		assert.NoError(t, err)
+	}()
+	go func() {
+		defer wg.Done()
+		_, err := b.WriteTo([]byte("from b"), a.LocalAddr())
+		assert.NoError(t, err)
+	}()
+	wg.Wait()
+
+	msg, _ := readPacket(t, b)
+	assert.Equal(t, "from a", msg)
+	msg, _ = readPacket(t, a)
+	assert.Equal(t, "from b", msg)
+}
+
+// gatedPacketConn holds its first write until every conn sharing gate has
+// made one, so simultaneous first messages are guaranteed to cross.
+type gatedPacketConn struct {
+	net.PacketConn
+	gate *sync.WaitGroup
+	once sync.Once
+}
+
+func (g *gatedPacketConn) WriteTo(p []byte, addr net.Addr) (int, error) {
+	g.once.Do(func() {
+		g.gate.Done()
+		g.gate.Wait()
+	})
+	return g.PacketConn.WriteTo(p, addr)
+}
+
+func TestPacketConnSimultaneousOpenOnWildcardBind(t *testing.T) {
+	var gate sync.WaitGroup
+	gate.Add(2)
+
+	conns := make([]*NoisePacketConn, 2)
+	addrs := make([]net.Addr, 2)
+	for i := range conns {
+		// The local address is a wildcard while the peer sees a loopback
+		// address, so the two sides cannot agree on an address ordering.
+		udp, err := net.ListenPacket("udp", ":0")
+		require.NoError(t, err)
+		config, _ := xxPacketConfig(t)
+		conns[i] = wrapPacketConn(t, &gatedPacketConn{PacketConn: udp, gate: &gate}, config)
+		addrs[i] = &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: udp.LocalAddr().(*net.UDPAddr).Port}
+	}
+
+	var wg sync.WaitGroup
+	for i := range conns {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			_, err := conns[i].WriteTo([]byte{byte('a' + i)}, addrs[1-i])
+			assert.NoError(t, err)
+		}(i)
+	}
+	wg.Wait()
+
+	msg, _ := readPacket(t, conns[1])
+	assert.Equal(t, "a", msg)
+	msg, _ = readPacket(t, conns[0])
+	assert.Equal(t, "b", msg)
+}
+
+func TestPacketConnIdleExpiry(t *testing.T) {
+	serverConfig, _ := xxPacketConfig(t)
+	clientConfig, _ := xxPacketConfig(t)
+	server := newUDPPacketConn(t, serverConfig.WithIdleTimeout(100*time.Millisecond))
+	client := newUDPPacketConn(t, clientConfig.WithIdleTimeout(100*time.Millisecond))
+
+	_, err := client.WriteTo([]byte("first"), server.LocalAddr())
+	require.NoError(t, err)
+	msg, _ := readPacket(t, server)
+	assert.Equal(t, "first", msg)
+
+	require.Eventually(t, func() bool {
+		return peerCount(server) == 0 && peerCount(client) == 0
+	}, 2*time.Second, 10*time.Millisecond, "idle sessions should expire")
+
+	// A new handshake replaces the expired session.
+	_, err = client.WriteTo([]byte("second"), server.LocalAddr())
+	require.NoError(t, err)
+	msg, _ = readPacket(t, server)
+	assert.Equal(t, "second", msg)
+}
+
+func TestPacketConnDropsForgedDatagrams(t *testing.T) {
+	serverConfig, _ := xxPacketConfig(t)
+	clientConfig, _ := xxPacketConfig(t)
+	server := newUDPPacketConn(t, serverConfig)
+	client := newUDPPacketConn(t, clientConfig)
+
+	serverAddr := server.underlying.LocalAddr()
+	require.NoError(t, client.Handshake(t.Context(), serverAddr))
+
+	forged := make([]byte, transportHeaderLen+cipherTagLen+4)
+	forged[0] = packetTypeTransport
+	for _, packet := range [][]byte{forged, {0x7f, 1, 2}, {packetTypeTransport, 1}} {
+		_, err := client.underlying.WriteTo(packet, serverAddr)
+		require.NoError(t, err)
+	}
+
+	_, err := client.WriteTo([]byte("genuine"), serverAddr)
+	require.NoError(t, err)
+	msg, _ := readPacket(t, server)
+	assert.Equal(t, "genuine", msg)
+}
+
+func TestPacketConnErrors(t *testing.T) {
+	config, _ := xxPacketConfig(t)
+	pc := newUDPPacketConn(t, config)
+
+	_, err := pc.WriteTo(make([]byte, MaxPacketSize+1), pc.LocalAddr())
+	requireErrorCode(t, err, "PACKET_TOO_LARGE")
+
+	require.NoError(t, pc.SetReadDeadline(time.Now().Add(20*time.Millisecond)))
+	_, _, err = pc.ReadFrom(make([]byte, 16))
+	requireErrorCode(t, err, "DEADLINE_EXCEEDED")
+	assert.True(t, errors.Is(err, os.ErrDeadlineExceeded))
+
+	require.NoError(t, pc.SetReadDeadline(time.Time{}))
+	readErr := make(chan error, 1)
+	go func() {
+		_, _, err := pc.ReadFrom(make([]byte, 16))
+		readErr <- err
+	}()
+	time.Sleep(20 * time.Millisecond)
+	require.NoError(t, pc.Close())
+	requireErrorCode(t, <-readErr, "CONN_CLOSED")
+
+	_, err = pc.WriteTo([]byte("closed"), pc.LocalAddr())
+	requireErrorCode(t, err, "CONN_CLOSED")
+}
+
+func TestPacketConfigValidation(t *testing.T) {
+	private, _ := newTestKeyPair(t)
+
+	assert.NoError(t, NewPacketConfig("XX").WithStaticKey(private).Validate())
+	assert.Error(t, NewPacketConfig("").Validate())
+	assert.Error(t, NewPacketConfig("XX").WithStaticKey(private[:16]).Validate())
+	requireErrorCode(t, NewPacketConfig("NN").WithHandshakeRetransmit(0).Validate(), "INVALID_TIMEOUT")
+	requireErrorCode(t, NewPacketConfig("NN").WithIdleTimeout(-time.Second).Validate(), "INVALID_TIMEOUT")
+
+	_, err := NewNoisePacketConn(nil, NewPacketConfig("NN"))
+	requireErrorCode(t, err, "INVALID_CONN")
+}
+
+func TestPacketConnReadAfterCloseReportsClosed(t *testing.T) {
+	config, _ := xxPacketConfig(t)
+	for i := 0; i < 20; i++ {
+		pc := newUDPPacketConn(t, config)
+		readErr := make(chan error, 1)
+		go func() {
+			_, _, err := pc.ReadFrom(make([]byte, 16))
+			readErr <- err
+		}()
+		require.NoError(t, pc.Close())
+		requireErrorCode(t, <-readErr, "CONN_CLOSED")
+	}
+}
+
+func TestPacketConnOneWayResponderCannotSend(t *testing.T) {
+	serverPrivate, serverPublic := newTestKeyPair(t)
+	server := newUDPPacketConn(t, NewPacketConfig("N").WithStaticKey(serverPrivate))
+	client := newUDPPacketConn(t, NewPacketConfig("N").WithRemoteKey(serverPublic))
+
+	_, err := client.WriteTo([]byte("one way"), server.LocalAddr())
+	require.NoError(t, err)
+	msg, addr := readPacket(t, server)
+	assert.Equal(t, "one way", msg)
+
+	_, err = server.WriteTo([]byte("reply"), addr)
+	requireErrorCode(t, err, "RECEIVE_ONLY_SESSION")
+	assert.ErrorIs(t, err, ErrWriteClosed)
+}
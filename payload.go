@@ -0,0 +1,65 @@
+package noise
+
+import "github.com/go-i2p/noise"
+
+// PayloadSecurity describes the protection a handshake payload receives on the wire.
+type PayloadSecurity int
+
+const (
+	// PayloadCleartext payloads are sent before any key is established and are readable by observers
+	PayloadCleartext PayloadSecurity = iota
+	// PayloadEncrypted payloads are encrypted, but a later compromise of static keys may expose them
+	PayloadEncrypted
+	// PayloadForwardSecret payloads are encrypted under a key mixed with an ephemeral-ephemeral DH
+	PayloadForwardSecret
+)
+
+// String returns a string representation of the payload security level.
+func (ps PayloadSecurity) String() string {
+	switch ps {
+	case PayloadCleartext:
+		return "cleartext"
+	case PayloadEncrypted:
+		return "encrypted"
+	case PayloadForwardSecret:
+		return "forward-secret"
+	default:
+		return "unknown"
+	}
+}
+
+// HandshakePayload is application data carried inside a received handshake message.
+type HandshakePayload struct {
+	// MessageIndex is the position of the carrying message in the handshake.
+	// After a Noise Pipes fallback the XXfallback messages are 1 and 2.
+	MessageIndex int
+	// Data is the decrypted payload
+	Data []byte
+	// Security is the protection the payload had on the wire
+	Security PayloadSecurity
+}
+
+// handshakePayloadSecurity returns the protection level of the payload of
+// each message in the protocol's handshake pattern. A payload is encrypted
+// once a DH involving a static key or a PSK has been mixed into the key, and
+// forward secret once the ephemeral-ephemeral DH has been performed. Keys
+// derived only from public ephemerals (PSK-mode "e") do not count.
+func handshakePayloadSecurity(p *protocol) []PayloadSecurity {
+	levels := make([]PayloadSecurity, len(p.Pattern.Messages))
+	security := PayloadCleartext
+	for i, tokens := range p.Pattern.Messages {
+		if p.PSKPlacement == 0 && i == 0 || p.PSKPlacement > 0 && p.PSKPlacement-1 == i {
+			security = max(security, PayloadEncrypted)
+		}
+		for _, token := range tokens {
+			switch token {
+			case noise.MessagePatternDHEE:
+				security = PayloadForwardSecret
+			case noise.MessagePatternDHES, noise.MessagePatternDHSE, noise.MessagePatternDHSS:
+				security = max(security, PayloadEncrypted)
+			}
+		}
+		levels[i] = security
+	}
+	return levels
+}
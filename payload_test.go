@@ -0,0 +1,108 @@
+package noise
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/samber/oops"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHandshakePayloadSecurityLevels(t *testing.T) {
+	tests := []struct {
+		pattern  string
+		expected []PayloadSecurity
+	}{
+		{"NN", []PayloadSecurity{PayloadCleartext, PayloadForwardSecret}},
+		{"XX", []PayloadSecurity{PayloadCleartext, PayloadForwardSecret, PayloadForwardSecret}},
+		{"NK", []PayloadSecurity{PayloadEncrypted, PayloadForwardSecret}},
+		{"IK", []PayloadSecurity{PayloadEncrypted, PayloadForwardSecret}},
+		{"N", []PayloadSecurity{PayloadEncrypted}},
+		{"NNpsk0", []PayloadSecurity{PayloadEncrypted, PayloadForwardSecret}},
+		{"XXpsk3", []PayloadSecurity{PayloadCleartext, PayloadForwardSecret, PayloadForwardSecret}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.pattern, func(t *testing.T) {
+			p, err := parseProtocolName(tt.pattern)
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, handshakePayloadSecurity(p))
+		})
+	}
+}
+
+func TestPayloadSecurityString(t *testing.T) {
+	assert.Equal(t, "cleartext", PayloadCleartext.String())
+	assert.Equal(t, "encrypted", PayloadEncrypted.String())
+	assert.Equal(t, "forward-secret", PayloadForwardSecret.String())
+	assert.Equal(t, "unknown", PayloadSecurity(99).String())
+}
+
+func TestHandshakePayloadsAreExchanged(t *testing.T) {
+	provider := func(side string) func(int) []byte {
+		return func(msgIndex int) []byte {
+			return []byte(fmt.Sprintf("%s-%d", side, msgIndex))
+		}
+	}
+
+	var mu sync.Mutex
+	var handled []HandshakePayload
+	initiatorConfig := NewConnConfig("XX", true).
+		WithStaticKey(newTestStaticKey(t)).
+		WithHandshakePayloadProvider(provider("initiator")).
+		WithHandshakeTimeout(5 * time.Second)
+	responderConfig := NewConnConfig("XX", false).
+		WithStaticKey(newTestStaticKey(t)).
+		WithHandshakePayloadProvider(provider("responder")).
+		WithHandshakePayloadHandler(func(p HandshakePayload) error {
+			mu.Lock()
+			defer mu.Unlock()
+			handled = append(handled, p)
+			return nil
+		}).
+		WithHandshakeTimeout(5 * time.Second)
+
+	initiator, responder := establishPair(t, initiatorConfig, responderConfig)
+
+	assert.Equal(t, []HandshakePayload{
+		{MessageIndex: 1, Data: []byte("responder-1"), Security: PayloadForwardSecret},
+	}, initiator.HandshakePayloads())
+
+	expected := []HandshakePayload{
+		{MessageIndex: 0, Data: []byte("initiator-0"), Security: PayloadCleartext},
+		{MessageIndex: 2, Data: []byte("initiator-2"), Security: PayloadForwardSecret},
+	}
+	assert.Equal(t, expected, responder.HandshakePayloads())
+	mu.Lock()
+	assert.Equal(t, expected, handled)
+	mu.Unlock()
+}
+
+func TestHandshakeWithoutPayloadsRecordsNothing(t *testing.T) {
+	initiator, responder := establishPair(t, NewConnConfig("NN", true), NewConnConfig("NN", false))
+	assert.Empty(t, initiator.HandshakePayloads())
+	assert.Empty(t, responder.HandshakePayloads())
+}
+
+func TestHandshakePayloadHandlerRejects(t *testing.T) {
+	initiatorConfig := NewConnConfig("NN", true).
+		WithHandshakePayloadProvider(func(int) []byte { return []byte("v1") }).
+		WithHandshakeTimeout(5 * time.Second)
+	responderConfig := NewConnConfig("NN", false).
+		WithHandshakePayloadHandler(func(p HandshakePayload) error {
+			return errors.New("unsupported version")
+		}).
+		WithHandshakeTimeout(5 * time.Second)
+
+	_, _, initiatorErr, responderErr := runHandshakePair(t, initiatorConfig, responderConfig)
+	assert.Error(t, initiatorErr)
+	require.Error(t, responderErr)
+
+	oopsErr, ok := oops.AsOops(responderErr)
+	require.True(t, ok)
+	assert.Equal(t, "HANDSHAKE_PAYLOAD_REJECTED", oopsErr.Code())
+}
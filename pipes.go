@@ -0,0 +1,198 @@
+package noise
+
+import (
+	"github.com/go-i2p/go-noise/internal"
+	"github.com/go-i2p/noise"
+	"github.com/samber/oops"
+	"github.com/sirupsen/logrus"
+)
+
+// HandshakePath reports which handshake established a connection.
+type HandshakePath int
+
+const (
+	// PathDirect means the configured pattern completed as written
+	PathDirect HandshakePath = iota
+	// PathFallback means a Noise Pipes IK attempt failed and XXfallback completed instead
+	PathFallback
+)
+
+// String returns a string representation of the handshake path.
+func (hp HandshakePath) String() string {
+	switch hp {
+	case PathDirect:
+		return "direct"
+	case PathFallback:
+		return "fallback"
+	default:
+		return "unknown"
+	}
+}
+
+// Noise Pipes reply markers. The responder prefixes its first handshake message
+// with one of these so the initiator knows which pattern to continue with.
+// The Noise specification leaves this signalling to the application, so the
+// markers are go-noise's own and only go-noise peers understand them.
+const (
+	pipeReplyIK       byte = 0x00
+	pipeReplyFallback byte = 0x01
+)
+
+// dhLen is the size of a Curve25519 public key, and so of the plaintext "e"
+// that starts an IK first message.
+const dhLen = 32
+
+// handshakeXXfallback is the XXfallback pattern with the roles swapped so the
+// original responder (Bob) is the Noise initiator and the original
+// initiator's (Alice's) ephemeral key from the failed IK message is a
+// responder pre-message:
+//
+//	<- e
+//	...
+//	-> e, ee, s, se
+//	<- s, es
+//
+// This is the spec's XXfallback written from Bob's side; as a result cs1
+// carries Bob-to-Alice traffic.
+var handshakeXXfallback = noise.HandshakePattern{
+	Name:                 "XXfallback",
+	ResponderPreMessages: []noise.MessagePattern{noise.MessagePatternE},
+	Messages: [][]noise.MessagePattern{
+		{noise.MessagePatternE, noise.MessagePatternDHEE, noise.MessagePatternS, noise.MessagePatternDHSE},
+		{noise.MessagePatternS, noise.MessagePatternDHES},
+	},
+}
+
+// HandshakePath returns which handshake established the connection.
+// It is PathDirect unless Noise Pipes fell back to XXfallback.
+func (nc *NoiseConn) HandshakePath() HandshakePath {
+	nc.stateMutex.RLock()
+	defer nc.stateMutex.RUnlock()
+	return nc.handshakePath
+}
+
+// addPipeMarker prefixes the responder's handshake reply with the path marker
+// when Noise Pipes is enabled.
+func (nc *NoiseConn) addPipeMarker(msg []byte) []byte {
+	if !nc.config.NoisePipes || nc.config.Initiator {
+		return msg
+	}
+
+	marker := pipeReplyIK
+	if nc.handshakePath == PathFallback {
+		marker = pipeReplyFallback
+	}
+	return append([]byte{marker}, msg...)
+}
+
+// acceptPipeReply strips the path marker from the responder's reply when
+// Noise Pipes is enabled, switching to XXfallback if the responder did.
+func (nc *NoiseConn) acceptPipeReply(msg []byte) ([]byte, error) {
+	if !nc.config.NoisePipes || !nc.config.Initiator {
+		return msg, nil
+	}
+
+	if len(msg) == 0 {
+		return nil, oops.
+			Code("INVALID_PIPE_REPLY").
+			In("noise").
+			Wrapf(ErrProtocolViolation, "noise pipes reply is missing its marker")
+	}
+
+	switch msg[0] {
+	case pipeReplyIK:
+		return msg[1:], nil
+	case pipeReplyFallback:
+		return msg[1:], nc.startFallback(false, nil)
+	default:
+		return nil, oops.
+			Code("INVALID_PIPE_REPLY").
+			In("noise").
+			With("marker", msg[0]).
+			Wrapf(ErrProtocolViolation, "unknown noise pipes reply marker")
+	}
+}
+
+// shouldFallback reports whether a responder should answer a failed first
+// message with XXfallback: Noise Pipes is enabled and the initiator's IK
+// message failed to authenticate, usually because it used a stale static key.
+func (nc *NoiseConn) shouldFallback(index int, msg []byte, err error) bool {
+	return nc.config.NoisePipes &&
+		!nc.config.Initiator &&
+		nc.handshakePath == PathDirect &&
+		index == 0 &&
+		len(msg) >= dhLen &&
+		isAuthenticationFailure(err)
+}
+
+// startFallback replaces the failed IK handshake with XXfallback. The
+// responder becomes the Noise initiator and takes the initiator's ephemeral
+// key from the first message; the initiator keeps its ephemeral keypair.
+func (nc *NoiseConn) startFallback(initiator bool, peerEphemeral []byte) error {
+	hs, err := createFallbackHandshakeState(nc.config, nc.protocol, initiator,
+		nc.handshakeState.LocalEphemeral(), peerEphemeral)
+	if err != nil {
+		return err
+	}
+
+	fallback := &protocol{
+		Pattern:      handshakeXXfallback,
+		CipherSuite:  nc.protocol.CipherSuite,
+		PSKPlacement: -1,
+		suite:        nc.protocol.suite,
+	}
+	fallback.Name = fallback.fullName()
+
+	nc.handshakeState = hs
+	nc.handshakeInitiator = initiator
+	// The failed IK message keeps its index; XXfallback messages follow it.
+	nc.handshakeMsgOffset = nc.handshakeMsgIndex
+	nc.handshakeMsgIndex = 0
+	nc.handshakeMsgCount = len(handshakeXXfallback.Messages)
+	nc.payloadSecurity = handshakePayloadSecurity(fallback)
+
+	nc.stateMutex.Lock()
+	nc.handshakePath = PathFallback
+	nc.localAddr = nc.localAddr.withPattern(fallback.Name)
+	nc.remoteAddr = nc.remoteAddr.withPattern(fallback.Name)
+	nc.stateMutex.Unlock()
+
+	nc.logger.WithFields(logrus.Fields{
+		"protocol":  fallback.Name,
+		"initiator": initiator,
+	}).Debug("Noise Pipes falling back to XXfallback")
+
+	return nil
+}
+
+// createFallbackHandshakeState creates the XXfallback handshake state for one side.
+func createFallbackHandshakeState(config *ConnConfig, p *protocol, initiator bool, localEphemeral noise.DHKey, peerEphemeral []byte) (*noise.HandshakeState, error) {
+	staticKeypair, err := createStaticKeypair(config.StaticKey)
+	if err != nil {
+		return nil, err
+	}
+
+	cfg := noise.Config{
+		CipherSuite:   p.CipherSuite,
+		Pattern:       handshakeXXfallback,
+		Initiator:     initiator,
+		Prologue:      config.Prologue,
+		StaticKeypair: staticKeypair,
+	}
+	if initiator {
+		cfg.PeerEphemeral = peerEphemeral[:dhLen]
+	} else {
+		cfg.EphemeralKeypair = localEphemeral
+	}
+
+	hs, err := noise.NewHandshakeState(cfg)
+	if err != nil {
+		return nil, oops.
+			Code("HANDSHAKE_INIT_FAILED").
+			In("noise").
+			With("pattern", handshakeXXfallback.Name).
+			With("initiator", initiator).
+			Wrapf(internal.Mark(err, ErrHandshakeFailed), "failed to create fallback handshake state")
+	}
+	return hs, nil
+}
@@ -0,0 +1,183 @@
+package noise
+
+import (
+	"fmt"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// pipesConfigs returns Noise Pipes configs where the initiator caches cachedKey
+// as the responder's static key.
+func pipesConfigs(t *testing.T, pattern string, responderPrivate, cachedKey []byte) (*ConnConfig, *ConnConfig) {
+	t.Helper()
+	initiatorConfig := NewConnConfig(pattern, true).
+		WithStaticKey(newTestStaticKey(t)).
+		WithRemoteKey(cachedKey).
+		WithNoisePipes(true).
+		WithHandshakeTimeout(5 * time.Second)
+	responderConfig := NewConnConfig(pattern, false).
+		WithStaticKey(responderPrivate).
+		WithNoisePipes(true).
+		WithHandshakeTimeout(5 * time.Second)
+	return initiatorConfig, responderConfig
+}
+
+func TestNoisePipesDirectIK(t *testing.T) {
+	responderPrivate, responderPublic := newTestKeyPair(t)
+	initiatorConfig, responderConfig := pipesConfigs(t, "IK", responderPrivate, responderPublic)
+
+	initiator, responder := establishPair(t, initiatorConfig, responderConfig)
+
+	assert.Equal(t, PathDirect, initiator.HandshakePath())
+	assert.Equal(t, PathDirect, responder.HandshakePath())
+	assert.Equal(t, "Noise_IK_25519_AESGCM_SHA256", initiator.Snapshot().Protocol)
+	assert.Equal(t, responderPublic, initiator.PeerStatic())
+	sendMessages(t, initiator, responder, []string{"direct"}, 0)
+	sendMessages(t, responder, initiator, []string{"reply"}, 0)
+}
+
+func TestNoisePipesFallbackOnStaleKey(t *testing.T) {
+	for _, pattern := range []string{"IK", "Noise_IK_25519_ChaChaPoly_BLAKE2s"} {
+		t.Run(pattern, func(t *testing.T) {
+			responderPrivate, responderPublic := newTestKeyPair(t)
+			_, staleKey := newTestKeyPair(t)
+			initiatorConfig, responderConfig := pipesConfigs(t, pattern, responderPrivate, staleKey)
+			initiatorPublic, err := createStaticKeypair(initiatorConfig.StaticKey)
+			require.NoError(t, err)
+
+			initiator, responder := establishPair(t, initiatorConfig, responderConfig)
+
+			assert.Equal(t, PathFallback, initiator.HandshakePath())
+			assert.Equal(t, PathFallback, responder.HandshakePath())
+			assert.Equal(t, responderPublic, initiator.PeerStatic(), "initiator learns the rotated key")
+			assert.Equal(t, initiatorPublic.Public, responder.PeerStatic())
+			assert.Equal(t, initiator.HandshakeHash(), responder.HandshakeHash())
+			assert.Contains(t, initiator.Snapshot().Protocol, "Noise_XXfallback_25519_")
+			assert.Equal(t, PathFallback, responder.Snapshot().HandshakePath)
+
+			sendMessages(t, initiator, responder, []string{"after fallback"}, 0)
+			sendMessages(t, responder, initiator, []string{"reply"}, 0)
+		})
+	}
+}
+
+func TestStaleKeyWithoutNoisePipesFails(t *testing.T) {
+	responderPrivate, _ := newTestKeyPair(t)
+	_, staleKey := newTestKeyPair(t)
+	initiatorConfig, responderConfig := pipesConfigs(t, "IK", responderPrivate, staleKey)
+	responderConfig.WithNoisePipes(false)
+
+	_, _, initiatorErr, responderErr := runHandshakePair(t, initiatorConfig, responderConfig)
+	assert.Error(t, initiatorErr)
+	assert.Error(t, responderErr)
+}
+
+func TestNoisePipesValidation(t *testing.T) {
+	err := NewConnConfig("XX", true).WithNoisePipes(true).Validate()
+	requireErrorCode(t, err, "INVALID_PATTERN")
+
+	err = NewConnConfig("IKpsk2", true).WithPresharedKey(make([]byte, 32), 2).WithNoisePipes(true).Validate()
+	requireErrorCode(t, err, "INVALID_PATTERN")
+
+	err = NewListenerConfig("XX").WithStaticKey(make([]byte, 32)).WithNoisePipes(true).Validate()
+	requireErrorCode(t, err, "INVALID_PATTERN")
+
+	// A key for the bare IK pattern is rejected up front, not on each Accept.
+	listenerConfig := NewListenerConfig("IK").WithStaticKey(make([]byte, 32)).
+		WithPresharedKey(make([]byte, 32), 2).WithNoisePipes(true)
+	requireErrorCode(t, listenerConfig.Validate(), "INVALID_PATTERN")
+	tcpListener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer tcpListener.Close()
+	_, err = NewNoiseListener(tcpListener, listenerConfig)
+	assert.ErrorIs(t, err, ErrInvalidConfig)
+
+	assert.NoError(t, NewConnConfig("Noise_IK_25519_ChaChaPoly_SHA256", false).WithNoisePipes(true).Validate())
+}
+
+func TestListenerNoisePipesFallback(t *testing.T) {
+	responderPrivate, responderPublic := newTestKeyPair(t)
+	_, staleKey := newTestKeyPair(t)
+
+	tcpListener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	listener, err := NewNoiseListener(tcpListener, NewListenerConfig("IK").
+		WithStaticKey(responderPrivate).
+		WithNoisePipes(true).
+		WithHandshakeTimeout(5*time.Second))
+	require.NoError(t, err)
+	defer listener.Close()
+
+	accepted := make(chan *NoiseConn, 1)
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			accepted <- nil
+			return
+		}
+		nc := conn.(*NoiseConn)
+		if err := nc.Handshake(t.Context()); err != nil {
+			nc.Close()
+			accepted <- nil
+			return
+		}
+		accepted <- nc
+	}()
+
+	rawConn, err := net.Dial("tcp", tcpListener.Addr().String())
+	require.NoError(t, err)
+	client, err := NewNoiseConn(rawConn, NewConnConfig("IK", true).
+		WithStaticKey(newTestStaticKey(t)).
+		WithRemoteKey(staleKey).
+		WithNoisePipes(true).
+		WithHandshakeTimeout(5*time.Second))
+	require.NoError(t, err)
+	defer client.Close()
+
+	require.NoError(t, client.Handshake(t.Context()))
+	server := <-accepted
+	require.NotNil(t, server)
+	defer server.Close()
+
+	assert.Equal(t, PathFallback, client.HandshakePath())
+	assert.Equal(t, PathFallback, server.HandshakePath())
+	assert.Equal(t, responderPublic, client.PeerStatic())
+	sendMessages(t, client, server, []string{"via listener"}, 0)
+}
+
+func TestNoisePipesFallbackPayloadIndexes(t *testing.T) {
+	responderPrivate, _ := newTestKeyPair(t)
+	_, staleKey := newTestKeyPair(t)
+	initiatorConfig, responderConfig := pipesConfigs(t, "IK", responderPrivate, staleKey)
+
+	var initiatorIndexes []int
+	initiatorConfig.WithHandshakePayloadProvider(func(msgIndex int) []byte {
+		initiatorIndexes = append(initiatorIndexes, msgIndex)
+		return []byte(fmt.Sprintf("initiator-%d", msgIndex))
+	})
+	responderConfig.WithHandshakePayloadProvider(func(msgIndex int) []byte {
+		return []byte(fmt.Sprintf("responder-%d", msgIndex))
+	})
+
+	initiator, responder := establishPair(t, initiatorConfig, responderConfig)
+	require.Equal(t, PathFallback, responder.HandshakePath())
+
+	// Message 0 is the IK attempt; the XXfallback messages continue at 1.
+	assert.Equal(t, []int{0, 2}, initiatorIndexes)
+	initiatorPayloads := initiator.HandshakePayloads()
+	require.Len(t, initiatorPayloads, 1)
+	assert.Equal(t, 1, initiatorPayloads[0].MessageIndex)
+	assert.Equal(t, "responder-1", string(initiatorPayloads[0].Data))
+
+	// The IK payload could not be decrypted and is lost; the one resent at
+	// index 2 arrives.
+	responderPayloads := responder.HandshakePayloads()
+	require.Len(t, responderPayloads, 1)
+	assert.Equal(t, 2, responderPayloads[0].MessageIndex)
+	assert.Equal(t, "initiator-2", string(responderPayloads[0].Data))
+	assert.Equal(t, PayloadForwardSecret, responderPayloads[0].Security)
+}
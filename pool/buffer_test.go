@@ -1,9 +1,12 @@
 package pool
 
 import (
+	"errors"
 	"net"
 	"testing"
 	"time"
+
+	"github.com/go-i2p/go-noise/internal"
 )
 
 // mockConn implements net.Conn for testing
@@ -294,4 +297,7 @@ func TestConnPool_NilConnection(t *testing.T) {
 	if err == nil {
 		t.Error("Put should fail with nil connection")
 	}
+	if !errors.Is(err, internal.ErrInvalidConfig) {
+		t.Errorf("Put error should match ErrInvalidConfig, got %v", err)
+	}
 }
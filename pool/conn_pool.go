@@ -5,6 +5,7 @@ import (
 	"sync"
 	"time"
 
+	"github.com/go-i2p/go-noise/internal"
 	"github.com/samber/oops"
 )
 
@@ -77,7 +78,10 @@ func (p *ConnPool) Get(remoteAddr string) net.Conn {
 // Put adds a connection to the pool for reuse
 func (p *ConnPool) Put(conn net.Conn) error {
 	if conn == nil {
-		return oops.Errorf("cannot put nil connection in pool")
+		return oops.
+			Code("INVALID_CONN").
+			In("pool").
+			Wrapf(internal.ErrInvalidConfig, "cannot put nil connection in pool")
 	}
 
 	remoteAddr := conn.RemoteAddr().String()
@@ -0,0 +1,135 @@
+package noise
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/samber/oops"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPrologueMatchingHandshake(t *testing.T) {
+	prologue := []byte("myproto/v2;offered=v1,v2")
+
+	for _, pattern := range []string{"NN", "XX"} {
+		t.Run(pattern, func(t *testing.T) {
+			initiatorConfig := NewConnConfig(pattern, true).
+				WithStaticKey(newTestStaticKey(t)).
+				WithPrologue(prologue).
+				WithHandshakeTimeout(5 * time.Second)
+			responderConfig := NewConnConfig(pattern, false).
+				WithStaticKey(newTestStaticKey(t)).
+				WithPrologue(prologue).
+				WithHandshakeTimeout(5 * time.Second)
+
+			establishPair(t, initiatorConfig, responderConfig)
+		})
+	}
+}
+
+func TestPrologueMismatchFailsAuthentication(t *testing.T) {
+	initiatorConfig := NewConnConfig("NN", true).
+		WithPrologue([]byte("myproto/v2")).
+		WithHandshakeTimeout(5 * time.Second)
+	responderConfig := NewConnConfig("NN", false).
+		WithPrologue([]byte("myproto/v1")).
+		WithHandshakeTimeout(5 * time.Second)
+
+	_, _, initiatorErr, _ := runHandshakePair(t, initiatorConfig, responderConfig)
+	require.Error(t, initiatorErr)
+
+	oopsErr, ok := oops.AsOops(initiatorErr)
+	require.True(t, ok)
+	assert.Equal(t, "HANDSHAKE_AUTH_FAILED", oopsErr.Code())
+	assert.ErrorIs(t, initiatorErr, ErrAuthFailed)
+	assert.Contains(t, initiatorErr.Error(), "prologue", "the prologue is named as a possible cause")
+}
+
+func TestWrongPSKWithPrologueIsNotBlamedOnPrologue(t *testing.T) {
+	prologue := []byte("myproto/v1")
+	initiatorConfig := NewConnConfig("NNpsk0", true).
+		WithPresharedKey(newTestPSK(t), 0).
+		WithPrologue(prologue).
+		WithHandshakeTimeout(5 * time.Second)
+	responderConfig := NewConnConfig("NNpsk0", false).
+		WithPresharedKey(newTestPSK(t), 0).
+		WithPrologue(prologue).
+		WithHandshakeTimeout(5 * time.Second)
+
+	_, _, _, responderErr := runHandshakePair(t, initiatorConfig, responderConfig)
+	require.Error(t, responderErr)
+
+	oopsErr, ok := oops.AsOops(responderErr)
+	require.True(t, ok)
+	assert.Equal(t, "HANDSHAKE_AUTH_FAILED", oopsErr.Code())
+	assert.ErrorIs(t, responderErr, ErrAuthFailed)
+}
+
+func TestIsAuthenticationFailureMatchesCipherErrors(t *testing.T) {
+	for name, cf := range cipherFuncs {
+		_, err := cf.Cipher([32]byte{1}).Decrypt(nil, 7, []byte("ad"), make([]byte, 40))
+		require.Error(t, err, name)
+		assert.True(t, isAuthenticationFailure(err), name)
+		assert.True(t, isAuthenticationFailure(fmt.Errorf("wrapped: %w", err)), name)
+	}
+	assert.False(t, isAuthenticationFailure(errors.New("cipher: message authentication failed")),
+		"errors are matched by value, not by text")
+}
+
+func TestPrologueMissingOnOneSideFails(t *testing.T) {
+	initiatorConfig := NewConnConfig("NN", true).
+		WithHandshakeTimeout(5 * time.Second)
+	responderConfig := NewConnConfig("NN", false).
+		WithPrologue([]byte("myproto/v2")).
+		WithHandshakeTimeout(5 * time.Second)
+
+	_, _, initiatorErr, _ := runHandshakePair(t, initiatorConfig, responderConfig)
+	assert.Error(t, initiatorErr)
+}
+
+func TestWithPrologueCopiesInput(t *testing.T) {
+	prologue := []byte("v1")
+	config := NewConnConfig("NN", true).WithPrologue(prologue)
+	listenerConfig := NewListenerConfig("NN").WithPrologue(prologue)
+	prologue[0] = 'x'
+
+	assert.Equal(t, []byte("v1"), config.Prologue)
+	assert.Equal(t, []byte("v1"), listenerConfig.Prologue)
+}
+
+func TestListenerAppliesPrologue(t *testing.T) {
+	prologue := []byte("myproto/v2")
+	tcpListener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	listener, err := NewNoiseListener(tcpListener, NewListenerConfig("NN").
+		WithPrologue(prologue).
+		WithHandshakeTimeout(5*time.Second))
+	require.NoError(t, err)
+	defer listener.Close()
+
+	accepted := make(chan error, 1)
+	go func() {
+		conn, err := listener.Accept()
+		if err == nil {
+			defer conn.Close()
+			err = conn.(*NoiseConn).Handshake(t.Context())
+		}
+		accepted <- err
+	}()
+
+	rawConn, err := net.Dial("tcp", tcpListener.Addr().String())
+	require.NoError(t, err)
+	client, err := NewNoiseConn(rawConn, NewConnConfig("NN", true).
+		WithPrologue(prologue).
+		WithHandshakeTimeout(5*time.Second))
+	require.NoError(t, err)
+	defer client.Close()
+
+	require.NoError(t, client.Handshake(t.Context()))
+	require.NoError(t, <-accepted)
+}
@@ -0,0 +1,241 @@
+package noise
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/go-i2p/noise"
+	"github.com/samber/oops"
+)
+
+// Default primitives used when a bare pattern name such as "XX" is configured.
+const (
+	defaultDH     = "25519"
+	defaultCipher = "AESGCM"
+	defaultHash   = "SHA256"
+)
+
+// handshakePatterns maps Noise pattern names to go-i2p/noise HandshakePattern types.
+// The deferred patterns are defined in deferred.go.
+var handshakePatterns = map[string]noise.HandshakePattern{
+	"N":  noise.HandshakeN,
+	"K":  noise.HandshakeK,
+	"X":  noise.HandshakeX,
+	"NN": noise.HandshakeNN,
+	"NK": noise.HandshakeNK,
+	"NX": noise.HandshakeNX,
+	"XN": noise.HandshakeXN,
+	"XK": noise.HandshakeXK,
+	"XX": noise.HandshakeXX,
+	"KN": noise.HandshakeKN,
+	"KK": noise.HandshakeKK,
+	"KX": noise.HandshakeKX,
+	"IN": noise.HandshakeIN,
+	"IK": noise.HandshakeIK,
+	"IX": noise.HandshakeIX,
+
+	// Deferred patterns
+	"NK1":  handshakeNK1,
+	"NX1":  handshakeNX1,
+	"X1N":  handshakeX1N,
+	"X1K":  handshakeX1K,
+	"XK1":  handshakeXK1,
+	"X1K1": handshakeX1K1,
+	"X1X":  handshakeX1X,
+	"XX1":  handshakeXX1,
+	"X1X1": handshakeX1X1,
+	"K1N":  handshakeK1N,
+	"K1K":  handshakeK1K,
+	"KK1":  handshakeKK1,
+	"K1K1": handshakeK1K1,
+	"K1X":  handshakeK1X,
+	"KX1":  handshakeKX1,
+	"K1X1": handshakeK1X1,
+	"I1N":  handshakeI1N,
+	"I1K":  handshakeI1K,
+	"IK1":  handshakeIK1,
+	"I1K1": handshakeI1K1,
+	"I1X":  handshakeI1X,
+	"IX1":  handshakeIX1,
+	"I1X1": handshakeI1X1,
+}
+
+// dhFuncs maps Noise DH function names to go-i2p/noise primitives.
+var dhFuncs = map[string]noise.DHFunc{
+	"25519": noise.DH25519,
+}
+
+// cipherFuncs maps Noise cipher function names to go-i2p/noise primitives.
+var cipherFuncs = map[string]noise.CipherFunc{
+	"AESGCM":     noise.CipherAESGCM,
+	"ChaChaPoly": noise.CipherChaChaPoly,
+}
+
+// hashFuncs maps Noise hash function names to go-i2p/noise primitives.
+var hashFuncs = map[string]noise.HashFunc{
+	"SHA256":  noise.HashSHA256,
+	"SHA512":  noise.HashSHA512,
+	"BLAKE2s": noise.HashBLAKE2s,
+	"BLAKE2b": noise.HashBLAKE2b,
+}
+
+// pskModifierPrefix introduces a pre-shared key modifier in a pattern name, e.g. "XXpsk3".
+const pskModifierPrefix = "psk"
+
+// protocol is a parsed Noise protocol name such as
+// "Noise_XX_25519_ChaChaPoly_BLAKE2s" or "Noise_IKpsk2_25519_AESGCM_SHA256".
+type protocol struct {
+	// Name is the canonical full protocol name
+	Name string
+	// Pattern is the base handshake pattern, without PSK modifiers
+	Pattern noise.HandshakePattern
+	// CipherSuite combines the DH, cipher and hash functions
+	CipherSuite noise.CipherSuite
+	// PSKPlacement is the message index of the pskN modifier, or -1 if none
+	PSKPlacement int
+	// suite is the "DH_CIPHER_HASH" part of the name
+	suite string
+}
+
+// parseProtocolName splits a Noise protocol name into its pattern, DH, cipher
+// and hash parts and maps each to the underlying noise primitives.
+// A bare pattern name such as "XX" selects the default 25519_AESGCM_SHA256 suite.
+func parseProtocolName(name string) (*protocol, error) {
+	parts := []string{name, defaultDH, defaultCipher, defaultHash}
+	if strings.HasPrefix(name, "Noise_") {
+		parts = strings.Split(strings.TrimPrefix(name, "Noise_"), "_")
+		if len(parts) != 4 {
+			return nil, oops.
+				Code("INVALID_PROTOCOL_NAME").
+				In("noise").
+				With("protocol", name).
+				Wrapf(ErrInvalidConfig, "protocol name must have the form Noise_PATTERN_DH_CIPHER_HASH")
+		}
+	}
+
+	pattern, pskPlacement, err := parsePatternName(name, parts[0])
+	if err != nil {
+		return nil, err
+	}
+	dh, ok := dhFuncs[parts[1]]
+	if !ok {
+		return nil, unsupportedProtocolPart(name, "dh", parts[1])
+	}
+	cipher, ok := cipherFuncs[parts[2]]
+	if !ok {
+		return nil, unsupportedProtocolPart(name, "cipher", parts[2])
+	}
+	hash, ok := hashFuncs[parts[3]]
+	if !ok {
+		return nil, unsupportedProtocolPart(name, "hash", parts[3])
+	}
+
+	p := &protocol{
+		Pattern:      pattern,
+		CipherSuite:  noise.NewCipherSuite(dh, cipher, hash),
+		PSKPlacement: pskPlacement,
+		suite:        strings.Join(parts[1:], "_"),
+	}
+	p.Name = p.fullName()
+	return p, nil
+}
+
+// parsePatternName splits a pattern such as "XXpsk3" into its base pattern
+// and PSK placement. The placement is -1 when no psk modifier is present.
+func parsePatternName(name, patternName string) (noise.HandshakePattern, int, error) {
+	base, modifier := patternName, ""
+	if idx := strings.Index(patternName, pskModifierPrefix); idx > 0 {
+		base, modifier = patternName[:idx], patternName[idx:]
+	}
+
+	pattern, ok := lookupHandshakePattern(base)
+	if !ok {
+		return noise.HandshakePattern{}, -1, unsupportedProtocolPart(name, "pattern", patternName)
+	}
+	if modifier == "" {
+		return pattern, -1, nil
+	}
+
+	placement, err := strconv.Atoi(strings.TrimPrefix(modifier, pskModifierPrefix))
+	if err != nil || placement < 0 || placement > len(pattern.Messages) {
+		return noise.HandshakePattern{}, -1, oops.
+			Code("UNSUPPORTED_PSK_MODIFIER").
+			In("noise").
+			With("protocol", name).
+			With("modifier", modifier).
+			Wrapf(ErrInvalidConfig, "unsupported psk modifier %q: only a single pskN with N in 0..%d is supported", modifier, len(pattern.Messages))
+	}
+	return pattern, placement, nil
+}
+
+// fullName builds the canonical protocol name, including any psk modifier.
+func (p *protocol) fullName() string {
+	patternName := p.Pattern.Name
+	if p.PSKPlacement >= 0 {
+		patternName += pskModifierPrefix + strconv.Itoa(p.PSKPlacement)
+	}
+	return "Noise_" + patternName + "_" + p.suite
+}
+
+// resolveProtocol parses a protocol name and reconciles it with a configured
+// pre-shared key. A psk modifier in the name requires a key with the same
+// placement; a key configured for a bare pattern adds the modifier.
+func resolveProtocol(name string, psk []byte, placement int) (*protocol, error) {
+	p, err := parseProtocolName(name)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(psk) == 0 {
+		if p.PSKPlacement >= 0 {
+			return nil, oops.
+				Code("PSK_REQUIRED").
+				In("noise").
+				With("protocol", name).
+				Wrapf(ErrInvalidConfig, "protocol %s requires a pre-shared key", name)
+		}
+		return p, nil
+	}
+
+	if p.PSKPlacement >= 0 && p.PSKPlacement != placement {
+		return nil, oops.
+			Code("PSK_PLACEMENT_MISMATCH").
+			In("noise").
+			With("protocol", name).
+			With("placement", placement).
+			Wrapf(ErrInvalidConfig, "pre-shared key placement %d does not match protocol %s", placement, name)
+	}
+	if placement < 0 || placement > len(p.Pattern.Messages) {
+		return nil, oops.
+			Code("INVALID_PSK_PLACEMENT").
+			In("noise").
+			With("protocol", name).
+			With("placement", placement).
+			Wrapf(ErrInvalidConfig, "pre-shared key placement must be between 0 and %d", len(p.Pattern.Messages))
+	}
+
+	p.PSKPlacement = placement
+	p.Name = p.fullName()
+	return p, nil
+}
+
+// unsupportedProtocolPart builds the error returned for an unknown protocol name component.
+func unsupportedProtocolPart(name, part, value string) error {
+	code := "UNSUPPORTED_" + strings.ToUpper(part)
+	return oops.
+		Code(code).
+		In("noise").
+		With("protocol", name).
+		With(part, value).
+		Wrapf(ErrInvalidConfig, "unsupported %s %q in protocol name %s", part, value, name)
+}
+
+// protocolName returns the canonical full protocol name for a configured
+// pattern and pre-shared key, or the pattern unchanged if it cannot be resolved.
+func protocolName(patternName string, psk []byte, placement int) string {
+	p, err := resolveProtocol(patternName, psk, placement)
+	if err != nil {
+		return patternName
+	}
+	return p.Name
+}
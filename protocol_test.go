@@ -0,0 +1,112 @@
+package noise
+
+import (
+	"testing"
+	"time"
+
+	"github.com/samber/oops"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseProtocolName(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+		pattern  string
+	}{
+		{"XX", "Noise_XX_25519_AESGCM_SHA256", "XX"},
+		{"Noise_IK_25519_AESGCM_SHA256", "Noise_IK_25519_AESGCM_SHA256", "IK"},
+		{"Noise_XX_25519_ChaChaPoly_BLAKE2s", "Noise_XX_25519_ChaChaPoly_BLAKE2s", "XX"},
+		{"Noise_NN_25519_ChaChaPoly_BLAKE2b", "Noise_NN_25519_ChaChaPoly_BLAKE2b", "NN"},
+		{"Noise_NK_25519_AESGCM_SHA512", "Noise_NK_25519_AESGCM_SHA512", "NK"},
+		{"Noise_N_25519_ChaChaPoly_SHA256", "Noise_N_25519_ChaChaPoly_SHA256", "N"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			p, err := parseProtocolName(tt.input)
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, p.Name)
+			assert.Equal(t, tt.pattern, p.Pattern.Name)
+			assert.NotNil(t, p.CipherSuite)
+		})
+	}
+}
+
+func TestParseProtocolNameRejectsUnknownParts(t *testing.T) {
+	tests := []struct {
+		input string
+		code  string
+	}{
+		{"ZZ", "UNSUPPORTED_PATTERN"},
+		{"Noise_ZZ_25519_AESGCM_SHA256", "UNSUPPORTED_PATTERN"},
+		{"Noise_XX_448_AESGCM_SHA256", "UNSUPPORTED_DH"},
+		{"Noise_XX_25519_AES256_SHA256", "UNSUPPORTED_CIPHER"},
+		{"Noise_XX_25519_ChaChaPoly_MD5", "UNSUPPORTED_HASH"},
+		{"Noise_XX_25519_chachapoly_blake2s", "UNSUPPORTED_CIPHER"},
+		{"Noise_XX", "INVALID_PROTOCOL_NAME"},
+		{"Noise_XX_25519_AESGCM_SHA256_extra", "INVALID_PROTOCOL_NAME"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			_, err := parseProtocolName(tt.input)
+			require.Error(t, err)
+			oopsErr, ok := oops.AsOops(err)
+			require.True(t, ok)
+			assert.Equal(t, tt.code, oopsErr.Code())
+			assert.ErrorIs(t, err, ErrInvalidConfig)
+		})
+	}
+}
+
+func TestHandshakeWithSelectedCipherSuites(t *testing.T) {
+	for _, name := range []string{
+		"Noise_XX_25519_ChaChaPoly_BLAKE2s",
+		"Noise_XX_25519_ChaChaPoly_BLAKE2b",
+		"Noise_XX_25519_AESGCM_SHA512",
+		"Noise_NN_25519_ChaChaPoly_SHA256",
+	} {
+		t.Run(name, func(t *testing.T) {
+			initiatorConfig := NewConnConfig(name, true).
+				WithStaticKey(newTestStaticKey(t)).
+				WithHandshakeTimeout(5 * time.Second)
+			responderConfig := NewConnConfig(name, false).
+				WithStaticKey(newTestStaticKey(t)).
+				WithHandshakeTimeout(5 * time.Second)
+
+			initiator, responder := establishPair(t, initiatorConfig, responderConfig)
+
+			go func() {
+				_, _ = initiator.Write([]byte("suite check"))
+			}()
+			buf := make([]byte, 32)
+			n, err := responder.Read(buf)
+			require.NoError(t, err)
+			assert.Equal(t, "suite check", string(buf[:n]))
+
+			local, ok := initiator.LocalAddr().(*NoiseAddr)
+			require.True(t, ok)
+			assert.Equal(t, name, local.Pattern())
+		})
+	}
+}
+
+func TestMismatchedCipherSuitesFailHandshake(t *testing.T) {
+	initiatorConfig := NewConnConfig("Noise_NN_25519_ChaChaPoly_BLAKE2s", true).
+		WithHandshakeTimeout(5 * time.Second)
+	responderConfig := NewConnConfig("Noise_NN_25519_AESGCM_SHA256", false).
+		WithHandshakeTimeout(5 * time.Second)
+
+	_, _, initiatorErr, responderErr := runHandshakePair(t, initiatorConfig, responderConfig)
+	assert.True(t, initiatorErr != nil || responderErr != nil, "peers using different suites must not complete a handshake")
+}
+
+func TestNoiseAddrCarriesFullProtocolName(t *testing.T) {
+	initiator, _ := establishPair(t, NewConnConfig("NN", true), NewConnConfig("NN", false))
+
+	local, ok := initiator.LocalAddr().(*NoiseAddr)
+	require.True(t, ok)
+	assert.Equal(t, "Noise_NN_25519_AESGCM_SHA256", local.Pattern())
+}
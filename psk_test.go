@@ -0,0 +1,210 @@
+package noise
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/samber/oops"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newTestPSK returns a random 32-byte pre-shared key for tests.
+func newTestPSK(t *testing.T) []byte {
+	t.Helper()
+	return newTestStaticKey(t)
+}
+
+func TestParsePSKPatternModifiers(t *testing.T) {
+	tests := []struct {
+		input     string
+		pattern   string
+		placement int
+		name      string
+	}{
+		{"NNpsk0", "NN", 0, "Noise_NNpsk0_25519_AESGCM_SHA256"},
+		{"Noise_XXpsk3_25519_ChaChaPoly_BLAKE2s", "XX", 3, "Noise_XXpsk3_25519_ChaChaPoly_BLAKE2s"},
+		{"IKpsk2", "IK", 2, "Noise_IKpsk2_25519_AESGCM_SHA256"},
+		{"Npsk0", "N", 0, "Noise_Npsk0_25519_AESGCM_SHA256"},
+		{"XX", "XX", -1, "Noise_XX_25519_AESGCM_SHA256"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			p, err := parseProtocolName(tt.input)
+			require.NoError(t, err)
+			assert.Equal(t, tt.pattern, p.Pattern.Name)
+			assert.Equal(t, tt.placement, p.PSKPlacement)
+			assert.Equal(t, tt.name, p.Name)
+		})
+	}
+
+	for _, invalid := range []string{"NNpsk", "NNpsk3", "XXpsk0+psk2", "XXpskX", "ZZpsk0"} {
+		_, err := parseProtocolName(invalid)
+		assert.Error(t, err, "pattern %s should be rejected", invalid)
+	}
+}
+
+func TestResolveProtocolReconcilesPSK(t *testing.T) {
+	psk := make([]byte, 32)
+
+	p, err := resolveProtocol("XX", psk, 3)
+	require.NoError(t, err)
+	assert.Equal(t, "Noise_XXpsk3_25519_AESGCM_SHA256", p.Name)
+
+	_, err = resolveProtocol("XXpsk3", psk, 3)
+	assert.NoError(t, err)
+
+	tests := []struct {
+		pattern   string
+		psk       []byte
+		placement int
+		code      string
+	}{
+		{"XXpsk3", nil, 0, "PSK_REQUIRED"},
+		{"XXpsk3", psk, 2, "PSK_PLACEMENT_MISMATCH"},
+		{"NN", psk, 3, "INVALID_PSK_PLACEMENT"},
+		{"NN", psk, -1, "INVALID_PSK_PLACEMENT"},
+	}
+	for _, tt := range tests {
+		_, err := resolveProtocol(tt.pattern, tt.psk, tt.placement)
+		require.Error(t, err)
+		oopsErr, ok := oops.AsOops(err)
+		require.True(t, ok)
+		assert.Equal(t, tt.code, oopsErr.Code())
+	}
+}
+
+func TestPresharedKeyValidation(t *testing.T) {
+	err := NewConnConfig("NNpsk0", true).WithPresharedKey(make([]byte, 31), 0).Validate()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "pre-shared key must be 32 bytes")
+
+	err = NewConnConfig("NNpsk0", true).Validate()
+	assert.Error(t, err, "psk pattern without a key should be rejected")
+
+	err = NewConnConfig("NNpsk0", true).WithPresharedKey(make([]byte, 32), 0).Validate()
+	assert.NoError(t, err)
+
+	err = NewListenerConfig("NNpsk0").WithPresharedKey(make([]byte, 16), 0).Validate()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "pre-shared key must be 32 bytes")
+
+	err = NewListenerConfig("XXpsk3").WithStaticKey(make([]byte, 32)).Validate()
+	assert.Error(t, err, "psk pattern without a key should be rejected")
+}
+
+func TestPSKHandshakes(t *testing.T) {
+	tests := []struct {
+		pattern   string
+		placement int
+	}{
+		{"NNpsk0", 0},
+		{"NNpsk2", 2},
+		{"XXpsk3", 3},
+		{"IKpsk2", 2},
+		{"Noise_XXpsk3_25519_ChaChaPoly_BLAKE2s", 3},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.pattern, func(t *testing.T) {
+			psk := newTestPSK(t)
+			responderPrivate, responderPublic := newTestKeyPair(t)
+
+			initiatorConfig := NewConnConfig(tt.pattern, true).
+				WithStaticKey(newTestStaticKey(t)).
+				WithPresharedKey(psk, tt.placement).
+				WithHandshakeTimeout(5 * time.Second)
+			if tt.pattern == "IKpsk2" {
+				initiatorConfig = initiatorConfig.WithRemoteKey(responderPublic)
+			}
+			responderConfig := NewConnConfig(tt.pattern, false).
+				WithStaticKey(responderPrivate).
+				WithPresharedKey(psk, tt.placement).
+				WithHandshakeTimeout(5 * time.Second)
+
+			initiator, responder := establishPair(t, initiatorConfig, responderConfig)
+
+			go func() {
+				_, _ = initiator.Write([]byte("psk traffic"))
+			}()
+			buf := make([]byte, 32)
+			n, err := responder.Read(buf)
+			require.NoError(t, err)
+			assert.Equal(t, "psk traffic", string(buf[:n]))
+		})
+	}
+}
+
+func TestPSKAddedToBarePattern(t *testing.T) {
+	psk := newTestPSK(t)
+	initiator, _ := establishPair(t,
+		NewConnConfig("NN", true).WithPresharedKey(psk, 0),
+		NewConnConfig("NNpsk0", false).WithPresharedKey(psk, 0))
+
+	local, ok := initiator.LocalAddr().(*NoiseAddr)
+	require.True(t, ok)
+	assert.Equal(t, "Noise_NNpsk0_25519_AESGCM_SHA256", local.Pattern())
+}
+
+func TestPSKMismatchFailsHandshake(t *testing.T) {
+	for _, pattern := range []string{"NNpsk0", "XXpsk3"} {
+		t.Run(pattern, func(t *testing.T) {
+			placement := 0
+			if pattern == "XXpsk3" {
+				placement = 3
+			}
+			initiatorConfig := NewConnConfig(pattern, true).
+				WithStaticKey(newTestStaticKey(t)).
+				WithPresharedKey(newTestPSK(t), placement).
+				WithHandshakeTimeout(5 * time.Second)
+			responderConfig := NewConnConfig(pattern, false).
+				WithStaticKey(newTestStaticKey(t)).
+				WithPresharedKey(newTestPSK(t), placement).
+				WithHandshakeTimeout(5 * time.Second)
+
+			_, responder, initiatorErr, responderErr := runHandshakePair(t, initiatorConfig, responderConfig)
+			assert.Error(t, responderErr, "responder must reject a different PSK")
+			if pattern == "NNpsk0" {
+				// The responder detects the mismatch on message 1 and hangs up.
+				assert.Error(t, initiatorErr)
+			}
+			assert.Nil(t, responder.recvCipher)
+		})
+	}
+}
+
+func TestListenerAcceptsPSKConnections(t *testing.T) {
+	psk := newTestPSK(t)
+	tcpListener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	listener, err := NewNoiseListener(tcpListener, NewListenerConfig("NNpsk0").
+		WithPresharedKey(psk, 0).
+		WithHandshakeTimeout(5*time.Second))
+	require.NoError(t, err)
+	defer listener.Close()
+	assert.Equal(t, "Noise_NNpsk0_25519_AESGCM_SHA256", listener.Addr().(*NoiseAddr).Pattern())
+
+	accepted := make(chan error, 1)
+	go func() {
+		conn, err := listener.Accept()
+		if err == nil {
+			err = conn.(*NoiseConn).Handshake(t.Context())
+			defer conn.Close()
+		}
+		accepted <- err
+	}()
+
+	rawConn, err := net.Dial("tcp", tcpListener.Addr().String())
+	require.NoError(t, err)
+	client, err := NewNoiseConn(rawConn, NewConnConfig("NNpsk0", true).
+		WithPresharedKey(psk, 0).
+		WithHandshakeTimeout(5*time.Second))
+	require.NoError(t, err)
+	defer client.Close()
+
+	require.NoError(t, client.Handshake(t.Context()))
+	require.NoError(t, <-accepted)
+}
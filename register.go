@@ -0,0 +1,283 @@
+package noise
+
+import (
+	"strings"
+	"sync"
+	"unicode"
+
+	"github.com/go-i2p/noise"
+	"github.com/samber/oops"
+)
+
+// patternsMutex guards handshakePatterns against concurrent registration.
+var patternsMutex sync.RWMutex
+
+// lookupHandshakePattern returns the built-in or registered pattern with the given name.
+func lookupHandshakePattern(name string) (noise.HandshakePattern, bool) {
+	patternsMutex.RLock()
+	defer patternsMutex.RUnlock()
+	pattern, ok := handshakePatterns[name]
+	return pattern, ok
+}
+
+// patternTokens maps Noise pattern notation tokens to go-i2p/noise message patterns.
+var patternTokens = map[string]noise.MessagePattern{
+	"e":  noise.MessagePatternE,
+	"s":  noise.MessagePatternS,
+	"ee": noise.MessagePatternDHEE,
+	"es": noise.MessagePatternDHES,
+	"se": noise.MessagePatternDHSE,
+	"ss": noise.MessagePatternDHSS,
+}
+
+// RegisterPattern parses a handshake pattern written in Noise specification
+// notation and makes it available under name in ConnConfig.Pattern and
+// ListenerConfig.Pattern, either bare or inside a full protocol name.
+// Pre-messages come before a "..." line:
+//
+//	<- s
+//	...
+//	-> e, es
+//	<- e, ee
+//
+// The pattern must satisfy the validity rules of section 7.3 of the
+// specification. Pre-shared keys are added with a pskN modifier on the name,
+// not with "psk" tokens. Built-in and previously registered names cannot be
+// replaced.
+func RegisterPattern(name, spec string) error {
+	if err := validatePatternName(name); err != nil {
+		return err
+	}
+
+	pattern, err := parsePatternSpec(name, spec)
+	if err != nil {
+		return err
+	}
+
+	patternsMutex.Lock()
+	defer patternsMutex.Unlock()
+
+	if _, exists := handshakePatterns[name]; exists {
+		return oops.
+			Code("PATTERN_EXISTS").
+			In("noise").
+			With("pattern", name).
+			Wrapf(ErrInvalidConfig, "handshake pattern %s is already registered", name)
+	}
+	handshakePatterns[name] = pattern
+
+	log.WithField("pattern", name).Debug("Handshake pattern registered")
+	return nil
+}
+
+// validatePatternName checks that name can appear in a protocol name. It must
+// be alphanumeric, start with a letter and not contain a psk modifier.
+func validatePatternName(name string) error {
+	valid := name != "" && unicode.IsLetter(rune(name[0])) && !strings.Contains(name, pskModifierPrefix)
+	for _, r := range name {
+		valid = valid && r < unicode.MaxASCII && (unicode.IsLetter(r) || unicode.IsDigit(r))
+	}
+	if !valid {
+		return oops.
+			Code("INVALID_PATTERN_NAME").
+			In("noise").
+			With("pattern", name).
+			Wrapf(ErrInvalidConfig, "pattern name must be alphanumeric, start with a letter and not contain %q", pskModifierPrefix)
+	}
+	return nil
+}
+
+// parsePatternSpec parses Noise pattern notation into a HandshakePattern and
+// validates it.
+func parsePatternSpec(name, spec string) (noise.HandshakePattern, error) {
+	pattern := noise.HandshakePattern{Name: name}
+
+	var lines []string
+	for _, line := range strings.Split(spec, "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			lines = append(lines, line)
+		}
+	}
+
+	messageLines := lines
+	for i, line := range lines {
+		if line != "..." {
+			continue
+		}
+		if err := parsePreMessages(&pattern, lines[:i]); err != nil {
+			return pattern, err
+		}
+		messageLines = lines[i+1:]
+		break
+	}
+
+	if len(messageLines) == 0 {
+		return pattern, invalidPatternSpec(name, "pattern has no handshake messages")
+	}
+	for i, line := range messageLines {
+		arrow := "->"
+		if i%2 == 1 {
+			arrow = "<-"
+		}
+		tokens, err := parsePatternLine(name, line, arrow)
+		if err != nil {
+			return pattern, err
+		}
+		pattern.Messages = append(pattern.Messages, tokens)
+	}
+
+	return pattern, checkPatternValidity(pattern)
+}
+
+// parsePreMessages parses the lines before "...". The initiator's pre-message
+// comes first; each may be "e", "s" or "e, s".
+func parsePreMessages(pattern *noise.HandshakePattern, lines []string) error {
+	if len(lines) == 0 || len(lines) > 2 {
+		return invalidPatternSpec(pattern.Name, "expected one or two pre-message lines before \"...\"")
+	}
+	for i, line := range lines {
+		arrow := "<-"
+		if i == 0 && (len(lines) == 2 || strings.HasPrefix(line, "->")) {
+			arrow = "->"
+		}
+		tokens, err := parsePatternLine(pattern.Name, line, arrow)
+		if err != nil {
+			return err
+		}
+		if !isValidPreMessage(tokens) {
+			return invalidPatternSpec(pattern.Name, "pre-messages may only be \"e\", \"s\" or \"e, s\"")
+		}
+		if arrow == "->" {
+			pattern.InitiatorPreMessages = tokens
+		} else {
+			pattern.ResponderPreMessages = tokens
+		}
+	}
+	return nil
+}
+
+// isValidPreMessage reports whether tokens are "e", "s" or "e, s".
+func isValidPreMessage(tokens []noise.MessagePattern) bool {
+	switch len(tokens) {
+	case 1:
+		return tokens[0] == noise.MessagePatternE || tokens[0] == noise.MessagePatternS
+	case 2:
+		return tokens[0] == noise.MessagePatternE && tokens[1] == noise.MessagePatternS
+	default:
+		return false
+	}
+}
+
+// parsePatternLine parses one "-> e, ee" line, which must use the given arrow.
+func parsePatternLine(name, line, arrow string) ([]noise.MessagePattern, error) {
+	if !strings.HasPrefix(line, arrow) {
+		return nil, invalidPatternSpec(name, "line %q must start with %q", line, arrow)
+	}
+
+	var tokens []noise.MessagePattern
+	for _, field := range strings.Split(strings.TrimPrefix(line, arrow), ",") {
+		field = strings.TrimSpace(field)
+		token, ok := patternTokens[field]
+		if !ok {
+			if strings.HasPrefix(field, pskModifierPrefix) {
+				return nil, invalidPatternSpec(name, "psk tokens are not supported; use a pskN modifier on the pattern name")
+			}
+			return nil, invalidPatternSpec(name, "unknown token %q in line %q", field, line)
+		}
+		tokens = append(tokens, token)
+	}
+	return tokens, nil
+}
+
+// checkPatternValidity applies the validity rules of section 7.3 of the Noise
+// specification: each key is sent at most once, each DH is performed at most
+// once and only with keys both parties have, and a party that has mixed in a
+// DH with its static key does not encrypt until the matching ephemeral DH is
+// done. That last rule covers the transport messages sent after the
+// handshake as well; the responder of a one-way pattern never sends them.
+func checkPatternValidity(pattern noise.HandshakePattern) error {
+	// sent[initiator][token] records the e and s keys each side has sent.
+	sent := map[bool]map[noise.MessagePattern]bool{true: {}, false: {}}
+	done := map[noise.MessagePattern]bool{}
+
+	for side, pre := range map[bool][]noise.MessagePattern{true: pattern.InitiatorPreMessages, false: pattern.ResponderPreMessages} {
+		for _, token := range pre {
+			sent[side][token] = true
+		}
+	}
+
+	for i, tokens := range pattern.Messages {
+		initiator := i%2 == 0
+		for _, token := range tokens {
+			switch token {
+			case noise.MessagePatternE, noise.MessagePatternS:
+				if sent[initiator][token] {
+					return invalidPatternSpec(pattern.Name, "message %d sends a key that was already sent", i)
+				}
+				sent[initiator][token] = true
+			default:
+				if done[token] {
+					return invalidPatternSpec(pattern.Name, "message %d repeats a DH that was already performed", i)
+				}
+				initiatorKey, responderKey := dhKeys(token)
+				if !sent[true][initiatorKey] || !sent[false][responderKey] {
+					return invalidPatternSpec(pattern.Name, "message %d performs a DH before both keys are known", i)
+				}
+				done[token] = true
+			}
+		}
+
+		if encryptsUnsafely(done, initiator) {
+			return invalidPatternSpec(pattern.Name, "message %d encrypts after a static-key DH without the matching ephemeral DH", i)
+		}
+	}
+
+	oneWay := len(pattern.Messages) == 1
+	for _, initiator := range []bool{true, false} {
+		if initiator || !oneWay {
+			if encryptsUnsafely(done, initiator) {
+				role := "responder"
+				if initiator {
+					role = "initiator"
+				}
+				return invalidPatternSpec(pattern.Name, "%s transport messages would be encrypted after a static-key DH without the matching ephemeral DH", role)
+			}
+		}
+	}
+	return nil
+}
+
+// encryptsUnsafely reports whether a party that has performed the DHs in
+// done may not yet encrypt: se/ss require ee/es from the initiator, and
+// es/ss require ee/se from the responder.
+func encryptsUnsafely(done map[noise.MessagePattern]bool, initiator bool) bool {
+	if initiator {
+		return done[noise.MessagePatternDHSE] && !done[noise.MessagePatternDHEE] ||
+			done[noise.MessagePatternDHSS] && !done[noise.MessagePatternDHES]
+	}
+	return done[noise.MessagePatternDHES] && !done[noise.MessagePatternDHEE] ||
+		done[noise.MessagePatternDHSS] && !done[noise.MessagePatternDHSE]
+}
+
+// dhKeys returns which initiator and responder keys a DH token combines.
+func dhKeys(token noise.MessagePattern) (initiatorKey, responderKey noise.MessagePattern) {
+	switch token {
+	case noise.MessagePatternDHEE:
+		return noise.MessagePatternE, noise.MessagePatternE
+	case noise.MessagePatternDHES:
+		return noise.MessagePatternE, noise.MessagePatternS
+	case noise.MessagePatternDHSE:
+		return noise.MessagePatternS, noise.MessagePatternE
+	default:
+		return noise.MessagePatternS, noise.MessagePatternS
+	}
+}
+
+// invalidPatternSpec builds the error returned for a pattern that cannot be registered.
+func invalidPatternSpec(name, format string, args ...any) error {
+	return oops.
+		Code("INVALID_PATTERN_SPEC").
+		In("noise").
+		With("pattern", name).
+		Wrapf(ErrInvalidConfig, "invalid handshake pattern %s: "+format, append([]any{name}, args...)...)
+}
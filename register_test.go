@@ -0,0 +1,119 @@
+package noise
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-i2p/noise"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// formatPatternSpec writes a pattern in Noise specification notation.
+func formatPatternSpec(pattern noise.HandshakePattern) string {
+	names := map[noise.MessagePattern]string{}
+	for name, token := range patternTokens {
+		names[token] = name
+	}
+	line := func(arrow string, tokens []noise.MessagePattern) string {
+		parts := make([]string, len(tokens))
+		for i, token := range tokens {
+			parts[i] = names[token]
+		}
+		return arrow + " " + strings.Join(parts, ", ")
+	}
+
+	var lines []string
+	if len(pattern.InitiatorPreMessages) > 0 {
+		lines = append(lines, line("->", pattern.InitiatorPreMessages))
+	}
+	if len(pattern.ResponderPreMessages) > 0 {
+		lines = append(lines, line("<-", pattern.ResponderPreMessages))
+	}
+	if len(lines) > 0 {
+		lines = append(lines, "...")
+	}
+	for i, tokens := range pattern.Messages {
+		arrow := "->"
+		if i%2 == 1 {
+			arrow = "<-"
+		}
+		lines = append(lines, line(arrow, tokens))
+	}
+	return strings.Join(lines, "\n")
+}
+
+func TestParsePatternSpecAcceptsKnownPatterns(t *testing.T) {
+	for name, pattern := range handshakePatterns {
+		parsed, err := parsePatternSpec(name, formatPatternSpec(pattern))
+		require.NoError(t, err, name)
+		assert.Equal(t, pattern.Messages, parsed.Messages, name)
+		assert.Equal(t, len(pattern.InitiatorPreMessages), len(parsed.InitiatorPreMessages), name)
+		assert.Equal(t, len(pattern.ResponderPreMessages), len(parsed.ResponderPreMessages), name)
+	}
+}
+
+func TestParsePatternSpecRejectsInvalidPatterns(t *testing.T) {
+	tests := map[string]string{
+		"empty":               "",
+		"starts with <-":      "<- e",
+		"arrows out of turn":  "-> e\n-> e, ee",
+		"unknown token":       "-> e\n<- e, xx",
+		"psk token":           "-> psk, e\n<- e, ee",
+		"key sent twice":      "-> e\n<- e, ee\n-> e",
+		"static pre-sent":     "<- s\n...\n-> e, es\n<- s",
+		"repeated DH":         "-> e\n<- e, ee\n-> ee",
+		"DH without key":      "-> e, es\n<- e, ee",
+		"se without ee":       "<- e\n...\n-> s, se",
+		"ss without se":       "-> s\n<- s\n...\n-> e, ss\n<- e",
+		"bad pre-message":     "<- ee\n...\n-> e",
+		"two pre-messages":    "<- s\n<- e\n...\n-> e",
+		"no messages":         "<- s\n...",
+		"repeated pre-key":    "<- s, s\n...\n-> e",
+		"long pre-message":    "<- e, s, s\n...\n-> e",
+		"pre-message order":   "<- s, e\n...\n-> e",
+		"initiator transport": "-> s\n...\n-> e\n<- e, se",
+		"responder transport": "<- s\n...\n-> e\n<- e\n-> es",
+	}
+	for name, spec := range tests {
+		t.Run(name, func(t *testing.T) {
+			_, err := parsePatternSpec("Custom", spec)
+			requireErrorCode(t, err, "INVALID_PATTERN_SPEC")
+		})
+	}
+}
+
+func TestRegisterPatternNames(t *testing.T) {
+	requireErrorCode(t, RegisterPattern("XX", "-> e\n<- e, ee"), "PATTERN_EXISTS")
+	for _, name := range []string{"", "1X", "My_Pattern", "XXpsk", "X-1"} {
+		requireErrorCode(t, RegisterPattern(name, "-> e\n<- e, ee"), "INVALID_PATTERN_NAME")
+	}
+}
+
+func TestRegisteredPatternHandshake(t *testing.T) {
+	// NK with the responder's authentication delayed to a third message.
+	spec := `
+		<- s
+		...
+		-> e
+		<- e, ee
+		-> es
+	`
+	require.NoError(t, RegisterPattern("TestNK2", spec))
+	requireErrorCode(t, RegisterPattern("TestNK2", spec), "PATTERN_EXISTS")
+
+	responderPrivate, responderPublic := newTestKeyPair(t)
+	name := "Noise_TestNK2_25519_ChaChaPoly_SHA256"
+	initiatorConfig := NewConnConfig(name, true).
+		WithRemoteKey(responderPublic).
+		WithHandshakeTimeout(5 * time.Second)
+	responderConfig := NewConnConfig(name, false).
+		WithStaticKey(responderPrivate).
+		WithHandshakeTimeout(5 * time.Second)
+	require.NoError(t, NewListenerConfig(name).WithStaticKey(responderPrivate).Validate())
+
+	initiator, responder := establishPair(t, initiatorConfig, responderConfig)
+	assert.Equal(t, name, initiator.Snapshot().Protocol)
+	sendMessages(t, initiator, responder, []string{"custom"}, 0)
+}
@@ -0,0 +1,172 @@
+package noise
+
+import (
+	"math"
+	"time"
+
+	"github.com/samber/oops"
+	"github.com/sirupsen/logrus"
+)
+
+// maxTransportNonce is the nonce 2^64-1, which the Noise specification
+// reserves: a transport cipher uses nonces up to 2^64-2 and refuses this one.
+// REKEY does not reset the nonce, so a connection that reaches it must be
+// re-established.
+const maxTransportNonce = math.MaxUint64
+
+// RekeyPolicy triggers automatic rekeying of the send cipher state.
+// A rekey happens before the next message once any enabled threshold is
+// reached. Zero fields are disabled; the zero value never rekeys.
+type RekeyPolicy struct {
+	// Messages is the number of transport messages sent before rekeying
+	Messages uint64
+
+	// Bytes is the number of plaintext bytes sent before rekeying
+	Bytes uint64
+
+	// Interval is the time after which the next write rekeys
+	Interval time.Duration
+}
+
+// rekeyState tracks traffic sent under the current send key.
+type rekeyState struct {
+	messages  uint64
+	bytes     uint64
+	since     time.Time
+	sendCount uint64
+}
+
+// reset starts counting traffic for a fresh send key.
+func (rs *rekeyState) reset() {
+	rs.messages = 0
+	rs.bytes = 0
+	rs.since = time.Now()
+}
+
+// recordSent accounts for one transport message carrying n plaintext bytes.
+func (rs *rekeyState) recordSent(n int) {
+	rs.messages++
+	rs.bytes += uint64(n)
+}
+
+// due reports whether the policy requires a rekey before the next message.
+func (rs *rekeyState) due(policy RekeyPolicy) bool {
+	if policy.Messages > 0 && rs.messages >= policy.Messages {
+		return true
+	}
+	if policy.Bytes > 0 && rs.bytes >= policy.Bytes {
+		return true
+	}
+	return policy.Interval > 0 && time.Since(rs.since) >= policy.Interval
+}
+
+// Rekey applies the Noise REKEY() function to the send cipher state and
+// signals the peer, which applies REKEY() to its receive cipher state when
+// it reads the signal. Each direction is rekeyed by its sender, so both
+// peers may call Rekey independently. The signal requires MessageTypes.
+func (nc *NoiseConn) Rekey() error {
+	if !nc.config.MessageTypes {
+		return messageTypesRequired("rekey")
+	}
+
+	nc.writeMutex.Lock()
+	defer nc.writeMutex.Unlock()
+
+	if err := nc.validateWriteState(); err != nil {
+		return err
+	}
+
+	if err := nc.configureWriteTimeout(); err != nil {
+		return err
+	}
+
+	return nc.rekeySend()
+}
+
+// rekeyIfDue rekeys the send cipher if the configured policy requires it.
+func (nc *NoiseConn) rekeyIfDue() error {
+	if !nc.rekey.due(nc.config.RekeyPolicy) {
+		return nil
+	}
+	return nc.rekeySend()
+}
+
+// rekeySend sends a rekey signal under the current key and then rekeys the
+// send cipher. The caller must hold writeMutex.
+func (nc *NoiseConn) rekeySend() error {
+	encrypted, err := nc.encryptData([]byte{msgTypeRekey})
+	if err != nil {
+		return err
+	}
+
+	if err := writeFrame(nc.underlying, encrypted); err != nil {
+		return oops.
+			Code("REKEY_SIGNAL_FAILED").
+			In("noise").
+			With("remote_addr", nc.RemoteAddr().String()).
+			Wrapf(err, "failed to send rekey signal")
+	}
+
+	nc.sendCipher.Rekey()
+	nc.rekey.reset()
+	nc.rekey.sendCount++
+
+	nc.logger.WithFields(logrus.Fields{
+		"send_rekeys": nc.rekey.sendCount,
+		"nonce":       nc.sendCipher.Nonce(),
+	}).Debug("Send cipher rekeyed")
+
+	return nil
+}
+
+// handleTransportMessage interprets a decrypted transport message and returns
+// the application data it carries, if any. Keepalives and control messages
+// return nil; a data message returns a non-nil slice, even when empty.
+// Without MessageTypes every message is data. The caller must hold readMutex.
+func (nc *NoiseConn) handleTransportMessage(plaintext []byte) ([]byte, error) {
+	if !nc.config.MessageTypes {
+		if plaintext == nil {
+			plaintext = []byte{}
+		}
+		return plaintext, nil
+	}
+
+	if len(plaintext) == 0 {
+		nc.metrics.AddKeepaliveReceived()
+		return nil, nil
+	}
+
+	switch plaintext[0] {
+	case msgTypeData:
+		return plaintext[1:], nil
+	case msgTypeEOF:
+		nc.eofReceived = true
+		nc.logger.Debug("Peer closed its write side")
+		return nil, nil
+	case msgTypeClose:
+		return nil, nc.receiveClose(plaintext[1:])
+	case msgTypeRekey:
+		nc.recvCipher.Rekey()
+		nc.recvRekeys++
+		nc.logger.WithFields(logrus.Fields{
+			"recv_rekeys": nc.recvRekeys,
+		}).Debug("Receive cipher rekeyed")
+		return nil, nil
+	default:
+		return nil, oops.
+			Code("UNKNOWN_MESSAGE_TYPE").
+			In("noise").
+			With("message_type", plaintext[0]).
+			Wrapf(ErrProtocolViolation, "unknown transport message type")
+	}
+}
+
+// nonceExhaustedError reports that a cipher state reached the nonce limit.
+func nonceExhaustedError(direction string, nonce uint64) error {
+	return oops.
+		Code("NONCE_EXHAUSTED").
+		In("noise").
+		With("direction", direction).
+		With("nonce", nonce).
+		Wrapf(ErrNonceExhausted, "%s cipher reached the nonce limit; a new handshake is required", direction)
+}
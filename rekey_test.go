@@ -0,0 +1,200 @@
+package noise
+
+import (
+	"fmt"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/samber/oops"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// sendMessages writes each message from a goroutine and reads them back on the peer.
+func sendMessages(t *testing.T, writer, reader *NoiseConn, messages []string, pause time.Duration) {
+	t.Helper()
+
+	errs := make(chan error, 1)
+	go func() {
+		for _, msg := range messages {
+			if _, err := writer.Write([]byte(msg)); err != nil {
+				errs <- err
+				return
+			}
+			time.Sleep(pause)
+		}
+		errs <- nil
+	}()
+
+	for _, msg := range messages {
+		buf := make([]byte, len(msg))
+		_, err := io.ReadFull(reader, buf)
+		require.NoError(t, err)
+		assert.Equal(t, msg, string(buf))
+	}
+	require.NoError(t, <-errs)
+}
+
+func numberedMessages(n, size int) []string {
+	messages := make([]string, n)
+	for i := range messages {
+		messages[i] = fmt.Sprintf("%0*d", size, i)
+	}
+	return messages
+}
+
+func TestManualRekeyBothDirections(t *testing.T) {
+	initiator, responder := establishPair(t, NewConnConfig("NN", true).WithMessageTypes(true), NewConnConfig("NN", false).WithMessageTypes(true))
+
+	sendMessages(t, initiator, responder, []string{"before"}, 0)
+	rekeyThenSend(t, initiator, responder, "after")
+	assert.Equal(t, uint64(1), initiator.rekey.sendCount)
+	assert.Equal(t, uint64(1), responder.recvRekeys)
+
+	rekeyThenSend(t, responder, initiator, "reply")
+	assert.Equal(t, uint64(1), responder.rekey.sendCount)
+	assert.Equal(t, uint64(1), initiator.recvRekeys)
+}
+
+// rekeyThenSend rekeys writer and sends msg; the reader consumes the rekey
+// signal as part of reading msg.
+func rekeyThenSend(t *testing.T, writer, reader *NoiseConn, msg string) {
+	t.Helper()
+
+	errs := make(chan error, 1)
+	go func() {
+		if err := writer.Rekey(); err != nil {
+			errs <- err
+			return
+		}
+		_, err := writer.Write([]byte(msg))
+		errs <- err
+	}()
+
+	buf := make([]byte, len(msg))
+	_, err := io.ReadFull(reader, buf)
+	require.NoError(t, err)
+	assert.Equal(t, msg, string(buf))
+	require.NoError(t, <-errs)
+}
+
+func TestRekeyPolicyByMessageCount(t *testing.T) {
+	initiatorConfig := NewConnConfig("NN", true).WithMessageTypes(true).WithRekeyPolicy(RekeyPolicy{Messages: 3})
+	initiator, responder := establishPair(t, initiatorConfig, NewConnConfig("NN", false).WithMessageTypes(true))
+
+	sendMessages(t, initiator, responder, numberedMessages(10, 4), 0)
+
+	// Rekeys happen before messages 4, 7 and 10.
+	assert.Equal(t, uint64(3), initiator.rekey.sendCount)
+	assert.Equal(t, uint64(3), responder.recvRekeys)
+}
+
+func TestRekeyPolicyByBytes(t *testing.T) {
+	initiatorConfig := NewConnConfig("NN", true).WithMessageTypes(true).WithRekeyPolicy(RekeyPolicy{Bytes: 100})
+	initiator, responder := establishPair(t, initiatorConfig, NewConnConfig("NN", false).WithMessageTypes(true))
+
+	sendMessages(t, initiator, responder, numberedMessages(5, 40), 0)
+
+	assert.Equal(t, uint64(1), initiator.rekey.sendCount)
+	assert.Equal(t, uint64(1), responder.recvRekeys)
+}
+
+func TestRekeyPolicyByInterval(t *testing.T) {
+	initiatorConfig := NewConnConfig("NN", true).WithMessageTypes(true).WithRekeyPolicy(RekeyPolicy{Interval: 20 * time.Millisecond})
+	initiator, responder := establishPair(t, initiatorConfig, NewConnConfig("NN", false).WithMessageTypes(true))
+
+	sendMessages(t, initiator, responder, []string{"first", "second"}, 40*time.Millisecond)
+
+	assert.GreaterOrEqual(t, initiator.rekey.sendCount, uint64(1))
+	assert.Equal(t, initiator.rekey.sendCount, responder.recvRekeys)
+}
+
+func TestRekeyWithoutSignalDesynchronizes(t *testing.T) {
+	initiator, responder := establishPair(t, NewConnConfig("NN", true).WithMessageTypes(true), NewConnConfig("NN", false).WithMessageTypes(true))
+
+	initiator.sendCipher.Rekey()
+	go func() { _, _ = initiator.Write([]byte("lost")) }()
+
+	_, err := responder.Read(make([]byte, 8))
+	assert.Error(t, err, "a rekey the peer was not told about must break decryption")
+}
+
+func TestNonceLimitIsEnforced(t *testing.T) {
+	initiator, responder := establishPair(t, NewConnConfig("NN", true).WithMessageTypes(true), NewConnConfig("NN", false).WithMessageTypes(true))
+
+	initiator.sendCipher.SetNonce(maxTransportNonce)
+	_, err := initiator.Write([]byte("too late"))
+	requireErrorCode(t, err, "NONCE_EXHAUSTED")
+	requireErrorCode(t, initiator.Rekey(), "NONCE_EXHAUSTED")
+
+	// Likewise, a receive nonce that has reached the reserved value refuses
+	// to decrypt, whatever nonce the peer used.
+	responder.sendCipher.SetNonce(maxTransportNonce - 1)
+	initiator.recvCipher.SetNonce(maxTransportNonce)
+
+	go func() { _, _ = responder.Write([]byte("over")) }()
+	_, err = initiator.Read(make([]byte, 8))
+	requireErrorCode(t, err, "NONCE_EXHAUSTED")
+}
+
+func TestUnknownTransportMessageType(t *testing.T) {
+	initiator, responder := establishPair(t, NewConnConfig("NN", true).WithMessageTypes(true), NewConnConfig("NN", false).WithMessageTypes(true))
+
+	go func() {
+		encrypted, err := initiator.encryptData([]byte{0x7F, 'x'})
+		if err == nil {
+			_ = writeFrame(initiator.underlying, encrypted)
+		}
+	}()
+
+	_, err := responder.Read(make([]byte, 8))
+	requireErrorCode(t, err, "UNKNOWN_MESSAGE_TYPE")
+}
+
+func TestRekeyPolicyValidation(t *testing.T) {
+	err := NewConnConfig("NN", true).WithMessageTypes(true).WithRekeyPolicy(RekeyPolicy{Interval: -time.Second}).Validate()
+	requireErrorCode(t, err, "INVALID_REKEY_POLICY")
+
+	assert.NoError(t, NewConnConfig("NN", true).WithMessageTypes(true).WithRekeyPolicy(RekeyPolicy{Messages: 1}).Validate())
+
+	err = NewConnConfig("NN", true).WithRekeyPolicy(RekeyPolicy{Messages: 1}).Validate()
+	requireErrorCode(t, err, "MESSAGE_TYPES_REQUIRED")
+	assert.ErrorIs(t, err, ErrInvalidConfig)
+	err = NewListenerConfig("NN").WithRekeyPolicy(RekeyPolicy{Messages: 1}).Validate()
+	requireErrorCode(t, err, "MESSAGE_TYPES_REQUIRED")
+}
+
+func TestRekeyRequiresMessageTypes(t *testing.T) {
+	initiator, responder := establishPair(t, NewConnConfig("NN", true), NewConnConfig("NN", false))
+	defer initiator.Close()
+	defer responder.Close()
+
+	requireErrorCode(t, initiator.Rekey(), "MESSAGE_TYPES_REQUIRED")
+	sendMessages(t, initiator, responder, []string{"keys unchanged"}, 0)
+}
+
+// requireErrorCode asserts that err is an oops error with the given code.
+func requireErrorCode(t *testing.T, err error, code string) {
+	t.Helper()
+	require.Error(t, err)
+	oopsErr, ok := oops.AsOops(err)
+	require.True(t, ok, "expected an oops error, got %v", err)
+	assert.Equal(t, code, oopsErr.Code())
+}
+
+func TestLastNonceBeforeReservedIsUsable(t *testing.T) {
+	initiator, responder := establishPair(t, NewConnConfig("NN", true).WithMessageTypes(true), NewConnConfig("NN", false).WithMessageTypes(true))
+
+	initiator.sendCipher.SetNonce(maxTransportNonce - 1)
+	responder.recvCipher.SetNonce(maxTransportNonce - 1)
+
+	go func() { _, _ = initiator.Write([]byte("last")) }()
+	buf := make([]byte, 8)
+	n, err := responder.Read(buf)
+	require.NoError(t, err, "nonce 2^64-2 must still be accepted")
+	assert.Equal(t, "last", string(buf[:n]))
+
+	_, err = initiator.Write([]byte("one more"))
+	requireErrorCode(t, err, "NONCE_EXHAUSTED")
+}
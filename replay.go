@@ -0,0 +1,54 @@
+package noise
+
+// replayWindowSize is how many nonces behind the highest one seen a datagram
+// may arrive and still be accepted. It must be a multiple of 64.
+const replayWindowSize = 1024
+
+// replayWindow is a sliding-window replay filter for explicit transport
+// nonces, in the style of RFC 6479. Nonces are tracked in a circular bitmap
+// indexed by nonce modulo the window size.
+type replayWindow struct {
+	// top is one more than the highest nonce accepted, or 0 if none has been
+	top uint64
+
+	// bitmap marks accepted nonces in [top-replayWindowSize, top)
+	bitmap [replayWindowSize / 64]uint64
+}
+
+// check reports whether nonce n is new and not too old to track.
+func (w *replayWindow) check(n uint64) bool {
+	if n >= maxTransportNonce {
+		return false
+	}
+	if n >= w.top {
+		return true
+	}
+	if w.top-n > replayWindowSize {
+		return false
+	}
+	return w.bitmap[(n/64)%uint64(len(w.bitmap))]&(1<<(n%64)) == 0
+}
+
+// accept records nonce n, sliding the window forward if needed.
+// It returns false, and changes nothing, if check(n) would.
+func (w *replayWindow) accept(n uint64) bool {
+	if !w.check(n) {
+		return false
+	}
+
+	if n >= w.top {
+		// Slots for nonces in [top, n] still hold nonces that are now
+		// out of the window, so clear them before moving the window.
+		if n-w.top >= replayWindowSize {
+			w.bitmap = [replayWindowSize / 64]uint64{}
+		} else {
+			for i := w.top; i <= n; i++ {
+				w.bitmap[(i/64)%uint64(len(w.bitmap))] &^= 1 << (i % 64)
+			}
+		}
+		w.top = n + 1
+	}
+
+	w.bitmap[(n/64)%uint64(len(w.bitmap))] |= 1 << (n % 64)
+	return true
+}
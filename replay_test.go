@@ -0,0 +1,58 @@
+package noise
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReplayWindowRejectsDuplicates(t *testing.T) {
+	var w replayWindow
+
+	assert.True(t, w.accept(0))
+	assert.False(t, w.accept(0), "nonce 0 replayed")
+	assert.True(t, w.accept(5))
+	assert.True(t, w.accept(3), "out of order within the window")
+	assert.False(t, w.accept(3))
+	assert.False(t, w.accept(5))
+	assert.True(t, w.accept(4))
+	assert.True(t, w.accept(1))
+}
+
+func TestReplayWindowSlides(t *testing.T) {
+	var w replayWindow
+
+	assert.True(t, w.accept(10))
+	assert.True(t, w.accept(10+replayWindowSize-1))
+	assert.False(t, w.check(10), "still inside the window and already seen")
+
+	assert.True(t, w.accept(10+replayWindowSize))
+	assert.False(t, w.check(10), "slid out of the window")
+	assert.False(t, w.check(9))
+	assert.True(t, w.check(11), "oldest nonce still in the window")
+
+	// A nonce whose slot is reused after sliding must not look replayed.
+	assert.True(t, w.accept(11+replayWindowSize))
+	assert.True(t, w.accept(12+replayWindowSize))
+}
+
+func TestReplayWindowLargeJump(t *testing.T) {
+	var w replayWindow
+
+	for n := uint64(0); n < 100; n++ {
+		assert.True(t, w.accept(n))
+	}
+	assert.True(t, w.accept(1_000_000))
+	assert.False(t, w.check(99))
+	assert.True(t, w.accept(1_000_000-1))
+	assert.True(t, w.accept(1_000_000-replayWindowSize+1))
+	assert.False(t, w.accept(1_000_000))
+}
+
+func TestReplayWindowRejectsReservedNonce(t *testing.T) {
+	var w replayWindow
+
+	assert.False(t, w.accept(maxTransportNonce))
+	assert.True(t, w.accept(maxTransportNonce-1), "2^64-2 is the last usable nonce")
+	assert.False(t, w.accept(maxTransportNonce-1))
+}
@@ -67,6 +67,12 @@ func (nc *NoiseConn) shouldRetry(attempt, maxRetries int, err error) bool {
 		return false
 	}
 
+	// A failure after handshake messages were exchanged leaves the peer's
+	// transcript out of step with ours, so another attempt cannot succeed
+	if nc.handshakeDesynced {
+		return false
+	}
+
 	// Check if the connection is in a retriable state
 	// Only retry from Init state (handshake sets state back to Init on failure)
 	return nc.getState() == internal.StateInit
@@ -122,5 +128,5 @@ func (nc *NoiseConn) wrapRetryError(err error, totalAttempts int) error {
 		With("pattern", nc.config.Pattern).
 		With("local_addr", nc.LocalAddr().String()).
 		With("remote_addr", nc.RemoteAddr().String()).
-		Wrapf(err, "handshake failed after %d attempts", totalAttempts)
+		Wrapf(internal.Mark(err, ErrHandshakeFailed), "handshake failed after %d attempts", totalAttempts)
 }
@@ -265,7 +265,7 @@ func (sm *ShutdownManager) waitForConnectionsDrain() error {
 				In("shutdown").
 				With("remaining_connections", remaining).
 				With("timeout", sm.shutdownTimeout.String()).
-				Errorf("timeout waiting for connections to drain")
+				Wrapf(ErrShutdownTimeout, "timeout waiting for connections to drain")
 
 		case <-ticker.C:
 			sm.mu.RLock()
@@ -282,7 +282,10 @@ func (sm *ShutdownManager) waitForConnectionsDrain() error {
 	}
 }
 
-// forceCloseConnections forcefully closes all remaining connections.
+// forceCloseConnections forcefully closes all remaining connections, telling
+// each peer that the node is shutting down. The close messages are sent in
+// parallel and share one closeMessageTimeout budget; connections whose peer
+// has not taken the message by then are closed without it.
 func (sm *ShutdownManager) forceCloseConnections() error {
 	sm.mu.RLock()
 	connections := make([]*NoiseConn, 0, len(sm.connections))
@@ -291,15 +294,40 @@ func (sm *ShutdownManager) forceCloseConnections() error {
 	}
 	sm.mu.RUnlock()
 
-	var firstError error
+	type closeResult struct {
+		conn *NoiseConn
+		err  error
+	}
+	results := make(chan closeResult, len(connections))
 	for _, conn := range connections {
-		if err := conn.Close(); err != nil {
-			sm.logger.WithError(err).WithFields(logrus.Fields{
-				"local_addr":  conn.LocalAddr().String(),
-				"remote_addr": conn.RemoteAddr().String(),
-			}).Error("error force closing connection during shutdown")
-			if firstError == nil {
-				firstError = err
+		go func(conn *NoiseConn) {
+			results <- closeResult{conn, conn.CloseWithReason(CloseShutdown, "node is shutting down")}
+		}(conn)
+	}
+
+	budget := time.NewTimer(closeMessageTimeout)
+	defer budget.Stop()
+
+	var firstError error
+	for pending := len(connections); pending > 0; {
+		select {
+		case result := <-results:
+			pending--
+			if result.err != nil {
+				sm.logger.WithError(result.err).WithFields(logrus.Fields{
+					"local_addr":  result.conn.LocalAddr().String(),
+					"remote_addr": result.conn.RemoteAddr().String(),
+				}).Error("error force closing connection during shutdown")
+				if firstError == nil {
+					firstError = result.err
+				}
+			}
+		case <-budget.C:
+			// Closing the underlying connections unblocks the stalled writes.
+			sm.logger.WithField("remaining_connections", pending).
+				Warn("close messages not sent in time, closing connections without them")
+			for _, conn := range connections {
+				_ = conn.Close()
 			}
 		}
 	}
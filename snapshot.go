@@ -0,0 +1,68 @@
+package noise
+
+import (
+	"net"
+	"time"
+
+	"github.com/go-i2p/go-noise/internal"
+)
+
+// ConnSnapshot is a point-in-time view of a NoiseConn's session and statistics.
+type ConnSnapshot struct {
+	// State is the connection lifecycle state
+	State internal.ConnState
+	// Protocol is the full Noise protocol name, e.g. "Noise_XX_25519_AESGCM_SHA256"
+	Protocol string
+	// Initiator reports whether this side initiated the handshake
+	Initiator bool
+	// LocalAddr and RemoteAddr are the Noise addresses of both ends
+	LocalAddr  net.Addr
+	RemoteAddr net.Addr
+	// PeerStatic is the peer's static public key, or nil if not known
+	PeerStatic []byte
+	// HandshakeHash is the channel binding value, or nil before the handshake completes
+	HandshakeHash []byte
+	// HandshakePath reports whether Noise Pipes fell back to XXfallback
+	HandshakePath HandshakePath
+	// BytesRead and BytesWritten count application plaintext
+	BytesRead    int64
+	BytesWritten int64
+	// HandshakeDuration is how long the handshake took
+	HandshakeDuration time.Duration
+	// KeepalivesSent and KeepalivesReceived count empty keepalive messages
+	KeepalivesSent     int64
+	KeepalivesReceived int64
+}
+
+// Snapshot returns a copy of the connection's session details and statistics.
+func (nc *NoiseConn) Snapshot() ConnSnapshot {
+	bytesRead, bytesWritten, handshakeDuration := nc.metrics.GetStats()
+	keepalivesSent, keepalivesReceived := nc.metrics.GetKeepaliveStats()
+
+	nc.stateMutex.RLock()
+	defer nc.stateMutex.RUnlock()
+
+	return ConnSnapshot{
+		State:              nc.state,
+		Protocol:           nc.localAddr.Pattern(),
+		Initiator:          nc.config.Initiator,
+		LocalAddr:          nc.localAddr,
+		RemoteAddr:         nc.remoteAddr,
+		PeerStatic:         cloneBytes(nc.peerStatic),
+		HandshakeHash:      cloneBytes(nc.handshakeHash),
+		HandshakePath:      nc.handshakePath,
+		BytesRead:          bytesRead,
+		BytesWritten:       bytesWritten,
+		HandshakeDuration:  handshakeDuration,
+		KeepalivesSent:     keepalivesSent,
+		KeepalivesReceived: keepalivesReceived,
+	}
+}
+
+// cloneBytes returns a copy of b, or nil if b is empty.
+func cloneBytes(b []byte) []byte {
+	if len(b) == 0 {
+		return nil
+	}
+	return append([]byte(nil), b...)
+}
@@ -0,0 +1,66 @@
+package noise
+
+import (
+	"bytes"
+	"net"
+	"testing"
+
+	"github.com/go-i2p/go-noise/internal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHandshakeHashMatchesOnBothEnds(t *testing.T) {
+	for _, pattern := range []string{"NN", "XX", "Noise_XX_25519_ChaChaPoly_BLAKE2b"} {
+		t.Run(pattern, func(t *testing.T) {
+			initiatorConfig := NewConnConfig(pattern, true).WithStaticKey(newTestStaticKey(t))
+			responderConfig := NewConnConfig(pattern, false).WithStaticKey(newTestStaticKey(t))
+
+			initiator, responder := establishPair(t, initiatorConfig, responderConfig)
+
+			hash := initiator.HandshakeHash()
+			require.NotEmpty(t, hash)
+			assert.Equal(t, hash, responder.HandshakeHash())
+		})
+	}
+}
+
+func TestHandshakeHashDiffersBetweenSessions(t *testing.T) {
+	first, _ := establishPair(t, NewConnConfig("NN", true), NewConnConfig("NN", false))
+	second, _ := establishPair(t, NewConnConfig("NN", true), NewConnConfig("NN", false))
+
+	assert.False(t, bytes.Equal(first.HandshakeHash(), second.HandshakeHash()),
+		"fresh ephemeral keys must give each session its own hash")
+}
+
+func TestHandshakeHashBeforeHandshake(t *testing.T) {
+	conn, _ := net.Pipe()
+	defer conn.Close()
+
+	initiator, err := NewNoiseConn(conn, NewConnConfig("NN", true))
+	require.NoError(t, err)
+	assert.Nil(t, initiator.HandshakeHash())
+	assert.Nil(t, initiator.Snapshot().HandshakeHash)
+}
+
+func TestConnSnapshot(t *testing.T) {
+	initiatorPrivate, initiatorPublic := newTestKeyPair(t)
+	initiatorConfig := NewConnConfig("XX", true).WithStaticKey(initiatorPrivate)
+	responderConfig := NewConnConfig("XX", false).WithStaticKey(newTestStaticKey(t))
+
+	initiator, responder := establishPair(t, initiatorConfig, responderConfig)
+	sendMessages(t, initiator, responder, []string{"snapshot"}, 0)
+
+	snap := responder.Snapshot()
+	assert.Equal(t, internal.StateEstablished, snap.State)
+	assert.Equal(t, "Noise_XX_25519_AESGCM_SHA256", snap.Protocol)
+	assert.False(t, snap.Initiator)
+	assert.Equal(t, initiatorPublic, snap.PeerStatic)
+	assert.Equal(t, initiator.HandshakeHash(), snap.HandshakeHash)
+	assert.Equal(t, int64(len("snapshot")), snap.BytesRead)
+	assert.Equal(t, responder.RemoteAddr(), snap.RemoteAddr)
+
+	// Snapshots are copies and do not alias connection state.
+	snap.HandshakeHash[0] ^= 0xFF
+	assert.Equal(t, initiator.HandshakeHash(), responder.HandshakeHash())
+}
@@ -5,6 +5,7 @@ import (
 	"net"
 	"time"
 
+	"github.com/go-i2p/go-noise/internal"
 	"github.com/go-i2p/go-noise/pool"
 	"github.com/samber/oops"
 )
@@ -154,19 +155,19 @@ func validateDialParams(network, addr string, config *ConnConfig) error {
 	if network == "" {
 		return oops.
 			Code("INVALID_NETWORK").
-			Errorf("network cannot be empty")
+			Wrapf(ErrInvalidConfig, "network cannot be empty")
 	}
 
 	if addr == "" {
 		return oops.
 			Code("INVALID_ADDRESS").
-			Errorf("address cannot be empty")
+			Wrapf(ErrInvalidConfig, "address cannot be empty")
 	}
 
 	if config == nil {
 		return oops.
 			Code("INVALID_CONFIG").
-			Errorf("config cannot be nil")
+			Wrapf(ErrInvalidConfig, "config cannot be nil")
 	}
 
 	return config.Validate()
@@ -177,19 +178,19 @@ func validateListenParams(network, addr string, config *ListenerConfig) error {
 	if network == "" {
 		return oops.
 			Code("INVALID_NETWORK").
-			Errorf("network cannot be empty")
+			Wrapf(ErrInvalidConfig, "network cannot be empty")
 	}
 
 	if addr == "" {
 		return oops.
 			Code("INVALID_ADDRESS").
-			Errorf("address cannot be empty")
+			Wrapf(ErrInvalidConfig, "address cannot be empty")
 	}
 
 	if config == nil {
 		return oops.
 			Code("INVALID_CONFIG").
-			Errorf("config cannot be nil")
+			Wrapf(ErrInvalidConfig, "config cannot be nil")
 	}
 
 	return config.Validate()
@@ -332,7 +333,7 @@ func createAndHandshakeConn(ctx context.Context, conn net.Conn, config *ConnConf
 			In("transport").
 			With("network", network).
 			With("address", addr).
-			Wrapf(err, "handshake failed")
+			Wrapf(internal.Mark(err, ErrHandshakeFailed), "handshake failed")
 	}
 
 	return noiseConn, nil
@@ -0,0 +1,337 @@
+package noise
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-i2p/noise"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testVector is one entry of a vector file.
+type testVector struct {
+	ProtocolName     string          `json:"protocol_name"`
+	InitPrologue     hexBytes        `json:"init_prologue"`
+	InitPsks         []hexBytes      `json:"init_psks"`
+	InitStatic       hexBytes        `json:"init_static"`
+	InitEphemeral    hexBytes        `json:"init_ephemeral"`
+	InitRemoteStatic hexBytes        `json:"init_remote_static"`
+	RespPrologue     hexBytes        `json:"resp_prologue"`
+	RespPsks         []hexBytes      `json:"resp_psks"`
+	RespStatic       hexBytes        `json:"resp_static"`
+	RespEphemeral    hexBytes        `json:"resp_ephemeral"`
+	RespRemoteStatic hexBytes        `json:"resp_remote_static"`
+	HandshakeHash    hexBytes        `json:"handshake_hash"`
+	Messages         []vectorMessage `json:"messages"`
+
+	// transportRestarts is set for flynn/noise vectors, whose transport
+	// messages alternate starting with the initiator once the handshake is
+	// done. Cacophony's continue the handshake's alternation instead.
+	transportRestarts bool
+}
+
+type vectorMessage struct {
+	Payload    hexBytes `json:"payload"`
+	Ciphertext hexBytes `json:"ciphertext"`
+}
+
+// hexBytes decodes a hex-encoded JSON string.
+type hexBytes []byte
+
+func (h *hexBytes) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	}
+	decoded, err := hex.DecodeString(s)
+	*h = decoded
+	return err
+}
+
+// recordingConn keeps a copy of everything written to the wrapped conn.
+type recordingConn struct {
+	net.Conn
+	mu      sync.Mutex
+	written bytes.Buffer
+}
+
+func (rc *recordingConn) Write(b []byte) (int, error) {
+	rc.mu.Lock()
+	rc.written.Write(b)
+	rc.mu.Unlock()
+	return rc.Conn.Write(b)
+}
+
+// frames splits the recorded bytes into length-prefixed frames.
+func (rc *recordingConn) frames() [][]byte {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+
+	var frames [][]byte
+	data := rc.written.Bytes()
+	for len(data) >= frameHeaderLen {
+		n := int(binary.BigEndian.Uint16(data)) + frameHeaderLen
+		frames = append(frames, data[frameHeaderLen:n])
+		data = data[n:]
+	}
+	return frames
+}
+
+// TestConformanceVectors runs every vector file in testdata/vectors. Only
+// flynn/noise vectors are checked in so far. They come from the Noise library
+// this package is built on, so they catch mistakes in how NoiseConn drives
+// it but not in the library's primitives; cacophony or snow vector files
+// dropped into the directory are picked up unchanged and give that check.
+func TestConformanceVectors(t *testing.T) {
+	var files []string
+	for _, pattern := range []string{"*.txt", "*.json"} {
+		matches, err := filepath.Glob(filepath.Join("testdata", "vectors", pattern))
+		require.NoError(t, err)
+		files = append(files, matches...)
+	}
+	require.NotEmpty(t, files)
+
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		require.NoError(t, err)
+		vectors, err := parseVectorFile(data)
+		require.NoError(t, err, file)
+
+		for _, vector := range vectors {
+			t.Run(filepath.Base(file)+"/"+vector.ProtocolName, func(t *testing.T) {
+				runVector(t, vector)
+			})
+		}
+	}
+}
+
+// parseVectorFile reads a cacophony or snow JSON vector file, or a
+// flynn/noise key=value vector file.
+func parseVectorFile(data []byte) ([]testVector, error) {
+	if bytes.HasPrefix(bytes.TrimSpace(data), []byte("{")) {
+		var parsed struct {
+			Vectors []testVector `json:"vectors"`
+		}
+		err := json.Unmarshal(data, &parsed)
+		return parsed.Vectors, err
+	}
+	return parseFlynnVectors(data)
+}
+
+// parseFlynnVectors reads the key=value format of flynn/noise's vectors.txt.
+// Static keys are given as private keys; the side that knows its peer's
+// static key in advance is implied by the pattern's pre-messages.
+func parseFlynnVectors(data []byte) ([]testVector, error) {
+	var vectors []testVector
+	var current *testVector
+	for lineNo, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		key, value, ok := strings.Cut(line, "=")
+		if !ok {
+			return nil, fmt.Errorf("line %d: missing '='", lineNo+1)
+		}
+		if key == "handshake" {
+			vectors = append(vectors, testVector{ProtocolName: value, transportRestarts: true})
+			current = &vectors[len(vectors)-1]
+			continue
+		}
+		if current == nil {
+			return nil, fmt.Errorf("line %d: %s before the first handshake", lineNo+1, key)
+		}
+		decoded, err := hex.DecodeString(value)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", lineNo+1, err)
+		}
+
+		switch key {
+		case "init_static":
+			current.InitStatic = decoded
+		case "resp_static":
+			current.RespStatic = decoded
+		case "gen_init_ephemeral":
+			current.InitEphemeral = decoded
+		case "gen_resp_ephemeral":
+			current.RespEphemeral = decoded
+		case "prologue":
+			current.InitPrologue, current.RespPrologue = decoded, decoded
+		case "preshared_key":
+			current.InitPsks, current.RespPsks = []hexBytes{decoded}, []hexBytes{decoded}
+		default:
+			index, field, ok := parseFlynnMessageKey(key)
+			if !ok {
+				return nil, fmt.Errorf("line %d: unknown key %s", lineNo+1, key)
+			}
+			for len(current.Messages) <= index {
+				current.Messages = append(current.Messages, vectorMessage{})
+			}
+			if field == "payload" {
+				current.Messages[index].Payload = decoded
+			} else {
+				current.Messages[index].Ciphertext = decoded
+			}
+		}
+	}
+
+	for i := range vectors {
+		if err := deriveRemoteStatics(&vectors[i]); err != nil {
+			return nil, err
+		}
+	}
+	return vectors, nil
+}
+
+// parseFlynnMessageKey splits "msg_3_ciphertext" into 3 and "ciphertext".
+func parseFlynnMessageKey(key string) (int, string, bool) {
+	rest, ok := strings.CutPrefix(key, "msg_")
+	if !ok {
+		return 0, "", false
+	}
+	number, field, ok := strings.Cut(rest, "_")
+	index, err := strconv.Atoi(number)
+	if !ok || err != nil || field != "payload" && field != "ciphertext" {
+		return 0, "", false
+	}
+	return index, field, true
+}
+
+// deriveRemoteStatics gives each side the peer's public static key when the
+// pattern sends it as a pre-message.
+func deriveRemoteStatics(vector *testVector) error {
+	p, err := parseProtocolName(vector.ProtocolName)
+	if err != nil {
+		// runVector skips protocols this library does not support.
+		return nil
+	}
+	if slices.Contains(p.Pattern.InitiatorPreMessages, noise.MessagePatternS) {
+		key, err := createStaticKeypair(vector.InitStatic)
+		if err != nil {
+			return err
+		}
+		vector.RespRemoteStatic = key.Public
+	}
+	if slices.Contains(p.Pattern.ResponderPreMessages, noise.MessagePatternS) {
+		key, err := createStaticKeypair(vector.RespStatic)
+		if err != nil {
+			return err
+		}
+		vector.InitRemoteStatic = key.Public
+	}
+	return nil
+}
+
+// vectorConfig builds one side's config with the vector's fixed keys.
+func vectorConfig(p *protocol, initiator bool, static, remote, ephemeral, prologue []byte, psks []hexBytes, messages []vectorMessage) *ConnConfig {
+	config := NewConnConfig(p.Name, initiator).
+		WithHandshakeTimeout(5 * time.Second).
+		WithPrologue(prologue).
+		WithHandshakePayloadProvider(func(msgIndex int) []byte {
+			return messages[msgIndex].Payload
+		})
+	if len(static) > 0 {
+		config.WithStaticKey(static)
+	}
+	if len(remote) > 0 {
+		config.WithRemoteKey(remote)
+	}
+	if len(psks) > 0 {
+		config.WithPresharedKey(psks[0], p.PSKPlacement)
+	}
+	config.ephemeralKey = ephemeral
+	return config
+}
+
+// runVector performs the vector's handshake and transport messages through
+// NoiseConn and compares each message as written on the wire, the received
+// payloads and the handshake hash. NoiseConn sends plain Noise transport
+// messages unless MessageTypes is enabled, so its transport ciphertexts must
+// match the vector's exactly.
+func runVector(t *testing.T, vector testVector) {
+	p, err := parseProtocolName(vector.ProtocolName)
+	if err != nil || strings.Contains(vector.ProtocolName, "+") || len(vector.InitPsks) > 1 {
+		t.Skipf("unsupported protocol %s", vector.ProtocolName)
+	}
+
+	hsCount := len(p.Pattern.Messages)
+	require.GreaterOrEqual(t, len(vector.Messages), hsCount)
+
+	initiatorConfig := vectorConfig(p, true, vector.InitStatic, vector.InitRemoteStatic,
+		vector.InitEphemeral, vector.InitPrologue, vector.InitPsks, vector.Messages)
+	responderConfig := vectorConfig(p, false, vector.RespStatic, vector.RespRemoteStatic,
+		vector.RespEphemeral, vector.RespPrologue, vector.RespPsks, vector.Messages)
+
+	received := make([][]byte, hsCount)
+	record := func(payload HandshakePayload) error {
+		received[payload.MessageIndex] = payload.Data
+		return nil
+	}
+	initiatorConfig.WithHandshakePayloadHandler(record)
+	responderConfig.WithHandshakePayloadHandler(record)
+
+	initiatorPipe, responderPipe := net.Pipe()
+	initiatorWire := &recordingConn{Conn: initiatorPipe}
+	responderWire := &recordingConn{Conn: responderPipe}
+
+	initiator, err := NewNoiseConn(initiatorWire, initiatorConfig)
+	require.NoError(t, err)
+	defer initiator.Close()
+	responder, err := NewNoiseConn(responderWire, responderConfig)
+	require.NoError(t, err)
+	defer responder.Close()
+
+	errs := make(chan error, 1)
+	go func() { errs <- responder.Handshake(t.Context()) }()
+	require.NoError(t, initiator.Handshake(t.Context()))
+	require.NoError(t, <-errs)
+
+	initiatorFrames, responderFrames := initiatorWire.frames(), responderWire.frames()
+	for i := 0; i < hsCount; i++ {
+		frames := &initiatorFrames
+		if i%2 == 1 {
+			frames = &responderFrames
+		}
+		require.NotEmpty(t, *frames, "handshake message %d was not written", i)
+		assert.Equal(t, hex.EncodeToString(vector.Messages[i].Ciphertext), hex.EncodeToString((*frames)[0]), "handshake message %d", i)
+		*frames = (*frames)[1:]
+	}
+	for i, payload := range received {
+		assert.Equal(t, hex.EncodeToString(vector.Messages[i].Payload), hex.EncodeToString(payload), "handshake payload %d", i)
+	}
+
+	if len(vector.HandshakeHash) > 0 {
+		assert.Equal(t, []byte(vector.HandshakeHash), initiator.HandshakeHash())
+		assert.Equal(t, []byte(vector.HandshakeHash), responder.HandshakeHash())
+	}
+
+	for i := hsCount; i < len(vector.Messages); i++ {
+		sender, receiver, wire := initiator, responder, initiatorWire
+		if vector.transportRestarts && (i-hsCount)%2 == 1 || !vector.transportRestarts && hsCount > 1 && i%2 == 1 {
+			sender, receiver, wire = responder, initiator, responderWire
+		}
+		msg := vector.Messages[i]
+
+		go func() { errs <- sender.WriteMessage(msg.Payload) }()
+		payload, err := receiver.ReadMessage()
+		require.NoError(t, err, "transport message %d", i)
+		require.NoError(t, <-errs, "transport message %d", i)
+		assert.Equal(t, hex.EncodeToString(msg.Payload), hex.EncodeToString(payload), "transport payload %d", i)
+
+		frames := wire.frames()
+		assert.Equal(t, hex.EncodeToString(msg.Ciphertext), hex.EncodeToString(frames[len(frames)-1]), "transport message %d", i)
+	}
+}
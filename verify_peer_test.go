@@ -0,0 +1,153 @@
+package noise
+
+import (
+	"errors"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// xxConfigs returns XX configs with fresh static keys and the initiator's public key.
+func xxConfigs(t *testing.T) (*ConnConfig, *ConnConfig, []byte, []byte) {
+	t.Helper()
+	initiatorPrivate, initiatorPublic := newTestKeyPair(t)
+	responderPrivate, responderPublic := newTestKeyPair(t)
+	initiatorConfig := NewConnConfig("XX", true).
+		WithStaticKey(initiatorPrivate).
+		WithHandshakeTimeout(5 * time.Second)
+	responderConfig := NewConnConfig("XX", false).
+		WithStaticKey(responderPrivate).
+		WithHandshakeTimeout(5 * time.Second)
+	return initiatorConfig, responderConfig, initiatorPublic, responderPublic
+}
+
+func TestVerifyPeerAccepts(t *testing.T) {
+	initiatorConfig, responderConfig, initiatorPublic, _ := xxConfigs(t)
+	initiatorConfig.WithHandshakePayloadProvider(func(msgIndex int) []byte {
+		if msgIndex == 2 {
+			return []byte("hello")
+		}
+		return nil
+	})
+
+	var calls int32
+	var gotKey, gotPayload []byte
+	responderConfig.WithVerifyPeer(func(remoteStatic, payload []byte) error {
+		atomic.AddInt32(&calls, 1)
+		gotKey, gotPayload = remoteStatic, payload
+		return nil
+	})
+
+	initiator, responder := establishPair(t, initiatorConfig, responderConfig)
+
+	assert.Equal(t, int32(1), atomic.LoadInt32(&calls))
+	assert.Equal(t, initiatorPublic, gotKey)
+	assert.Equal(t, []byte("hello"), gotPayload)
+	sendMessages(t, initiator, responder, []string{"allowed"}, 0)
+}
+
+func TestVerifyPeerRejectsBeforePayloadDelivery(t *testing.T) {
+	initiatorConfig, responderConfig, _, _ := xxConfigs(t)
+	initiatorConfig.WithHandshakePayloadProvider(func(msgIndex int) []byte {
+		return []byte("payload")
+	})
+
+	handlerCalled := false
+	responderConfig.
+		WithVerifyPeer(func(remoteStatic, payload []byte) error {
+			return errors.New("not on the allowlist")
+		}).
+		WithHandshakePayloadHandler(func(payload HandshakePayload) error {
+			handlerCalled = payload.MessageIndex == 2
+			return nil
+		})
+
+	_, responder, _, responderErr := runHandshakePair(t, initiatorConfig, responderConfig)
+
+	requireErrorCode(t, responderErr, "PEER_REJECTED")
+	assert.Contains(t, responderErr.Error(), "not on the allowlist")
+	assert.False(t, handlerCalled, "the rejected peer's payload must not reach the handler")
+	assert.Empty(t, responder.HandshakePayloads(), "a failed handshake keeps no payloads")
+	assert.Nil(t, responder.PeerStatic())
+}
+
+func TestVerifyPeerInitiatorRejectsResponder(t *testing.T) {
+	initiatorConfig, responderConfig, _, responderPublic := xxConfigs(t)
+
+	var gotKey []byte
+	initiatorConfig.WithVerifyPeer(func(remoteStatic, payload []byte) error {
+		gotKey = remoteStatic
+		return errors.New("unknown server")
+	})
+
+	_, _, initiatorErr, responderErr := runHandshakePair(t, initiatorConfig, responderConfig)
+
+	requireErrorCode(t, initiatorErr, "PEER_REJECTED")
+	assert.Error(t, responderErr, "the final message is never sent")
+	assert.Equal(t, responderPublic, gotKey)
+}
+
+func TestVerifyPeerSkipsConfiguredRemoteKey(t *testing.T) {
+	responderPrivate, responderPublic := newTestKeyPair(t)
+	called := false
+	initiatorConfig := NewConnConfig("IK", true).
+		WithStaticKey(newTestStaticKey(t)).
+		WithRemoteKey(responderPublic).
+		WithVerifyPeer(func(remoteStatic, payload []byte) error {
+			called = true
+			return errors.New("should not be asked")
+		}).
+		WithHandshakeTimeout(5 * time.Second)
+	responderConfig := NewConnConfig("IK", false).
+		WithStaticKey(responderPrivate).
+		WithHandshakeTimeout(5 * time.Second)
+
+	establishPair(t, initiatorConfig, responderConfig)
+	assert.False(t, called)
+}
+
+func TestListenerVerifyPeer(t *testing.T) {
+	responderPrivate, _ := newTestKeyPair(t)
+	allowedPrivate, allowedPublic := newTestKeyPair(t)
+
+	tcpListener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	listener, err := NewNoiseListener(tcpListener, NewListenerConfig("XX").
+		WithStaticKey(responderPrivate).
+		WithHandshakeTimeout(5*time.Second).
+		WithVerifyPeer(func(remoteStatic, payload []byte) error {
+			if string(remoteStatic) != string(allowedPublic) {
+				return errors.New("not allowed")
+			}
+			return nil
+		}))
+	require.NoError(t, err)
+	defer listener.Close()
+
+	results := make(chan error, 2)
+	go func() {
+		for i := 0; i < 2; i++ {
+			conn, err := listener.Accept()
+			if err != nil {
+				results <- err
+				return
+			}
+			results <- conn.(*NoiseConn).Handshake(t.Context())
+			conn.Close()
+		}
+	}()
+
+	for _, key := range [][]byte{allowedPrivate, newTestStaticKey(t)} {
+		client, err := DialNoiseWithHandshake("tcp", tcpListener.Addr().String(),
+			NewConnConfig("XX", true).WithStaticKey(key).WithHandshakeTimeout(5*time.Second))
+		require.NoError(t, err, "the initiator finishes XX before the responder's check")
+		client.Close()
+	}
+
+	assert.NoError(t, <-results)
+	requireErrorCode(t, <-results, "PEER_REJECTED")
+}